@@ -0,0 +1,502 @@
+package cri
+
+import (
+  "bytes"
+  "encoding/binary"
+  "fmt"
+  "os"
+  "path/filepath"
+  "strings"
+)
+
+// Reference types of cues, synth items and track commands.
+const (
+  REFERENCE_NONE           = 0
+  REFERENCE_WAVEFORM       = 1
+  REFERENCE_SYNTH          = 2
+  REFERENCE_SEQUENCE       = 3
+  REFERENCE_BLOCK_SEQUENCE = 8
+)
+
+// Track commands referencing a synth or a sequence.
+const (
+  COMMAND_NOTE_ON         = 0x07D0
+  COMMAND_NOTE_ON_WITH_NO = 0x07D1
+)
+
+// Streaming modes of waveforms.
+const (
+  STREAMING_MEMORY   = 0
+  STREAMING_STREAM   = 1
+  STREAMING_PREFETCH = 2
+)
+
+// references deeper than this are taken for a loop
+const maxReferenceDepth = 16
+
+// bytes of a waveform read to sniff its header
+const waveformHeadSize = 0x1000
+
+var encodeTypeNames = map[int]string{
+  0:  "ADX",
+  2:  "HCA",
+  3:  "ADX",
+  6:  "HCA-MX",
+  7:  "VAG",
+  8:  "ATRAC3",
+  9:  "BCWAV",
+  11: "ATRAC9",
+  12: "XMA",
+  13: "DSP",
+  18: "ATRAC9",
+  19: "AAC",
+}
+
+// EncodeTypeName names the codec of a waveform encode type.
+func EncodeTypeName(encodeType int) string {
+  if name, ok := encodeTypeNames[encodeType]; ok {
+    return name
+  }
+  return fmt.Sprintf("EncodeType %d", encodeType)
+}
+
+// Acb is a CRI ADX2 cue sheet binary with the waveforms its cues play.
+type Acb struct {
+  Name    string
+  Version uint32
+  Cues    []Cue
+  // every waveform of the waveform table, in order
+  Waveforms []Waveform
+  // embedded archive of the in-memory waveforms, nil without
+  MemoryAwb *Awb
+  // companion .awb of the streamed waveforms, empty when it was not found
+  StreamAwbPath string
+  // names of the companion archives listed by the ACB
+  StreamAwbNames []string
+}
+
+type Cue struct {
+  Index int
+  ID    int
+  Name  string
+  // length in milliseconds as authored, 0 when unknown
+  Length int
+  // indexes into Acb.Waveforms
+  Waveforms []int
+}
+
+type Waveform struct {
+  Index int
+  // ID of the file in its AWB
+  ID         int
+  Streaming  bool
+  EncodeType int
+  Codec      string
+  Channels   int
+  SampleRate int
+  Samples    int
+  Loop       bool
+  // position of the file in its AWB counted from 1, the subsong number of
+  // vgmstream for in-memory waveforms, 0 when the file was not found
+  Subsong int
+}
+
+// Milliseconds is the length of the waveform, 0 when unknown.
+func (w *Waveform) Milliseconds() int {
+  if w.SampleRate <= 0 {
+    return 0
+  }
+  return int(int64(w.Samples) * 1000 / int64(w.SampleRate))
+}
+
+// sniff reads the codec, format and length from the start of the waveform
+// data, which beats the waveform table of older ACBs.
+func (w *Waveform) sniff(head []byte) {
+  switch {
+  case IsHca(head):
+    h, err := ParseHcaHeader(head)
+    if err != nil {
+      return
+    }
+    if w.Codec != "HCA-MX" {
+      w.Codec = "HCA"
+    }
+    w.Channels = h.Channels
+    w.SampleRate = h.SampleRate
+    w.Samples = h.Samples()
+    w.Loop = h.Loop
+  case IsAdx(head):
+    h, err := ParseAdxHeader(head)
+    if err != nil {
+      return
+    }
+    w.Codec = "ADX"
+    w.Channels = h.Channels
+    w.SampleRate = h.SampleRate
+    w.Samples = h.Samples
+    w.Loop = w.Loop || h.Loop
+  }
+}
+
+// IsAcb tells whether data starts like an ACB, which is an @UTF table.
+func IsAcb(data []byte) bool {
+  return IsUtfTable(data)
+}
+
+// ParseAcb parses the ACB in data with its embedded AWB. Streamed waveforms
+// only have what the waveform table tells, see OpenAcb.
+func ParseAcb(data []byte) (*Acb, error) {
+  header, err := ParseUtfTable(data)
+  if err != nil {
+    return nil, err
+  }
+  if !header.Has("CueTable") || len(header.Rows) == 0 {
+    return nil, fmt.Errorf("@UTF table %q is not an ACB header", header.Name)
+  }
+  a := &Acb{
+    Name:    header.String(0, "Name"),
+    Version: uint32(header.Int(0, "Version")),
+  }
+  t := &acbTables{}
+  for _, table := range []struct {
+    dst   **UtfTable
+    names []string
+  }{
+    {&t.cues, []string{"CueTable"}},
+    {&t.cueNames, []string{"CueNameTable"}},
+    {&t.waveforms, []string{"WaveformTable"}},
+    {&t.synths, []string{"SynthTable"}},
+    {&t.sequences, []string{"SequenceTable"}},
+    {&t.tracks, []string{"TrackTable"}},
+    // newer ACBs moved the commands of tracks to their own table
+    {&t.events, []string{"TrackEventTable", "CommandTable"}},
+    {&t.blockSequences, []string{"BlockSequenceTable"}},
+    {&t.blocks, []string{"BlockTable"}},
+  } {
+    for _, name := range table.names {
+      if *table.dst != nil {
+        break
+      }
+      if *table.dst, err = header.Table(0, name); err != nil {
+        return nil, err
+      }
+    }
+  }
+  if t.cues == nil {
+    return nil, fmt.Errorf("ACB %q has no cue table", a.Name)
+  }
+  if streamAwbs, err := header.Table(0, "StreamAwbHash"); err == nil && streamAwbs != nil {
+    for i := range streamAwbs.Rows {
+      if name := streamAwbs.String(i, "Name"); name != "" {
+        a.StreamAwbNames = append(a.StreamAwbNames, name)
+      }
+    }
+  }
+  if awb := header.Data(0, "AwbFile"); len(awb) > 0 {
+    if a.MemoryAwb, err = ParseAwb(bytes.NewReader(awb), int64(len(awb))); err != nil {
+      return nil, fmt.Errorf("AwbFile: %w", err)
+    }
+  }
+
+  if t.waveforms != nil {
+    a.Waveforms = make([]Waveform, len(t.waveforms.Rows))
+    for i := range a.Waveforms {
+      w := &a.Waveforms[i]
+      streaming := t.waveforms.Int(i, "Streaming")
+      w.Index = i
+      w.Streaming = streaming != STREAMING_MEMORY
+      switch {
+      case !t.waveforms.Has("MemoryAwbId"):
+        w.ID = int(t.waveforms.Int(i, "Id"))
+      case w.Streaming:
+        // prefetched waveforms only keep their start in memory
+        w.ID = int(t.waveforms.Int(i, "StreamAwbId"))
+      default:
+        w.ID = int(t.waveforms.Int(i, "MemoryAwbId"))
+      }
+      w.EncodeType = int(t.waveforms.Int(i, "EncodeType"))
+      w.Codec = EncodeTypeName(w.EncodeType)
+      w.Channels = int(t.waveforms.Int(i, "NumChannels"))
+      w.SampleRate = int(t.waveforms.Int(i, "SamplingRate"))
+      w.Samples = int(t.waveforms.Int(i, "NumSamples"))
+      w.Loop = t.waveforms.Int(i, "LoopFlag") != 0
+      if !w.Streaming && a.MemoryAwb != nil {
+        a.sniffWaveform(w, a.MemoryAwb)
+      }
+    }
+  }
+
+  names := map[int]string{}
+  if t.cueNames != nil {
+    for i := range t.cueNames.Rows {
+      names[int(t.cueNames.Int(i, "CueIndex"))] = t.cueNames.String(i, "CueName")
+    }
+  }
+  a.Cues = make([]Cue, len(t.cues.Rows))
+  for i := range a.Cues {
+    cue := &a.Cues[i]
+    cue.Index = i
+    cue.ID = int(t.cues.Int(i, "CueId"))
+    cue.Name = names[i]
+    if length := t.cues.Int(i, "Length"); length != 0xFFFFFFFF {
+      cue.Length = int(length)
+    }
+    walk := &acbWalk{seen: map[acbReference]bool{}}
+    t.collect(
+      int(t.cues.Int(i, "ReferenceType")),
+      int(t.cues.Int(i, "ReferenceIndex")),
+      0,
+      walk,
+    )
+    cue.Waveforms = walk.waveforms
+  }
+  return a, nil
+}
+
+// OpenAcb reads the ACB at path and the streamed waveforms of its companion
+// .awb when there is one next to it.
+func OpenAcb(path string) (*Acb, error) {
+  data, err := os.ReadFile(path)
+  if err != nil {
+    return nil, err
+  }
+  a, err := ParseAcb(data)
+  if err != nil {
+    return nil, fmt.Errorf("%s: %w", path, err)
+  }
+  if !a.HasStreamed() {
+    return a, nil
+  }
+  candidates := []string{strings.TrimSuffix(path, filepath.Ext(path)) + ".awb"}
+  for _, name := range a.StreamAwbNames {
+    candidates = append(candidates, filepath.Join(filepath.Dir(path), name+".awb"))
+  }
+  for _, candidate := range candidates {
+    if _, err := os.Stat(candidate); err == nil {
+      a.StreamAwbPath = candidate
+      break
+    }
+  }
+  if a.StreamAwbPath == "" {
+    return a, nil
+  }
+  awb, err := OpenAwb(a.StreamAwbPath)
+  if err != nil {
+    return nil, err
+  }
+  defer awb.Close()
+  for i := range a.Waveforms {
+    if a.Waveforms[i].Streaming {
+      a.sniffWaveform(&a.Waveforms[i], awb)
+    }
+  }
+  return a, nil
+}
+
+// HasStreamed tells whether a waveform is streamed from a companion .awb.
+func (a *Acb) HasStreamed() bool {
+  for _, w := range a.Waveforms {
+    if w.Streaming {
+      return true
+    }
+  }
+  return false
+}
+
+// Subsongs is the number of waveforms of the embedded AWB.
+func (a *Acb) Subsongs() int {
+  if a.MemoryAwb == nil {
+    return 0
+  }
+  return len(a.MemoryAwb.Files)
+}
+
+// SubsongWaveform finds the in-memory waveform of a subsong counted from 1.
+func (a *Acb) SubsongWaveform(subsong int) (*Waveform, bool) {
+  for i := range a.Waveforms {
+    if !a.Waveforms[i].Streaming && a.Waveforms[i].Subsong == subsong {
+      return &a.Waveforms[i], true
+    }
+  }
+  return nil, false
+}
+
+// SubsongName names a subsong after the first cue playing it.
+func (a *Acb) SubsongName(subsong int) string {
+  w, ok := a.SubsongWaveform(subsong)
+  if !ok {
+    return ""
+  }
+  for _, cue := range a.Cues {
+    for _, index := range cue.Waveforms {
+      if index == w.Index {
+        return cue.Name
+      }
+    }
+  }
+  return ""
+}
+
+// ReadWaveform reads the data of a waveform from the embedded AWB or the
+// companion .awb, with the subkey of its archive.
+func (a *Acb) ReadWaveform(w *Waveform) ([]byte, uint16, error) {
+  awb := a.MemoryAwb
+  if w.Streaming {
+    if a.StreamAwbPath == "" {
+      return nil, 0, fmt.Errorf("waveform %d is streamed from a missing .awb", w.Index)
+    }
+    stream, err := OpenAwb(a.StreamAwbPath)
+    if err != nil {
+      return nil, 0, err
+    }
+    defer stream.Close()
+    awb = stream
+  }
+  if awb == nil {
+    return nil, 0, fmt.Errorf("waveform %d has no AWB", w.Index)
+  }
+  file, _, ok := awb.File(w.ID)
+  if !ok {
+    return nil, 0, fmt.Errorf("waveform %d is not in its AWB", w.Index)
+  }
+  data, err := awb.Read(file)
+  if err != nil {
+    return nil, 0, err
+  }
+  return data, awb.Subkey, nil
+}
+
+func (a *Acb) sniffWaveform(w *Waveform, awb *Awb) {
+  file, position, ok := awb.File(w.ID)
+  if !ok {
+    return
+  }
+  w.Subsong = position + 1
+  head, err := awb.ReadHead(file, waveformHeadSize)
+  if err != nil {
+    return
+  }
+  w.sniff(head)
+}
+
+// acbTables are the tables of an ACB followed from a cue to its waveforms.
+type acbTables struct {
+  cues           *UtfTable
+  cueNames       *UtfTable
+  waveforms      *UtfTable
+  synths         *UtfTable
+  sequences      *UtfTable
+  tracks         *UtfTable
+  events         *UtfTable
+  blockSequences *UtfTable
+  blocks         *UtfTable
+}
+
+// acbReference is a row referenced from a cue.
+type acbReference struct {
+  kind  int
+  index int
+}
+
+// acbWalk follows the references of a cue, each of them once.
+type acbWalk struct {
+  seen      map[acbReference]bool
+  waveforms []int
+}
+
+// collect appends the waveforms played by a reference to walk. A reference
+// already followed is skipped, so that a loop in the tables cannot make the
+// walk explode.
+func (t *acbTables) collect(kind int, index int, depth int, walk *acbWalk) {
+  if depth > maxReferenceDepth {
+    return
+  }
+  reference := acbReference{kind, index}
+  if walk.seen[reference] {
+    return
+  }
+  walk.seen[reference] = true
+  switch kind {
+  case REFERENCE_WAVEFORM:
+    if t.waveforms == nil || index >= len(t.waveforms.Rows) {
+      return
+    }
+    walk.waveforms = append(walk.waveforms, index)
+  case REFERENCE_SYNTH:
+    if t.synths == nil {
+      return
+    }
+    items := t.synths.Data(index, "ReferenceItems")
+    for i := 0; i+4 <= len(items); i += 4 {
+      t.collect(
+        int(binary.BigEndian.Uint16(items[i:])),
+        int(binary.BigEndian.Uint16(items[i+2:])),
+        depth+1,
+        walk,
+      )
+    }
+  case REFERENCE_SEQUENCE:
+    if t.sequences == nil {
+      return
+    }
+    t.collectTracks(t.sequences, index, depth, walk)
+  case REFERENCE_BLOCK_SEQUENCE:
+    if t.blockSequences == nil {
+      return
+    }
+    t.collectTracks(t.blockSequences, index, depth, walk)
+    if t.blocks == nil {
+      return
+    }
+    for _, block := range indexes(t.blockSequences, index, "BlockIndex", "NumBlocks") {
+      t.collectTracks(t.blocks, block, depth, walk)
+    }
+  }
+}
+
+// collectTracks follows the tracks listed by a row of a sequence, block
+// sequence or block table.
+func (t *acbTables) collectTracks(table *UtfTable, row int, depth int, walk *acbWalk) {
+  if t.tracks == nil || t.events == nil {
+    return
+  }
+  for _, track := range indexes(table, row, "TrackIndex", "NumTracks") {
+    event := t.tracks.Int(track, "EventIndex")
+    if event == 0xFFFF {
+      continue
+    }
+    commands := t.events.Data(int(event), "Command")
+    for i := 0; i+3 <= len(commands); {
+      code := binary.BigEndian.Uint16(commands[i:])
+      size := int(commands[i+2])
+      i += 3
+      if i+size > len(commands) {
+        break
+      }
+      if (code == COMMAND_NOTE_ON || code == COMMAND_NOTE_ON_WITH_NO) && size >= 4 {
+        t.collect(
+          int(binary.BigEndian.Uint16(commands[i:])),
+          int(binary.BigEndian.Uint16(commands[i+2:])),
+          depth+1,
+          walk,
+        )
+      }
+      i += size
+    }
+  }
+}
+
+// indexes reads a data column of uint16 row indexes, at most count of them
+// when the table has the count column.
+func indexes(table *UtfTable, row int, name string, count string) []int {
+  data := table.Data(row, name)
+  n := len(data) / 2
+  if table.Has(count) {
+    n = min(n, int(table.Int(row, count)))
+  }
+  result := make([]int, n)
+  for i := range result {
+    result[i] = int(binary.BigEndian.Uint16(data[i*2:]))
+  }
+  return result
+}
@@ -0,0 +1,180 @@
+package cri
+
+import (
+  "bytes"
+  "encoding/binary"
+  "slices"
+  "testing"
+)
+
+// references encodes the ReferenceItems of a synth or the arguments of a
+// note on command, as pairs of kind and index.
+func references(pairs ...int) []byte {
+  data := []byte{}
+  for _, v := range pairs {
+    data = binary.BigEndian.AppendUint16(data, uint16(v))
+  }
+  return data
+}
+
+// encodeTestAcb encodes an ACB of two in-memory waveforms and four cues:
+// a synth of both waveforms, a waveform, a synth referencing itself and a
+// sequence playing the first synth.
+func encodeTestAcb(synths ...[]byte) []byte {
+  hca, _ := encodeTestHca(1, 0, 0)
+  awb := encodeTestAwb(0x20, 0, []uint16{0, 1}, [][]byte{hca, []byte("not a waveform")})
+  if len(synths) == 0 {
+    selfLoop := []byte{}
+    for range 100 {
+      selfLoop = append(selfLoop, references(REFERENCE_SYNTH, 1)...)
+    }
+    synths = [][]byte{
+      references(REFERENCE_WAVEFORM, 0, REFERENCE_WAVEFORM, 1, REFERENCE_WAVEFORM, 0),
+      append(selfLoop, references(REFERENCE_WAVEFORM, 1)...),
+    }
+  }
+  synthItems := make([]any, len(synths))
+  for i, synth := range synths {
+    synthItems[i] = synth
+  }
+  noteOn := append(binary.BigEndian.AppendUint16(nil, COMMAND_NOTE_ON), 4)
+  noteOn = append(noteOn, references(REFERENCE_SYNTH, 0)...)
+
+  cues := encodeTestUtf("Cue", 4,
+    utfTestColumn{name: "CueId", kind: UTF_TYPE_U32, values: []any{uint32(10), uint32(11), uint32(12), uint32(13)}},
+    utfTestColumn{name: "ReferenceType", kind: UTF_TYPE_U8, values: []any{uint8(REFERENCE_SYNTH), uint8(REFERENCE_WAVEFORM), uint8(REFERENCE_SYNTH), uint8(REFERENCE_SEQUENCE)}},
+    utfTestColumn{name: "ReferenceIndex", kind: UTF_TYPE_U16, values: []any{uint16(0), uint16(1), uint16(1), uint16(0)}},
+    utfTestColumn{name: "Length", kind: UTF_TYPE_U32, values: []any{uint32(1500), uint32(0xFFFFFFFF), uint32(0), uint32(20)}},
+  )
+  cueNames := encodeTestUtf("CueName", 2,
+    utfTestColumn{name: "CueName", kind: UTF_TYPE_STRING, values: []any{"bgm", "se"}},
+    utfTestColumn{name: "CueIndex", kind: UTF_TYPE_U16, values: []any{uint16(0), uint16(1)}},
+  )
+  waveforms := encodeTestUtf("Waveform", 2,
+    utfTestColumn{name: "MemoryAwbId", kind: UTF_TYPE_U16, values: []any{uint16(0), uint16(1)}},
+    utfTestColumn{name: "StreamAwbId", kind: UTF_TYPE_U16, values: []any{uint16(0xFFFF), uint16(0xFFFF)}},
+    utfTestColumn{name: "Streaming", kind: UTF_TYPE_U8, values: []any{uint8(STREAMING_MEMORY)}, constant: true},
+    utfTestColumn{name: "EncodeType", kind: UTF_TYPE_U8, values: []any{uint8(2), uint8(13)}},
+    utfTestColumn{name: "NumChannels", kind: UTF_TYPE_U8, values: []any{uint8(2), uint8(1)}},
+    utfTestColumn{name: "SamplingRate", kind: UTF_TYPE_U16, values: []any{uint16(48000), uint16(32000)}},
+    utfTestColumn{name: "NumSamples", kind: UTF_TYPE_U32, values: []any{uint32(1), uint32(64000)}},
+  )
+  synthTable := encodeTestUtf("Synth", len(synths),
+    utfTestColumn{name: "ReferenceItems", kind: UTF_TYPE_DATA, values: synthItems},
+  )
+  sequences := encodeTestUtf("Sequence", 1,
+    utfTestColumn{name: "NumTracks", kind: UTF_TYPE_U16, values: []any{uint16(1)}},
+    utfTestColumn{name: "TrackIndex", kind: UTF_TYPE_DATA, values: []any{references(0, 0xFFFF)}},
+  )
+  tracks := encodeTestUtf("Track", 1,
+    utfTestColumn{name: "EventIndex", kind: UTF_TYPE_U16, values: []any{uint16(0)}},
+  )
+  events := encodeTestUtf("TrackEvent", 1,
+    utfTestColumn{name: "Command", kind: UTF_TYPE_DATA, values: []any{noteOn}},
+  )
+  return encodeTestUtf("Header", 1,
+    utfTestColumn{name: "Name", kind: UTF_TYPE_STRING, values: []any{"test_acb"}},
+    utfTestColumn{name: "Version", kind: UTF_TYPE_U32, values: []any{uint32(0x01300000)}},
+    utfTestColumn{name: "CueTable", kind: UTF_TYPE_DATA, values: []any{cues}},
+    utfTestColumn{name: "CueNameTable", kind: UTF_TYPE_DATA, values: []any{cueNames}},
+    utfTestColumn{name: "WaveformTable", kind: UTF_TYPE_DATA, values: []any{waveforms}},
+    utfTestColumn{name: "SynthTable", kind: UTF_TYPE_DATA, values: []any{synthTable}},
+    utfTestColumn{name: "SequenceTable", kind: UTF_TYPE_DATA, values: []any{sequences}},
+    utfTestColumn{name: "TrackTable", kind: UTF_TYPE_DATA, values: []any{tracks}},
+    utfTestColumn{name: "TrackEventTable", kind: UTF_TYPE_DATA, values: []any{events}},
+    utfTestColumn{name: "AwbFile", kind: UTF_TYPE_DATA, values: []any{awb}},
+  )
+}
+
+func TestParseAcb(t *testing.T) {
+  acb, err := ParseAcb(encodeTestAcb())
+  if err != nil {
+    t.Fatal(err)
+  }
+  if acb.Name != "test_acb" || acb.Version != 0x01300000 || acb.Subsongs() != 2 || acb.HasStreamed() {
+    t.Fatalf("parsed ACB %q version %#x of %d subsongs", acb.Name, acb.Version, acb.Subsongs())
+  }
+  for i, want := range []struct {
+    id        int
+    name      string
+    length    int
+    waveforms []int
+  }{
+    {10, "bgm", 1500, []int{0, 1}},
+    {11, "se", 0, []int{1}},
+    {12, "", 0, []int{1}},
+    {13, "", 20, []int{0, 1}},
+  } {
+    cue := acb.Cues[i]
+    if cue.ID != want.id || cue.Name != want.name || cue.Length != want.length || !slices.Equal(cue.Waveforms, want.waveforms) {
+      t.Errorf("cue %d is %+v, want %+v", i, cue, want)
+    }
+  }
+
+  // the first waveform is sniffed from its HCA header
+  hca := acb.Waveforms[0]
+  if hca.Codec != "HCA" || hca.Channels != 1 || hca.SampleRate != 44100 || hca.Samples != HCA_BLOCK_SAMPLES || hca.Subsong != 1 {
+    t.Errorf("waveform 0 is %+v", hca)
+  }
+  other := acb.Waveforms[1]
+  if other.Codec != "DSP" || other.Channels != 1 || other.SampleRate != 32000 || other.Milliseconds() != 2000 || other.Subsong != 2 {
+    t.Errorf("waveform 1 is %+v", other)
+  }
+  if w, ok := acb.SubsongWaveform(2); !ok || w.Index != 1 || acb.SubsongName(2) != "bgm" {
+    t.Errorf("subsong 2 is %+v named %q", w, acb.SubsongName(2))
+  }
+  data, subkey, err := acb.ReadWaveform(&acb.Waveforms[1])
+  if err != nil || string(data) != "not a waveform" || subkey != 0 {
+    t.Errorf("waveform 1 reads %q with subkey %d: %v", data, subkey, err)
+  }
+}
+
+func TestParseAcbReferenceLoops(t *testing.T) {
+  // every synth references all of them, each walk must stay linear
+  const count = 64
+  synths := make([][]byte, count)
+  for i := range synths {
+    for j := range count {
+      synths[i] = append(synths[i], references(REFERENCE_SYNTH, j)...)
+    }
+    synths[i] = append(synths[i], references(REFERENCE_WAVEFORM, i%2)...)
+  }
+  acb, err := ParseAcb(encodeTestAcb(synths...))
+  if err != nil {
+    t.Fatal(err)
+  }
+  if got := acb.Cues[0].Waveforms; !slices.Equal(got, []int{1, 0}) {
+    t.Errorf("cue 0 plays %v, want [1 0]", got)
+  }
+}
+
+func TestParseAcbCorrupted(t *testing.T) {
+  emptyCues := encodeTestUtf("Header", 1,
+    utfTestColumn{name: "Name", kind: UTF_TYPE_STRING, values: []any{"empty"}},
+    utfTestColumn{name: "CueTable", kind: UTF_TYPE_DATA, values: []any{[]byte{}}},
+  )
+  notAcb := encodeTestUtf("Other", 1,
+    utfTestColumn{name: "Name", kind: UTF_TYPE_STRING, values: []any{"other"}},
+  )
+  brokenAwb := encodeTestUtf("Header", 1,
+    utfTestColumn{name: "CueTable", kind: UTF_TYPE_DATA, values: []any{encodeTestUtf("Cue", 0)}},
+    utfTestColumn{name: "AwbFile", kind: UTF_TYPE_DATA, values: []any{[]byte("AFS2 truncated")}},
+  )
+  for name, data := range map[string][]byte{
+    "empty cue table": emptyCues,
+    "no cue table":    notAcb,
+    "broken AWB":      brokenAwb,
+  } {
+    if _, err := ParseAcb(data); err == nil {
+      t.Errorf("ACB with %s was parsed", name)
+    }
+  }
+
+  // no corruption of a single byte may panic
+  data := encodeTestAcb()
+  for i := range data {
+    corrupted := bytes.Clone(data)
+    corrupted[i] ^= 0xFF
+    ParseAcb(corrupted)
+  }
+}
@@ -0,0 +1,145 @@
+package cri
+
+import (
+  "encoding/binary"
+  "fmt"
+  "io"
+  "os"
+)
+
+const AWB_SIGNATURE = "AFS2"
+
+// Awb is an AFS2 archive of waveforms, embedded in an ACB for in-memory
+// playback or next to it as a companion .awb for streaming.
+type Awb struct {
+  Version   uint8
+  Alignment uint32
+  // key modifier of the HCA ciphers of the waveforms
+  Subkey uint16
+  Files  []AwbFile
+  r      io.ReaderAt
+}
+
+type AwbFile struct {
+  ID     int
+  Offset int64
+  Size   int64
+}
+
+// IsAwb tells whether data starts like an AFS2 archive.
+func IsAwb(data []byte) bool {
+  return len(data) >= 4 && string(data[:4]) == AWB_SIGNATURE
+}
+
+// ParseAwb parses the AFS2 archive of size bytes read from r.
+func ParseAwb(r io.ReaderAt, size int64) (*Awb, error) {
+  head := make([]byte, 16)
+  if _, err := r.ReadAt(head, 0); err != nil {
+    return nil, fmt.Errorf("AFS2 header: %w", err)
+  }
+  if !IsAwb(head) {
+    return nil, fmt.Errorf("not an AFS2 archive")
+  }
+  a := &Awb{Version: head[4], r: r}
+  offsetSize := int(head[5])
+  idSize := int(binary.LittleEndian.Uint16(head[6:]))
+  count := int64(binary.LittleEndian.Uint32(head[8:]))
+  a.Alignment = uint32(binary.LittleEndian.Uint16(head[12:]))
+  a.Subkey = binary.LittleEndian.Uint16(head[14:])
+  if a.Alignment == 0 {
+    a.Alignment = 1
+  }
+  if (offsetSize != 2 && offsetSize != 4 && offsetSize != 8) || (idSize != 2 && idSize != 4) {
+    return nil, fmt.Errorf("AFS2 field sizes %d/%d are not supported", offsetSize, idSize)
+  }
+  tableSize := count*int64(idSize) + (count+1)*int64(offsetSize)
+  if 16+tableSize > size {
+    return nil, fmt.Errorf("AFS2 table of %d files lies outside of %d bytes", count, size)
+  }
+  table := make([]byte, tableSize)
+  if _, err := r.ReadAt(table, 16); err != nil {
+    return nil, fmt.Errorf("AFS2 table: %w", err)
+  }
+  tr := newReader(table, binary.LittleEndian)
+  readField := func(n int) int64 {
+    switch n {
+    case 2:
+      return int64(tr.u16())
+    case 4:
+      return int64(tr.u32())
+    }
+    return int64(tr.u64())
+  }
+  ids := make([]int, count)
+  for i := range ids {
+    ids[i] = int(readField(idSize))
+  }
+  offsets := make([]int64, count+1)
+  for i := range offsets {
+    offsets[i] = readField(offsetSize)
+  }
+  align := int64(a.Alignment)
+  a.Files = make([]AwbFile, count)
+  for i := range a.Files {
+    // offsets point right after the previous file, files start aligned
+    start := (offsets[i] + align - 1) / align * align
+    end := offsets[i+1]
+    if start > end || end > size {
+      return nil, fmt.Errorf("AFS2 file %d lies outside of the archive", ids[i])
+    }
+    a.Files[i] = AwbFile{ID: ids[i], Offset: start, Size: end - start}
+  }
+  return a, nil
+}
+
+// OpenAwb reads the AFS2 archive at path. The file stays open for reads
+// until Close.
+func OpenAwb(path string) (*Awb, error) {
+  file, err := os.Open(path)
+  if err != nil {
+    return nil, err
+  }
+  info, err := file.Stat()
+  if err != nil {
+    file.Close()
+    return nil, err
+  }
+  a, err := ParseAwb(file, info.Size())
+  if err != nil {
+    file.Close()
+    return nil, fmt.Errorf("%s: %w", path, err)
+  }
+  return a, nil
+}
+
+// Close closes the file of an archive opened by OpenAwb.
+func (a *Awb) Close() error {
+  if closer, ok := a.r.(io.Closer); ok {
+    return closer.Close()
+  }
+  return nil
+}
+
+// File finds a file by its ID and returns its position in the archive.
+func (a *Awb) File(id int) (AwbFile, int, bool) {
+  for i, file := range a.Files {
+    if file.ID == id {
+      return file, i, true
+    }
+  }
+  return AwbFile{}, -1, false
+}
+
+// Read reads the whole file.
+func (a *Awb) Read(file AwbFile) ([]byte, error) {
+  return a.ReadHead(file, file.Size)
+}
+
+// ReadHead reads at most the first n bytes of the file.
+func (a *Awb) ReadHead(file AwbFile, n int64) ([]byte, error) {
+  data := make([]byte, min(n, file.Size))
+  if _, err := a.r.ReadAt(data, file.Offset); err != nil {
+    return nil, fmt.Errorf("AFS2 file %d: %w", file.ID, err)
+  }
+  return data, nil
+}
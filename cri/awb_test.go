@@ -0,0 +1,93 @@
+package cri
+
+import (
+  "bytes"
+  "encoding/binary"
+  "testing"
+)
+
+// encodeTestAwb encodes an AFS2 archive of files with 2-byte IDs and 4-byte
+// offsets, every file starting aligned.
+func encodeTestAwb(alignment int, subkey uint16, ids []uint16, files [][]byte) []byte {
+  header := &bytes.Buffer{}
+  header.WriteString(AWB_SIGNATURE)
+  header.Write([]byte{1, 4})
+  binary.Write(header, binary.LittleEndian, uint16(2))
+  binary.Write(header, binary.LittleEndian, uint32(len(files)))
+  binary.Write(header, binary.LittleEndian, uint16(alignment))
+  binary.Write(header, binary.LittleEndian, subkey)
+  for _, id := range ids {
+    binary.Write(header, binary.LittleEndian, id)
+  }
+
+  // offsets point right after the previous file, before its padding
+  end := header.Len() + (len(files)+1)*4
+  body := &bytes.Buffer{}
+  offsets := []uint32{uint32(end)}
+  for _, file := range files {
+    for (end+body.Len())%alignment != 0 {
+      body.WriteByte(0)
+    }
+    body.Write(file)
+    offsets = append(offsets, uint32(end+body.Len()))
+  }
+  for _, offset := range offsets {
+    binary.Write(header, binary.LittleEndian, offset)
+  }
+  return append(header.Bytes(), body.Bytes()...)
+}
+
+func TestParseAwb(t *testing.T) {
+  files := [][]byte{[]byte("first"), {}, []byte("third file")}
+  data := encodeTestAwb(0x20, 0x1234, []uint16{5, 9, 2}, files)
+  awb, err := ParseAwb(bytes.NewReader(data), int64(len(data)))
+  if err != nil {
+    t.Fatal(err)
+  }
+  if awb.Subkey != 0x1234 || awb.Alignment != 0x20 || len(awb.Files) != 3 {
+    t.Fatalf("parsed archive %+v", awb)
+  }
+  for i, id := range []int{5, 9, 2} {
+    file, position, ok := awb.File(id)
+    if !ok || position != i {
+      t.Fatalf("file %d is at %d", id, position)
+    }
+    if file.Offset%0x20 != 0 {
+      t.Errorf("file %d at %d is not aligned", id, file.Offset)
+    }
+    content, err := awb.Read(file)
+    if err != nil {
+      t.Fatal(err)
+    }
+    if !bytes.Equal(content, files[i]) {
+      t.Errorf("file %d is %q, want %q", id, content, files[i])
+    }
+  }
+  if head, err := awb.ReadHead(awb.Files[2], 5); err != nil || string(head) != "third" {
+    t.Errorf("head of file 2 is %q: %v", head, err)
+  }
+  if _, _, ok := awb.File(3); ok {
+    t.Error("file 3 was found")
+  }
+}
+
+func TestParseAwbCorrupted(t *testing.T) {
+  data := encodeTestAwb(4, 0, []uint16{0, 1}, [][]byte{[]byte("abc"), []byte("defgh")})
+  patched := func(offset int, value uint32) []byte {
+    corrupted := bytes.Clone(data)
+    binary.LittleEndian.PutUint32(corrupted[offset:], value)
+    return corrupted
+  }
+  for name, corrupted := range map[string][]byte{
+    "signature":   append([]byte("AFS3"), data[4:]...),
+    "header":      data[:10],
+    "field sizes": patched(4, 0x00030301),
+    "count":       patched(8, 0xFFFFFFFF),
+    "offset":      patched(16+4+8, 0xFFFF),
+    "truncated":   data[:len(data)-1],
+  } {
+    if _, err := ParseAwb(bytes.NewReader(corrupted), int64(len(corrupted))); err == nil {
+      t.Errorf("corrupted %s was parsed", name)
+    }
+  }
+}
@@ -0,0 +1,204 @@
+package cri
+
+import (
+  "encoding/binary"
+  "fmt"
+)
+
+const HCA_SIGNATURE = "HCA\x00"
+
+// HCA_BLOCK_SAMPLES is the number of samples of a channel per HCA block.
+const HCA_BLOCK_SAMPLES = 1024
+
+// Versions of HCA changing the bitstream.
+const (
+  HCA_VERSION_200 = 0x0200
+  HCA_VERSION_300 = 0x0300
+)
+
+// HcaHeader is the header of an HCA stream.
+type HcaHeader struct {
+  Version    uint16
+  HeaderSize int
+  Channels   int
+  SampleRate int
+  BlockCount int
+  BlockSize  int
+  // samples muted at the start and at the end by the encoder
+  EncoderDelay   int
+  EncoderPadding int
+  Loop           bool
+  LoopStartBlock int
+  LoopEndBlock   int
+  LoopStartDelay int
+  LoopEndPadding int
+  CipherType     int
+  // codec parameters of the comp or dec chunk
+  MinResolution    int
+  MaxResolution    int
+  TrackCount       int
+  ChannelConfig    int
+  TotalBandCount   int
+  BaseBandCount    int
+  StereoBandCount  int
+  BandsPerHfrGroup int
+  MsStereo         bool
+  AthType          int
+  // volume of the rva chunk, 1 without
+  Volume float32
+}
+
+// hcaChunk compares a chunk name ignoring the high bits set on the names of
+// encrypted headers.
+func hcaChunk(b []byte, name string) bool {
+  if len(b) < 4 {
+    return false
+  }
+  for i := range 4 {
+    if b[i]&0x7F != name[i] {
+      return false
+    }
+  }
+  return true
+}
+
+// IsHca tells whether data starts like an HCA stream.
+func IsHca(data []byte) bool {
+  return hcaChunk(data, HCA_SIGNATURE)
+}
+
+// ParseHcaHeader parses the header of the HCA stream at the start of data.
+// Only the chunks before the audio data are read.
+func ParseHcaHeader(data []byte) (*HcaHeader, error) {
+  if !IsHca(data) {
+    return nil, fmt.Errorf("not an HCA stream")
+  }
+  r := newReader(data, binary.BigEndian)
+  r.skip(4)
+  h := &HcaHeader{Version: r.u16(), HeaderSize: int(r.u16()), Volume: 1}
+  hasAth := false
+  if r.err == nil && h.HeaderSize > len(data) {
+    return nil, fmt.Errorf("HCA header of %d bytes lies outside of %d bytes", h.HeaderSize, len(data))
+  }
+  for r.err == nil && r.pos+4 <= h.HeaderSize {
+    name := r.bytes(4)
+    switch {
+    case hcaChunk(name, "fmt\x00"):
+      channels := r.u32()
+      h.Channels = int(channels >> 24)
+      h.SampleRate = int(channels & 0xFFFFFF)
+      h.BlockCount = int(r.u32())
+      h.EncoderDelay = int(r.u16())
+      h.EncoderPadding = int(r.u16())
+    case hcaChunk(name, "comp"):
+      h.BlockSize = int(r.u16())
+      h.MinResolution = int(r.u8())
+      h.MaxResolution = int(r.u8())
+      h.TrackCount = int(r.u8())
+      h.ChannelConfig = int(r.u8())
+      h.TotalBandCount = int(r.u8())
+      h.BaseBandCount = int(r.u8())
+      h.StereoBandCount = int(r.u8())
+      h.BandsPerHfrGroup = int(r.u8())
+      h.MsStereo = r.u8() != 0
+      r.skip(1)
+    case hcaChunk(name, "dec\x00"):
+      h.BlockSize = int(r.u16())
+      h.MinResolution = int(r.u8())
+      h.MaxResolution = int(r.u8())
+      h.TotalBandCount = int(r.u8()) + 1
+      h.BaseBandCount = int(r.u8()) + 1
+      tracks := r.u8()
+      h.TrackCount = int(tracks >> 4)
+      h.ChannelConfig = int(tracks & 0xF)
+      // without a stereo type every band is a base band
+      if r.u8() == 0 {
+        h.BaseBandCount = h.TotalBandCount
+      }
+      h.StereoBandCount = h.TotalBandCount - h.BaseBandCount
+    case hcaChunk(name, "vbr\x00"):
+      r.skip(4)
+    case hcaChunk(name, "ath\x00"):
+      hasAth = true
+      h.AthType = int(r.u16())
+    case hcaChunk(name, "loop"):
+      h.Loop = true
+      h.LoopStartBlock = int(r.u32())
+      h.LoopEndBlock = int(r.u32())
+      h.LoopStartDelay = int(r.u16())
+      h.LoopEndPadding = int(r.u16())
+    case hcaChunk(name, "ciph"):
+      h.CipherType = int(r.u16())
+    case hcaChunk(name, "rva\x00"):
+      h.Volume = r.f32()
+    case hcaChunk(name, "comm"):
+      r.skip(1)
+      r.cstring()
+    default:
+      // "pad" or an unknown chunk, both end the chunks before the data
+      r.seek(h.HeaderSize)
+    }
+  }
+  if r.err != nil {
+    return nil, fmt.Errorf("HCA header: %w", r.err)
+  }
+  if h.Channels == 0 || h.SampleRate == 0 {
+    return nil, fmt.Errorf("HCA header has no fmt chunk")
+  }
+  // the curve of the absolute threshold of hearing is the default before 2.0
+  if !hasAth && h.Version < HCA_VERSION_200 {
+    h.AthType = 1
+  }
+  if h.TrackCount == 0 {
+    h.TrackCount = 1
+  }
+  return h, nil
+}
+
+// Samples is the number of samples per channel after the encoder delay and
+// padding are cut.
+func (h *HcaHeader) Samples() int {
+  return max(h.BlockCount*HCA_BLOCK_SAMPLES-h.EncoderDelay-h.EncoderPadding, 0)
+}
+
+// LoopStart is the first sample of the loop.
+func (h *HcaHeader) LoopStart() int {
+  return h.LoopStartBlock*HCA_BLOCK_SAMPLES + h.LoopStartDelay - h.EncoderDelay
+}
+
+// LoopEnd is the sample after the loop.
+func (h *HcaHeader) LoopEnd() int {
+  return (h.LoopEndBlock+1)*HCA_BLOCK_SAMPLES - h.LoopEndPadding - h.EncoderDelay
+}
+
+// AdxHeader is the part of an ADX header needed to tell its length.
+type AdxHeader struct {
+  Channels   int
+  SampleRate int
+  Samples    int
+  Loop       bool
+}
+
+// IsAdx tells whether data starts like an ADX stream.
+func IsAdx(data []byte) bool {
+  return len(data) >= 4 && data[0] == 0x80 && data[1] == 0x00
+}
+
+// ParseAdxHeader parses the header of the ADX stream at the start of data.
+func ParseAdxHeader(data []byte) (*AdxHeader, error) {
+  if !IsAdx(data) || len(data) < 0x14 {
+    return nil, fmt.Errorf("not an ADX stream")
+  }
+  h := &AdxHeader{
+    Channels:   int(data[0x07]),
+    SampleRate: int(binary.BigEndian.Uint32(data[0x08:])),
+    Samples:    int(binary.BigEndian.Uint32(data[0x0C:])),
+  }
+  dataOffset := int(binary.BigEndian.Uint16(data[0x02:])) + 4
+  // the loop flag moved with the extra fields of version 4
+  loopFlag := map[uint8]int{3: 0x18, 4: 0x24}[data[0x12]]
+  if loopFlag > 0 && loopFlag+4 <= min(dataOffset, len(data)) {
+    h.Loop = binary.BigEndian.Uint32(data[loopFlag:]) != 0
+  }
+  return h, nil
+}
@@ -0,0 +1,256 @@
+package cri
+
+import (
+  "bytes"
+  "encoding/binary"
+  "errors"
+  "math"
+  "slices"
+  "testing"
+)
+
+func TestDct4(t *testing.T) {
+  var input, output [HCA_SAMPLES_PER_SUBFRAME]float32
+  for i := range input {
+    input[i] = float32(math.Sin(float64(i)*0.37) + float64(i%7)*0.1)
+  }
+  dct4(&input, &output)
+  for k := range output {
+    want := 0.0
+    for n := range input {
+      want += float64(input[n]) * math.Cos(math.Pi/HCA_SAMPLES_PER_SUBFRAME*(float64(n)+0.5)*(float64(k)+0.5))
+    }
+    want *= math.Sqrt(2.0 / HCA_SAMPLES_PER_SUBFRAME)
+    if math.Abs(want-float64(output[k])) > 1e-4 {
+      t.Fatalf("coefficient %d is %v, want %v", k, output[k], want)
+    }
+  }
+}
+
+// TestImdctReconstruction analyses a signal with the transpose of the
+// synthesis and checks that the overlapped subframes give it back.
+func TestImdctReconstruction(t *testing.T) {
+  const size = HCA_SAMPLES_PER_SUBFRAME
+  var basis [size][2 * size]float64
+  for k := range basis {
+    var ch hcaChannel
+    ch.spectra[0][k] = 1
+    ch.imdct(0)
+    ch.imdct(1)
+    for i := range size {
+      basis[k][i] = float64(ch.wave[0][i])
+      basis[k][size+i] = float64(ch.wave[1][i])
+    }
+  }
+  signal := make([]float64, size*10)
+  for i := range signal {
+    signal[i] = 0.5*math.Sin(float64(i)*0.05) + 0.2*math.Cos(float64(i)*0.31)
+  }
+  var ch hcaChannel
+  output := make([]float64, len(signal))
+  // subframe f overlaps the samples of f-1 and f
+  for f := range 9 {
+    for k := range size {
+      sum := 0.0
+      for n := range 2 * size {
+        if p := (f-1)*size + n; p >= 0 && p < len(signal) {
+          sum += signal[p] * basis[k][n]
+        }
+      }
+      ch.spectra[0][k] = float32(sum)
+    }
+    ch.imdct(0)
+    for i := range size {
+      if p := (f-1)*size + i; p >= 0 {
+        output[p] = float64(ch.wave[0][i])
+      }
+    }
+  }
+  for i := size; i < 8*size; i++ {
+    if math.Abs(output[i]-signal[i]) > 1e-3 {
+      t.Fatalf("sample %d is %v, want %v", i, output[i], signal[i])
+    }
+  }
+}
+
+func TestHcaCipherTable(t *testing.T) {
+  static, ok := hcaCipherTable(HCA_CIPHER_STATIC, 0, 0)
+  if !ok {
+    t.Fatal("static cipher is not supported")
+  }
+  // first values of the static table of clHCA
+  for i, want := range []byte{0x00, 0x0B, 0x9A, 0xDD} {
+    if static[i] != want {
+      t.Errorf("static table[%d] is %#x, want %#x", i, static[i], want)
+    }
+  }
+  for _, c := range []struct {
+    cipherType int
+    key        uint64
+    subkey     uint16
+  }{
+    {HCA_CIPHER_NONE, 0, 0},
+    {HCA_CIPHER_STATIC, 0, 0},
+    {HCA_CIPHER_KEYCODE, 0x0030D9E8, 0},
+    {HCA_CIPHER_KEYCODE, 0xCF222F1FE0748978, 0x1234},
+  } {
+    table, ok := hcaCipherTable(c.cipherType, c.key, c.subkey)
+    if !ok {
+      t.Fatalf("cipher type %d is not supported", c.cipherType)
+    }
+    if table[0] != 0 || table[0xFF] != 0xFF {
+      t.Errorf("cipher %+v does not keep 0x00 and 0xFF", c)
+    }
+    seen := map[byte]bool{}
+    for _, v := range table {
+      seen[v] = true
+    }
+    if len(seen) != 256 {
+      t.Errorf("cipher %+v is not a permutation", c)
+    }
+  }
+  if _, ok := hcaCipherTable(2, 0, 0); ok {
+    t.Error("cipher type 2 is supported")
+  }
+}
+
+type hcaBitWriter struct {
+  data []byte
+  pos  int
+}
+
+func (w *hcaBitWriter) write(v int, n int) {
+  for i := n - 1; i >= 0; i-- {
+    if v>>i&1 != 0 {
+      w.data[w.pos>>3] |= 0x80 >> (w.pos & 7)
+    }
+    w.pos++
+  }
+}
+
+// encodeTestHca encodes a mono stream whose bands all have the highest
+// resolution, keyed when key is not 0, and returns the samples it decodes to
+// as computed by the transform alone.
+func encodeTestHca(blocks int, key uint64, subkey uint16) ([]byte, []float32) {
+  const blockSize = 0x700
+  const bands = HCA_SAMPLES_PER_SUBFRAME
+  const scalefactor = 40
+  header := &bytes.Buffer{}
+  header.WriteString(HCA_SIGNATURE)
+  binary.Write(header, binary.BigEndian, uint16(HCA_VERSION_200))
+  binary.Write(header, binary.BigEndian, uint16(0x60))
+  header.WriteString("fmt\x00")
+  binary.Write(header, binary.BigEndian, uint32(1<<24|44100))
+  binary.Write(header, binary.BigEndian, uint32(blocks))
+  binary.Write(header, binary.BigEndian, uint32(0))
+  header.WriteString("comp")
+  binary.Write(header, binary.BigEndian, uint16(blockSize))
+  header.Write([]byte{1, 15, 1, 0, bands, bands, 0, 0, 0, 0})
+  cipherType := HCA_CIPHER_NONE
+  if key != 0 {
+    cipherType = HCA_CIPHER_KEYCODE
+  }
+  header.WriteString("ciph")
+  binary.Write(header, binary.BigEndian, uint16(cipherType))
+  header.WriteString("pad\x00")
+  for header.Len() < 0x60 {
+    header.WriteByte(0)
+  }
+  table, _ := hcaCipherTable(cipherType, key, subkey)
+  var encipher [256]byte
+  for i, v := range table {
+    encipher[v] = byte(i)
+  }
+
+  step := float64(hcaScalingTable[scalefactor] * hcaStepSizeTable[15])
+  var reference hcaChannel
+  var samples []float32
+  data := append([]byte{}, header.Bytes()...)
+  for block := range blocks {
+    w := &hcaBitWriter{data: make([]byte, blockSize)}
+    w.write(HCA_SYNC, 16)
+    // noise level and boundary of 0 give every band resolution 15
+    w.write(0, 9)
+    w.write(0, 7)
+    w.write(6, 3)
+    for range bands {
+      w.write(scalefactor, 6)
+    }
+    for subframe := range HCA_SUBFRAMES {
+      for band := range bands {
+        value := 0
+        switch {
+        case band == 5+block || band == 20:
+          value = 300 - 40*subframe
+        case band == 60:
+          value = -(100 + 10*block)
+        }
+        reference.spectra[0][band] = float32(float64(value) * step)
+        switch {
+        case value == 0:
+          w.write(0, 11)
+        case value > 0:
+          w.write(value<<1, 12)
+        default:
+          w.write(-value<<1|1, 12)
+        }
+      }
+      reference.imdct(0)
+      samples = append(samples, reference.wave[0][:]...)
+    }
+    for i, v := range w.data {
+      w.data[i] = encipher[v]
+    }
+    binary.BigEndian.PutUint16(w.data[blockSize-2:], hcaChecksum(w.data[:blockSize-2]))
+    data = append(data, w.data...)
+  }
+  return data, samples
+}
+
+func TestDecodeHca(t *testing.T) {
+  const key = 0xCF222F1FE0748978
+  const subkey = 0x5A5A
+  const blocks = 4
+  data, want := encodeTestHca(blocks, key, subkey)
+  h, samples, err := DecodeHca(data, key, subkey)
+  if err != nil {
+    t.Fatal(err)
+  }
+  if h.Channels != 1 || h.SampleRate != 44100 || h.CipherType != HCA_CIPHER_KEYCODE {
+    t.Fatalf("unexpected header %+v", h)
+  }
+  if len(samples) != blocks*HCA_BLOCK_SAMPLES {
+    t.Fatalf("decoded %d samples, want %d", len(samples), blocks*HCA_BLOCK_SAMPLES)
+  }
+  silent := true
+  for i, sample := range samples {
+    expected := int(min(max(want[i]*32768, -32768), 32767))
+    if d := int(sample) - expected; d > 1 || d < -1 {
+      t.Fatalf("sample %d is %d, want %d", i, sample, expected)
+    }
+    silent = silent && sample == 0
+  }
+  if silent {
+    t.Fatal("decoded silence")
+  }
+
+  if _, _, err := DecodeHca(data, 0, subkey); !errors.Is(err, ErrHcaKeyRequired) {
+    t.Errorf("decoding without a key gave %v, want ErrHcaKeyRequired", err)
+  }
+  // a wrong key may still unpack, but never to the same samples
+  for _, wrong := range [][2]uint64{{key + 1, subkey}, {key, 0}} {
+    _, other, err := DecodeHca(data, wrong[0], uint16(wrong[1]))
+    if err == nil && slices.Equal(other, samples) {
+      t.Errorf("decoding with key %#x and subkey %#x gave the same samples", wrong[0], wrong[1])
+    }
+  }
+
+  plain, _ := encodeTestHca(1, 0, 0)
+  var wav bytes.Buffer
+  if err := HcaToWav(&wav, plain, 0, 0); err != nil {
+    t.Fatal(err)
+  }
+  if wav.Len() != 44+HCA_BLOCK_SAMPLES*2 || string(wav.Bytes()[:4]) != "RIFF" {
+    t.Errorf("WAV of %d bytes is malformed", wav.Len())
+  }
+}
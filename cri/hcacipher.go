@@ -0,0 +1,89 @@
+package cri
+
+// Cipher types of the ciph chunk.
+const (
+  HCA_CIPHER_NONE    = 0
+  HCA_CIPHER_STATIC  = 1
+  HCA_CIPHER_KEYCODE = 56
+)
+
+// hcaCipherTable builds the byte substitution table deciphering the blocks of
+// a stream, see NewHcaDecoder for keyed streams without a key.
+func hcaCipherTable(cipherType int, key uint64, subkey uint16) ([256]byte, bool) {
+  var table [256]byte
+  switch cipherType {
+  case HCA_CIPHER_NONE:
+    for i := range table {
+      table[i] = byte(i)
+    }
+  case HCA_CIPHER_STATIC:
+    v := 0
+    for i := 1; i < 0xFF; i++ {
+      v = (v*13 + 11) & 0xFF
+      if v == 0 || v == 0xFF {
+        v = (v*13 + 11) & 0xFF
+      }
+      table[i] = byte(v)
+    }
+    table[0xFF] = 0xFF
+  case HCA_CIPHER_KEYCODE:
+    if subkey != 0 {
+      key *= uint64(subkey)<<16 | uint64(uint16(^subkey+2))
+    }
+    table = hcaKeyTable(key)
+  default:
+    return table, false
+  }
+  return table, true
+}
+
+// hcaKeyTable builds the table of cipher type 56 from the 56 bits of a key.
+func hcaKeyTable(key uint64) [256]byte {
+  if key != 0 {
+    key--
+  }
+  var kc [7]byte
+  for i := range kc {
+    kc[i] = byte(key)
+    key >>= 8
+  }
+  seed := [16]byte{
+    kc[1], kc[1] ^ kc[6], kc[2] ^ kc[3], kc[2],
+    kc[2] ^ kc[1], kc[3] ^ kc[4], kc[3], kc[3] ^ kc[2],
+    kc[4] ^ kc[5], kc[4], kc[4] ^ kc[3], kc[5] ^ kc[6],
+    kc[5], kc[5] ^ kc[4], kc[6] ^ kc[1], kc[6],
+  }
+  var base [256]byte
+  rows := hcaNibbleTable(kc[0])
+  for r := range 16 {
+    columns := hcaNibbleTable(seed[r])
+    for c := range 16 {
+      base[r*16+c] = rows[r]<<4 | columns[c]
+    }
+  }
+
+  var table [256]byte
+  x, pos := 0, 1
+  for range 256 {
+    x = (x + 17) & 0xFF
+    if base[x] != 0 && base[x] != 0xFF {
+      table[pos] = base[x]
+      pos++
+    }
+  }
+  table[0xFF] = 0xFF
+  return table
+}
+
+// hcaNibbleTable is a sequence of 16 nibbles seeded by a key byte.
+func hcaNibbleTable(key byte) [16]byte {
+  mul := int(key&1)<<3 | 5
+  add := int(key&0xE) | 1
+  v := int(key >> 4)
+  var table [16]byte
+  for i := range table {
+    v = (v*mul + add) & 0xF
+    table[i] = byte(v)
+  }
+  return table
+}
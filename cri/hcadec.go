@@ -0,0 +1,653 @@
+package cri
+
+import (
+  "errors"
+  "fmt"
+  "math"
+  "math/cmplx"
+)
+
+const (
+  HCA_SUBFRAMES            = 8
+  HCA_SAMPLES_PER_SUBFRAME = 128
+  HCA_SYNC                 = 0xFFFF
+)
+
+// Channel types, the secondary channel of a stereo pair only codes its base
+// bands and takes the rest from the primary one.
+const (
+  hcaDiscrete = iota
+  hcaStereoPrimary
+  hcaStereoSecondary
+)
+
+var errHcaUnpack = errors.New("HCA block has invalid data, the key may be wrong")
+
+// ErrHcaKeyRequired is returned for keyed streams decoded without a key,
+// which would only give noise.
+var ErrHcaKeyRequired = errors.New("HCA is keyed and no key was given")
+
+var (
+  // hcaInvertTable maps the noise level over a band to its resolution
+  hcaInvertTable = [66]uint8{
+    14, 14, 14, 14, 14, 14, 13, 13, 13, 13, 13, 13, 12, 12, 12, 12,
+    12, 12, 11, 11, 11, 11, 11, 11, 10, 10, 10, 10, 10, 10, 10, 9,
+    9, 9, 9, 9, 9, 8, 8, 8, 8, 8, 8, 7, 6, 6, 5, 4,
+    4, 4, 3, 3, 3, 2, 2, 2, 2, 1, 1, 1, 1, 1, 1, 1,
+    1, 1,
+  }
+  // bits read for a coefficient of each resolution
+  hcaMaxBitSize = [16]int{0, 2, 3, 3, 4, 4, 4, 4, 5, 6, 7, 8, 9, 10, 11, 12}
+  // prefix codes of the resolutions up to 7, by resolution and code read
+  hcaReadBitSize = [8 * 16]int{
+    0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0,
+    1, 1, 2, 2, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0,
+    2, 2, 2, 2, 2, 2, 3, 3, 0, 0, 0, 0, 0, 0, 0, 0,
+    2, 2, 3, 3, 3, 3, 3, 3, 0, 0, 0, 0, 0, 0, 0, 0,
+    3, 3, 3, 3, 3, 3, 3, 3, 3, 3, 3, 3, 3, 3, 4, 4,
+    3, 3, 3, 3, 3, 3, 3, 3, 3, 3, 4, 4, 4, 4, 4, 4,
+    3, 3, 3, 3, 3, 3, 4, 4, 4, 4, 4, 4, 4, 4, 4, 4,
+    3, 3, 3, 3, 4, 4, 4, 4, 4, 4, 4, 4, 4, 4, 4, 4,
+  }
+  hcaReadValue = [8 * 16]float32{
+    0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0,
+    0, 0, 1, -1, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0,
+    0, 0, 1, 1, -1, -1, 2, -2, 0, 0, 0, 0, 0, 0, 0, 0,
+    0, 0, 1, -1, 2, -2, 3, -3, 0, 0, 0, 0, 0, 0, 0, 0,
+    0, 0, 1, 1, -1, -1, 2, 2, -2, -2, 3, 3, -3, -3, 4, -4,
+    0, 0, 1, 1, -1, -1, 2, 2, -2, -2, 3, -3, 4, -4, 5, -5,
+    0, 0, 1, 1, -1, -1, 2, -2, 3, -3, 4, -4, 5, -5, 6, -6,
+    0, 0, 1, -1, 2, -2, 3, -3, 4, -4, 5, -5, 6, -6, 7, -7,
+  }
+  hcaScalingTable     [64]float32
+  hcaStepSizeTable    [16]float32
+  hcaConversionTable  [128]float32
+  hcaIntensityTable   [16]float32
+  hcaWindow           [HCA_SAMPLES_PER_SUBFRAME]float32
+  hcaPreTwiddle       [HCA_SAMPLES_PER_SUBFRAME / 2]complex128
+  hcaPostTwiddle      [HCA_SAMPLES_PER_SUBFRAME / 2]complex128
+  hcaFftTwiddle       [HCA_SAMPLES_PER_SUBFRAME / 4]complex128
+  hcaCrcTable         [256]uint16
+)
+
+func init() {
+  // scale factors step by 2^(53/128)
+  for i := range hcaScalingTable {
+    hcaScalingTable[i] = float32(math.Sqrt(128) * math.Pow(2, float64(i-63)*53/128))
+  }
+  for i := 1; i < len(hcaConversionTable); i++ {
+    hcaConversionTable[i] = float32(math.Pow(2, float64(i-63)*53/128))
+  }
+  // quantizer steps of resolutions coding up to 7 levels, then 2^(r-3)-1
+  for r := 1; r < len(hcaStepSizeTable); r++ {
+    levels := 2*r + 1
+    if r > 7 {
+      levels = 1<<(r-3) - 1
+    }
+    hcaStepSizeTable[r] = float32(2 / float64(levels))
+  }
+  for i := range 15 {
+    hcaIntensityTable[i] = float32(14-i) / 7
+  }
+  for i := range hcaWindow {
+    a := ((float64(i)+0.5)/HCA_SAMPLES_PER_SUBFRAME - 0.5) * 10
+    hcaWindow[i] = float32(math.Sqrt(0.5 * (math.Tanh(a) + 1)))
+  }
+  n := float64(HCA_SAMPLES_PER_SUBFRAME)
+  for i := range hcaPreTwiddle {
+    hcaPreTwiddle[i] = cmplx.Exp(complex(0, -math.Pi*float64(i)/n))
+    hcaPostTwiddle[i] = cmplx.Exp(complex(0, -math.Pi*(float64(i)+0.25)/n))
+  }
+  for i := range hcaFftTwiddle {
+    hcaFftTwiddle[i] = cmplx.Exp(complex(0, -2*math.Pi*float64(i)/(n/2)))
+  }
+  for i := range hcaCrcTable {
+    crc := uint16(i) << 8
+    for range 8 {
+      if crc&0x8000 != 0 {
+        crc = crc<<1 ^ 0x8005
+      } else {
+        crc <<= 1
+      }
+    }
+    hcaCrcTable[i] = crc
+  }
+}
+
+// hcaChecksum is the CRC-16 of a block, 0 when it ends with its valid CRC.
+func hcaChecksum(data []byte) uint16 {
+  crc := uint16(0)
+  for _, b := range data {
+    crc = crc<<8 ^ hcaCrcTable[byte(crc>>8)^b]
+  }
+  return crc
+}
+
+// hcaBits reads the bits of a block from the most significant one. Bits past
+// the end read as 0.
+type hcaBits struct {
+  data []byte
+  pos  int
+}
+
+func (b *hcaBits) peek(n int) int {
+  if n == 0 || b.pos+n > len(b.data)*8 {
+    return 0
+  }
+  index := b.pos >> 3
+  v := uint32(0)
+  for i := range 4 {
+    v <<= 8
+    if index+i < len(b.data) {
+      v |= uint32(b.data[index+i])
+    }
+  }
+  v <<= b.pos & 7
+  return int(v >> (32 - n))
+}
+
+func (b *hcaBits) read(n int) int {
+  v := b.peek(n)
+  b.pos += n
+  return v
+}
+
+// skip moves by n bits, backwards when n is negative.
+func (b *hcaBits) skip(n int) {
+  b.pos += n
+}
+
+type hcaChannel struct {
+  kind         int
+  codedCount   int
+  intensity    [HCA_SUBFRAMES]uint8
+  scalefactors [HCA_SAMPLES_PER_SUBFRAME]uint8
+  hfrScales    [HCA_SAMPLES_PER_SUBFRAME]uint8
+  resolution   [HCA_SAMPLES_PER_SUBFRAME]uint8
+  // bands of resolution 0 from the start, coded bands from the end
+  noises     [HCA_SAMPLES_PER_SUBFRAME]uint8
+  noiseCount int
+  validCount int
+  gain       [HCA_SAMPLES_PER_SUBFRAME]float32
+  spectra    [HCA_SUBFRAMES][HCA_SAMPLES_PER_SUBFRAME]float32
+  wave       [HCA_SUBFRAMES][HCA_SAMPLES_PER_SUBFRAME]float32
+  previous   [HCA_SAMPLES_PER_SUBFRAME]float32
+}
+
+// HcaDecoder decodes the blocks of an HCA stream one after the other.
+type HcaDecoder struct {
+  Header        *HcaHeader
+  cipher        [256]byte
+  channels      []hcaChannel
+  hfrGroupCount int
+  random        uint32
+  block         []byte
+}
+
+// NewHcaDecoder reads the header of the HCA stream at the start of data and
+// prepares its cipher with key and the subkey of its AWB, both 0 when the
+// stream is not keyed.
+func NewHcaDecoder(data []byte, key uint64, subkey uint16) (*HcaDecoder, error) {
+  h, err := ParseHcaHeader(data)
+  if err != nil {
+    return nil, err
+  }
+  switch {
+  case h.Version >= 0x0400 || h.Version < 0x0100:
+    return nil, fmt.Errorf("HCA version %#x is not supported", h.Version)
+  case h.AthType != 0:
+    return nil, fmt.Errorf("HCA with the ATH curve of version %#x is not supported", h.Version)
+  case h.BlockSize < 8:
+    return nil, fmt.Errorf("HCA block size %d is invalid", h.BlockSize)
+  case h.TotalBandCount > HCA_SAMPLES_PER_SUBFRAME || h.BaseBandCount+h.StereoBandCount > h.TotalBandCount:
+    return nil, fmt.Errorf("HCA band counts %d/%d/%d are invalid", h.BaseBandCount, h.StereoBandCount, h.TotalBandCount)
+  case h.MinResolution > h.MaxResolution || h.MaxResolution > 15:
+    return nil, fmt.Errorf("HCA resolutions %d-%d are invalid", h.MinResolution, h.MaxResolution)
+  case h.Channels > 16 || h.Channels%h.TrackCount != 0:
+    return nil, fmt.Errorf("HCA with %d channels in %d tracks is not supported", h.Channels, h.TrackCount)
+  }
+  if h.CipherType == HCA_CIPHER_KEYCODE && key == 0 {
+    return nil, ErrHcaKeyRequired
+  }
+  d := &HcaDecoder{Header: h, channels: make([]hcaChannel, h.Channels)}
+  var ok bool
+  if d.cipher, ok = hcaCipherTable(h.CipherType, key, subkey); !ok {
+    return nil, fmt.Errorf("HCA cipher type %d is not supported", h.CipherType)
+  }
+  if h.BandsPerHfrGroup > 0 {
+    bands := h.TotalBandCount - h.BaseBandCount - h.StereoBandCount
+    d.hfrGroupCount = (bands + h.BandsPerHfrGroup - 1) / h.BandsPerHfrGroup
+  }
+
+  kinds := make([]int, h.Channels)
+  perTrack := h.Channels / h.TrackCount
+  if h.StereoBandCount > 0 && perTrack > 1 && perTrack <= 8 {
+    p, s, x := hcaStereoPrimary, hcaStereoSecondary, hcaDiscrete
+    var layout []int
+    switch perTrack {
+    case 2:
+      layout = []int{p, s}
+    case 3:
+      layout = []int{p, s, x}
+    case 4:
+      layout = []int{p, s, x, x}
+      if h.ChannelConfig == 0 {
+        layout = []int{p, s, p, s}
+      }
+    case 5:
+      layout = []int{p, s, x, x, x}
+      if h.ChannelConfig <= 2 {
+        layout = []int{p, s, x, p, s}
+      }
+    case 6:
+      layout = []int{p, s, x, x, p, s}
+    case 7:
+      layout = []int{p, s, x, x, p, s, x}
+    case 8:
+      layout = []int{p, s, x, x, p, s, p, s}
+    }
+    for i := range kinds {
+      kinds[i] = layout[i%perTrack]
+    }
+  }
+  for i := range d.channels {
+    d.channels[i].kind = kinds[i]
+    d.channels[i].codedCount = h.BaseBandCount
+    if kinds[i] != hcaStereoSecondary {
+      d.channels[i].codedCount += h.StereoBandCount
+    }
+  }
+  return d, nil
+}
+
+// DecodeBlock decodes the next block into the samples of its 8 subframes per
+// channel, see Samples.
+func (d *HcaDecoder) DecodeBlock(data []byte) error {
+  h := d.Header
+  if len(data) < h.BlockSize {
+    return fmt.Errorf("HCA block of %d bytes is truncated to %d", h.BlockSize, len(data))
+  }
+  data = data[:h.BlockSize]
+  if hcaChecksum(data) != 0 {
+    return fmt.Errorf("HCA block checksum mismatch")
+  }
+  d.block = append(d.block[:0], data...)
+  for i, b := range d.block {
+    d.block[i] = d.cipher[b]
+  }
+  br := &hcaBits{data: d.block}
+  if br.read(16) != HCA_SYNC {
+    return fmt.Errorf("HCA block has no sync")
+  }
+  noiseLevel := br.read(9)
+  boundary := br.read(7)
+  packedNoiseLevel := noiseLevel<<8 - boundary
+  d.random = 1
+
+  for i := range d.channels {
+    ch := &d.channels[i]
+    if err := d.unpackScalefactors(ch, br); err != nil {
+      return err
+    }
+    if err := d.unpackIntensity(ch, br); err != nil {
+      return err
+    }
+    d.calculateResolution(ch, packedNoiseLevel)
+    for band := range ch.codedCount {
+      ch.gain[band] = hcaScalingTable[ch.scalefactors[band]] * hcaStepSizeTable[ch.resolution[band]]
+    }
+  }
+
+  for subframe := range HCA_SUBFRAMES {
+    for i := range d.channels {
+      d.dequantize(&d.channels[i], br, subframe)
+    }
+    for i := range d.channels {
+      d.reconstructNoise(&d.channels[i], subframe)
+      d.reconstructHighFrequency(&d.channels[i], subframe)
+    }
+    if h.StereoBandCount > 0 {
+      for i := 0; i+1 < len(d.channels); i++ {
+        d.applyStereo(&d.channels[i], &d.channels[i+1], subframe)
+      }
+    }
+    for i := range d.channels {
+      d.channels[i].imdct(subframe)
+    }
+  }
+  return nil
+}
+
+// Samples are the samples of a channel decoded by the last block, in order
+// of subframes.
+func (d *HcaDecoder) Samples(channel int) *[HCA_SUBFRAMES][HCA_SAMPLES_PER_SUBFRAME]float32 {
+  return &d.channels[channel].wave
+}
+
+func (d *HcaDecoder) unpackScalefactors(ch *hcaChannel, br *hcaBits) error {
+  count := ch.codedCount
+  extra := 0
+  // from 3.0 the scales of the high frequency groups follow the others
+  if ch.kind != hcaStereoSecondary && d.hfrGroupCount > 0 && d.Header.Version >= HCA_VERSION_300 {
+    extra = d.hfrGroupCount
+    count += extra
+    if count > HCA_SAMPLES_PER_SUBFRAME {
+      return errHcaUnpack
+    }
+  }
+
+  deltaBits := br.read(3)
+  switch {
+  case deltaBits >= 6:
+    for i := range count {
+      ch.scalefactors[i] = uint8(br.read(6))
+    }
+  case deltaBits > 0:
+    expected := 1<<deltaBits - 1
+    value := br.read(6)
+    ch.scalefactors[0] = uint8(value)
+    for i := 1; i < count; i++ {
+      delta := br.read(deltaBits)
+      if delta == expected {
+        value = br.read(6)
+      } else {
+        value += delta - expected>>1
+        if value < 0 || value >= 64 {
+          return errHcaUnpack
+        }
+      }
+      ch.scalefactors[i] = uint8(value)
+    }
+  default:
+    clear(ch.scalefactors[:])
+  }
+  for i := range extra {
+    ch.hfrScales[i] = ch.scalefactors[ch.codedCount+i]
+  }
+  return nil
+}
+
+func (d *HcaDecoder) unpackIntensity(ch *hcaChannel, br *hcaBits) error {
+  if ch.kind != hcaStereoSecondary {
+    // before 3.0 the scales of the high frequency groups come here
+    if d.Header.Version < HCA_VERSION_300 {
+      for i := range d.hfrGroupCount {
+        ch.hfrScales[i] = uint8(br.read(6))
+      }
+    }
+    return nil
+  }
+
+  value := br.peek(4)
+  if d.Header.Version < HCA_VERSION_300 {
+    ch.intensity[0] = uint8(value)
+    if value < 15 {
+      br.skip(4)
+      for i := 1; i < HCA_SUBFRAMES; i++ {
+        ch.intensity[i] = uint8(br.read(4))
+      }
+    }
+    return nil
+  }
+
+  br.skip(4)
+  if value >= 15 {
+    for i := range ch.intensity {
+      ch.intensity[i] = 7
+    }
+    return nil
+  }
+  deltaBits := br.read(2)
+  ch.intensity[0] = uint8(value)
+  if deltaBits == 3 {
+    for i := 1; i < HCA_SUBFRAMES; i++ {
+      ch.intensity[i] = uint8(br.read(4))
+    }
+    return nil
+  }
+  bmax := 2<<deltaBits - 1
+  for i := 1; i < HCA_SUBFRAMES; i++ {
+    delta := br.read(deltaBits + 1)
+    if delta == bmax {
+      value = br.read(4)
+    } else {
+      value += delta - bmax>>1
+      if value < 0 || value > 15 {
+        return errHcaUnpack
+      }
+    }
+    ch.intensity[i] = uint8(value)
+  }
+  return nil
+}
+
+func (d *HcaDecoder) calculateResolution(ch *hcaChannel, packedNoiseLevel int) {
+  h := d.Header
+  ch.noiseCount = 0
+  ch.validCount = 0
+  for i := range ch.codedCount {
+    resolution := 0
+    if scalefactor := int(ch.scalefactors[i]); scalefactor > 0 {
+      // the curve of the absolute threshold of hearing is flat from 2.0
+      noiseLevel := (packedNoiseLevel + i) >> 8
+      position := noiseLevel + 1 - (5*scalefactor)>>1
+      switch {
+      case position < 0:
+        resolution = 15
+      case position < len(hcaInvertTable):
+        resolution = int(hcaInvertTable[position])
+      }
+      resolution = min(max(resolution, h.MinResolution), h.MaxResolution)
+      if resolution < 1 {
+        ch.noises[ch.noiseCount] = uint8(i)
+        ch.noiseCount++
+      } else {
+        ch.noises[HCA_SAMPLES_PER_SUBFRAME-1-ch.validCount] = uint8(i)
+        ch.validCount++
+      }
+    }
+    ch.resolution[i] = uint8(resolution)
+  }
+  clear(ch.resolution[ch.codedCount:])
+}
+
+func (d *HcaDecoder) dequantize(ch *hcaChannel, br *hcaBits, subframe int) {
+  spectra := &ch.spectra[subframe]
+  for i := range ch.codedCount {
+    resolution := int(ch.resolution[i])
+    bits := hcaMaxBitSize[resolution]
+    code := br.read(bits)
+    var coefficient float32
+    if resolution > 7 {
+      // sign and magnitude with the sign in the lowest bit, 0 has no sign
+      value := code >> 1
+      if code&1 != 0 {
+        value = -value
+      }
+      if value == 0 {
+        br.skip(-1)
+      }
+      coefficient = float32(value)
+    } else {
+      index := resolution<<4 + code
+      br.skip(hcaReadBitSize[index] - bits)
+      coefficient = hcaReadValue[index]
+    }
+    spectra[i] = ch.gain[i] * coefficient
+  }
+  clear(spectra[ch.codedCount:])
+}
+
+// reconstructNoise fills the bands of resolution 0 of 3.0 streams with
+// random coded bands.
+func (d *HcaDecoder) reconstructNoise(ch *hcaChannel, subframe int) {
+  h := d.Header
+  if h.MinResolution > 0 || ch.validCount <= 0 || ch.noiseCount <= 0 {
+    return
+  }
+  if h.MsStereo && ch.kind != hcaStereoPrimary {
+    return
+  }
+  spectra := &ch.spectra[subframe]
+  for i := range ch.noiseCount {
+    d.random = 0x343FD*d.random + 0x269EC3
+    random := HCA_SAMPLES_PER_SUBFRAME - ch.validCount + int((d.random&0x7FFF)*uint32(ch.validCount)>>15)
+    noise := ch.noises[i]
+    valid := ch.noises[random]
+    index := max(int(ch.scalefactors[noise])-int(ch.scalefactors[valid])+62, 0)
+    spectra[noise] = hcaConversionTable[index] * spectra[valid]
+  }
+}
+
+// reconstructHighFrequency copies lower bands, scaled, over the bands past
+// the coded ones.
+func (d *HcaDecoder) reconstructHighFrequency(ch *hcaChannel, subframe int) {
+  h := d.Header
+  if ch.kind == hcaStereoSecondary || h.BandsPerHfrGroup <= 0 {
+    return
+  }
+  start := h.BaseBandCount + h.StereoBandCount
+  high, low := start, start-1
+  // from 3.0 the source bands stop moving down halfway through the groups
+  limit := d.hfrGroupCount
+  if h.Version >= HCA_VERSION_300 {
+    limit >>= 1
+  }
+  spectra := &ch.spectra[subframe]
+  for group := range d.hfrGroupCount {
+    step := 0
+    if group < limit {
+      step = 1
+    }
+    for range h.BandsPerHfrGroup {
+      if high >= h.TotalBandCount || low < 0 {
+        break
+      }
+      index := int(ch.hfrScales[group]) - int(ch.scalefactors[low]) + 63
+      index = min(max(index, 0), 127)
+      spectra[high] = hcaConversionTable[index] * spectra[low]
+      high++
+      low -= step
+    }
+  }
+  spectra[high-1] = 0
+}
+
+// applyStereo rebuilds the stereo bands of a pair from its primary channel.
+func (d *HcaDecoder) applyStereo(primary *hcaChannel, secondary *hcaChannel, subframe int) {
+  h := d.Header
+  if primary.kind != hcaStereoPrimary {
+    return
+  }
+  left := &primary.spectra[subframe]
+  right := &secondary.spectra[subframe]
+  ratioLeft := hcaIntensityTable[secondary.intensity[subframe]]
+  ratioRight := 2 - ratioLeft
+  for band := h.BaseBandCount; band < h.TotalBandCount; band++ {
+    right[band] = left[band] * ratioRight
+    left[band] = left[band] * ratioLeft
+  }
+  if !h.MsStereo {
+    return
+  }
+  const ratio = float32(math.Sqrt2 / 2)
+  for band := h.BaseBandCount; band < h.TotalBandCount; band++ {
+    l, r := left[band], right[band]
+    left[band] = (l + r) * ratio
+    right[band] = (l - r) * ratio
+  }
+}
+
+// imdct transforms the spectra of a subframe into samples, overlapped with
+// the second half of the previous subframe.
+func (ch *hcaChannel) imdct(subframe int) {
+  const size = HCA_SAMPLES_PER_SUBFRAME
+  const half = size / 2
+  var dct [size]float32
+  dct4(&ch.spectra[subframe], &dct)
+  wave := &ch.wave[subframe]
+  for i := range half {
+    wave[i] = hcaWindow[i]*dct[i+half] + ch.previous[i]
+    wave[i+half] = -hcaWindow[i+half]*dct[size-1-i] - ch.previous[i+half]
+    ch.previous[i] = -hcaWindow[size-1-i] * dct[half-1-i]
+    ch.previous[i+half] = hcaWindow[half-1-i] * dct[i]
+  }
+}
+
+// dct4 is the orthonormal DCT-IV of 128 coefficients, computed with a complex
+// FFT of half the size.
+func dct4(input *[HCA_SAMPLES_PER_SUBFRAME]float32, output *[HCA_SAMPLES_PER_SUBFRAME]float32) {
+  const size = HCA_SAMPLES_PER_SUBFRAME
+  const half = size / 2
+  var z [half]complex128
+  for i := range half {
+    z[i] = complex(float64(input[2*i]), float64(input[size-1-2*i])) * hcaPreTwiddle[i]
+  }
+  fft(&z)
+  scale := math.Sqrt(2.0 / size)
+  for k := range half {
+    y := z[k] * hcaPostTwiddle[k]
+    output[2*k] = float32(real(y) * scale)
+    output[size-1-2*k] = float32(-imag(y) * scale)
+  }
+}
+
+// fft is an in place radix-2 FFT of 64 points.
+func fft(z *[HCA_SAMPLES_PER_SUBFRAME / 2]complex128) {
+  n := len(z)
+  for i, j := 1, 0; i < n; i++ {
+    bit := n >> 1
+    for ; j&bit != 0; bit >>= 1 {
+      j ^= bit
+    }
+    j ^= bit
+    if i < j {
+      z[i], z[j] = z[j], z[i]
+    }
+  }
+  for length := 2; length <= n; length <<= 1 {
+    step := n / length
+    for start := 0; start < n; start += length {
+      for k := range length / 2 {
+        w := hcaFftTwiddle[k*step]
+        a, b := z[start+k], z[start+k+length/2]*w
+        z[start+k] = a + b
+        z[start+k+length/2] = a - b
+      }
+    }
+  }
+}
+
+// DecodeHca decodes a whole HCA stream into interleaved 16-bit samples, with
+// the encoder delay and padding cut.
+func DecodeHca(data []byte, key uint64, subkey uint16) (*HcaHeader, []int16, error) {
+  d, err := NewHcaDecoder(data, key, subkey)
+  if err != nil {
+    return nil, nil, err
+  }
+  h := d.Header
+  channels := h.Channels
+  total := h.BlockCount * HCA_BLOCK_SAMPLES
+  samples := make([]int16, 0, h.Samples()*channels)
+  volume := h.Volume * 32768
+  for block := range h.BlockCount {
+    start := h.HeaderSize + block*h.BlockSize
+    if start+h.BlockSize > len(data) {
+      return nil, nil, fmt.Errorf("HCA block %d of %d lies outside of the stream", block, h.BlockCount)
+    }
+    if err := d.DecodeBlock(data[start : start+h.BlockSize]); err != nil {
+      return nil, nil, fmt.Errorf("HCA block %d: %w", block, err)
+    }
+    for i := range HCA_BLOCK_SAMPLES {
+      position := block*HCA_BLOCK_SAMPLES + i
+      if position < h.EncoderDelay || position >= total-h.EncoderPadding {
+        continue
+      }
+      for c := range channels {
+        v := d.channels[c].wave[i/HCA_SAMPLES_PER_SUBFRAME][i%HCA_SAMPLES_PER_SUBFRAME] * volume
+        samples = append(samples, int16(min(max(v, -32768), 32767)))
+      }
+    }
+  }
+  return h, samples, nil
+}
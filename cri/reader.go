@@ -0,0 +1,106 @@
+package cri
+
+import (
+  "bytes"
+  "encoding/binary"
+  "errors"
+  "fmt"
+  "math"
+)
+
+var errTruncated = errors.New("unexpected end of data")
+
+// reader reads from a byte slice. The first error sticks: every later read
+// returns zero values, so that a parse is checked once at the end.
+type reader struct {
+  buf   []byte
+  pos   int
+  order binary.ByteOrder
+  err   error
+}
+
+func newReader(buf []byte, order binary.ByteOrder) *reader {
+  return &reader{buf: buf, order: order}
+}
+
+func (r *reader) fail(err error) {
+  if r.err == nil {
+    r.err = err
+  }
+}
+
+func (r *reader) bytes(n int) []byte {
+  if r.err != nil {
+    return nil
+  }
+  if n < 0 || r.pos+n > len(r.buf) {
+    r.fail(fmt.Errorf("%w: %d bytes at %d of %d", errTruncated, n, r.pos, len(r.buf)))
+    return nil
+  }
+  b := r.buf[r.pos : r.pos+n]
+  r.pos += n
+  return b
+}
+
+func (r *reader) skip(n int) {
+  r.bytes(n)
+}
+
+func (r *reader) seek(pos int) {
+  if pos < 0 || pos > len(r.buf) {
+    r.fail(fmt.Errorf("%w: seek to %d of %d", errTruncated, pos, len(r.buf)))
+    return
+  }
+  r.pos = pos
+}
+
+func (r *reader) u8() uint8 {
+  if b := r.bytes(1); b != nil {
+    return b[0]
+  }
+  return 0
+}
+
+func (r *reader) u16() uint16 {
+  if b := r.bytes(2); b != nil {
+    return r.order.Uint16(b)
+  }
+  return 0
+}
+
+func (r *reader) u32() uint32 {
+  if b := r.bytes(4); b != nil {
+    return r.order.Uint32(b)
+  }
+  return 0
+}
+
+func (r *reader) u64() uint64 {
+  if b := r.bytes(8); b != nil {
+    return r.order.Uint64(b)
+  }
+  return 0
+}
+
+func (r *reader) f32() float32 {
+  return math.Float32frombits(r.u32())
+}
+
+func (r *reader) f64() float64 {
+  return math.Float64frombits(r.u64())
+}
+
+// cstring reads a null-terminated string.
+func (r *reader) cstring() string {
+  if r.err != nil {
+    return ""
+  }
+  end := bytes.IndexByte(r.buf[r.pos:], 0)
+  if end < 0 {
+    r.fail(fmt.Errorf("%w: unterminated string at %d", errTruncated, r.pos))
+    return ""
+  }
+  s := string(r.buf[r.pos : r.pos+end])
+  r.pos += end + 1
+  return s
+}
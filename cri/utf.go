@@ -0,0 +1,260 @@
+package cri
+
+import (
+  "encoding/binary"
+  "fmt"
+)
+
+const UTF_SIGNATURE = "@UTF"
+
+// Column flags of an @UTF table: whether it has a name, a default value
+// stored in the schema and a value per row.
+const (
+  UTF_COLUMN_FLAG_MASK    = 0xF0
+  UTF_COLUMN_FLAG_NAME    = 0x10
+  UTF_COLUMN_FLAG_DEFAULT = 0x20
+  UTF_COLUMN_FLAG_ROW     = 0x40
+  UTF_COLUMN_TYPE_MASK    = 0x0F
+)
+
+// Column types of an @UTF table.
+const (
+  UTF_TYPE_U8     = 0x00
+  UTF_TYPE_S8     = 0x01
+  UTF_TYPE_U16    = 0x02
+  UTF_TYPE_S16    = 0x03
+  UTF_TYPE_U32    = 0x04
+  UTF_TYPE_S32    = 0x05
+  UTF_TYPE_U64    = 0x06
+  UTF_TYPE_S64    = 0x07
+  UTF_TYPE_FLOAT  = 0x08
+  UTF_TYPE_DOUBLE = 0x09
+  UTF_TYPE_STRING = 0x0A
+  UTF_TYPE_DATA   = 0x0B
+  UTF_TYPE_GUID   = 0x0C
+)
+
+// UtfTable is a decoded @UTF table, the key-value store of CRI formats. Data
+// values are slices of the buffer the table was parsed from.
+type UtfTable struct {
+  Name    string
+  Columns []UtfColumn
+  Rows    []map[string]any
+}
+
+type UtfColumn struct {
+  Name string
+  Flag uint8
+  Type uint8
+}
+
+// IsUtfTable tells whether data starts like an @UTF table.
+func IsUtfTable(data []byte) bool {
+  return len(data) >= 4 && string(data[:4]) == UTF_SIGNATURE
+}
+
+// ParseUtfTable parses the @UTF table at the start of data.
+func ParseUtfTable(data []byte) (*UtfTable, error) {
+  if !IsUtfTable(data) {
+    return nil, fmt.Errorf("not an @UTF table")
+  }
+  r := newReader(data, binary.BigEndian)
+  r.skip(4)
+  size := int(r.u32())
+  if r.err == nil && size+8 > len(data) {
+    return nil, fmt.Errorf("@UTF table of %d bytes lies outside of %d bytes", size+8, len(data))
+  }
+  // offsets are counted from the end of the size
+  r = newReader(data[8:8+size], binary.BigEndian)
+  r.u16() // version
+  rowsOffset := int(r.u16())
+  stringsOffset := int(r.u32())
+  dataOffset := int(r.u32())
+  nameOffset := int(r.u32())
+  columnCount := int(r.u16())
+  rowWidth := int(r.u16())
+  rowCount := int(r.u32())
+  if r.err != nil {
+    return nil, fmt.Errorf("@UTF header: %w", r.err)
+  }
+  if stringsOffset > len(r.buf) || dataOffset > len(r.buf) || rowsOffset > stringsOffset {
+    return nil, fmt.Errorf("@UTF table is corrupted")
+  }
+  // rows lie before the string pool. Rows without row columns take no room,
+  // their count is still bounded by the size of the table.
+  if int64(rowCount)*int64(rowWidth) > int64(stringsOffset-rowsOffset) || rowCount > len(r.buf) {
+    return nil, fmt.Errorf("@UTF table of %d rows of %d bytes is corrupted", rowCount, rowWidth)
+  }
+  strings := r.buf[stringsOffset:]
+  blob := r.buf[dataOffset:]
+  readString := func() string {
+    offset := int(r.u32())
+    if r.err != nil {
+      return ""
+    }
+    if offset >= len(strings) {
+      r.fail(fmt.Errorf("string at %d lies outside of the string table", offset))
+      return ""
+    }
+    s := newReader(strings[offset:], binary.BigEndian)
+    value := s.cstring()
+    if s.err != nil {
+      r.fail(s.err)
+    }
+    return value
+  }
+  readValue := func(kind uint8) any {
+    switch kind {
+    case UTF_TYPE_U8:
+      return r.u8()
+    case UTF_TYPE_S8:
+      return int8(r.u8())
+    case UTF_TYPE_U16:
+      return r.u16()
+    case UTF_TYPE_S16:
+      return int16(r.u16())
+    case UTF_TYPE_U32:
+      return r.u32()
+    case UTF_TYPE_S32:
+      return int32(r.u32())
+    case UTF_TYPE_U64:
+      return r.u64()
+    case UTF_TYPE_S64:
+      return int64(r.u64())
+    case UTF_TYPE_FLOAT:
+      return r.f32()
+    case UTF_TYPE_DOUBLE:
+      return r.f64()
+    case UTF_TYPE_STRING:
+      return readString()
+    case UTF_TYPE_DATA:
+      offset := int64(r.u32())
+      size := int64(r.u32())
+      if r.err != nil {
+        return []byte(nil)
+      }
+      if offset+size > int64(len(blob)) {
+        r.fail(fmt.Errorf("data at %d of %d bytes lies outside of the table", offset, size))
+        return []byte(nil)
+      }
+      return blob[offset : offset+size]
+    case UTF_TYPE_GUID:
+      return r.bytes(16)
+    }
+    r.fail(fmt.Errorf("unknown @UTF column type %#x", kind))
+    return nil
+  }
+
+  t := &UtfTable{}
+  r.seek(nameOffset + stringsOffset)
+  t.Name = r.cstring()
+  r.seek(0x18)
+  t.Columns = make([]UtfColumn, 0, columnCount)
+  defaults := map[string]any{}
+  for range columnCount {
+    info := r.u8()
+    // some tables pad a column with 4 zero bytes before its real flag
+    if info == 0 {
+      r.skip(3)
+      info = r.u8()
+    }
+    column := UtfColumn{Flag: info & UTF_COLUMN_FLAG_MASK, Type: info & UTF_COLUMN_TYPE_MASK}
+    if column.Flag&UTF_COLUMN_FLAG_NAME != 0 {
+      column.Name = readString()
+    }
+    if column.Flag&UTF_COLUMN_FLAG_DEFAULT != 0 {
+      defaults[column.Name] = readValue(column.Type)
+    }
+    t.Columns = append(t.Columns, column)
+  }
+  if r.err != nil {
+    return nil, fmt.Errorf("@UTF schema: %w", r.err)
+  }
+
+  t.Rows = make([]map[string]any, 0, rowCount)
+  for i := range rowCount {
+    r.seek(rowsOffset + i*rowWidth)
+    row := make(map[string]any, len(t.Columns))
+    for _, column := range t.Columns {
+      switch {
+      case column.Flag&UTF_COLUMN_FLAG_ROW != 0:
+        row[column.Name] = readValue(column.Type)
+      case column.Flag&UTF_COLUMN_FLAG_DEFAULT != 0:
+        row[column.Name] = defaults[column.Name]
+      }
+    }
+    if r.err != nil {
+      return nil, fmt.Errorf("@UTF table %q row %d: %w", t.Name, i, r.err)
+    }
+    t.Rows = append(t.Rows, row)
+  }
+  return t, nil
+}
+
+// Has tells whether the table has the column.
+func (t *UtfTable) Has(name string) bool {
+  for _, column := range t.Columns {
+    if column.Name == name {
+      return true
+    }
+  }
+  return false
+}
+
+// Int reads an integer column of a row, 0 when it is missing.
+func (t *UtfTable) Int(row int, name string) int64 {
+  if row < 0 || row >= len(t.Rows) {
+    return 0
+  }
+  switch v := t.Rows[row][name].(type) {
+  case uint8:
+    return int64(v)
+  case int8:
+    return int64(v)
+  case uint16:
+    return int64(v)
+  case int16:
+    return int64(v)
+  case uint32:
+    return int64(v)
+  case int32:
+    return int64(v)
+  case uint64:
+    return int64(v)
+  case int64:
+    return v
+  }
+  return 0
+}
+
+// String reads a string column of a row.
+func (t *UtfTable) String(row int, name string) string {
+  if row < 0 || row >= len(t.Rows) {
+    return ""
+  }
+  s, _ := t.Rows[row][name].(string)
+  return s
+}
+
+// Data reads a data column of a row.
+func (t *UtfTable) Data(row int, name string) []byte {
+  if row < 0 || row >= len(t.Rows) {
+    return nil
+  }
+  b, _ := t.Rows[row][name].([]byte)
+  return b
+}
+
+// Table parses a data column of a row holding a nested @UTF table, nil when
+// it is empty.
+func (t *UtfTable) Table(row int, name string) (*UtfTable, error) {
+  data := t.Data(row, name)
+  if len(data) == 0 {
+    return nil, nil
+  }
+  nested, err := ParseUtfTable(data)
+  if err != nil {
+    return nil, fmt.Errorf("%s: %w", name, err)
+  }
+  return nested, nil
+}
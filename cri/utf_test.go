@@ -0,0 +1,184 @@
+package cri
+
+import (
+  "bytes"
+  "encoding/binary"
+  "testing"
+)
+
+// utfTestColumn is a column of encodeTestUtf, with a value for every row or
+// a single default one.
+type utfTestColumn struct {
+  name     string
+  kind     uint8
+  values   []any
+  constant bool
+}
+
+// encodeTestUtf encodes an @UTF table of rows rows. Values are written with
+// binary.Write, so they must have the size of their column type.
+func encodeTestUtf(name string, rows int, columns ...utfTestColumn) []byte {
+  strs := &bytes.Buffer{}
+  blob := &bytes.Buffer{}
+  addString := func(s string) uint32 {
+    offset := strs.Len()
+    strs.WriteString(s)
+    strs.WriteByte(0)
+    return uint32(offset)
+  }
+  write := func(dst *bytes.Buffer, kind uint8, value any) {
+    switch kind {
+    case UTF_TYPE_STRING:
+      binary.Write(dst, binary.BigEndian, addString(value.(string)))
+    case UTF_TYPE_DATA:
+      data := value.([]byte)
+      binary.Write(dst, binary.BigEndian, uint32(blob.Len()))
+      binary.Write(dst, binary.BigEndian, uint32(len(data)))
+      blob.Write(data)
+    default:
+      binary.Write(dst, binary.BigEndian, value)
+    }
+  }
+  nameOffset := addString(name)
+  schema := &bytes.Buffer{}
+  for _, column := range columns {
+    flag := UTF_COLUMN_FLAG_NAME | UTF_COLUMN_FLAG_ROW
+    if column.constant {
+      flag = UTF_COLUMN_FLAG_NAME | UTF_COLUMN_FLAG_DEFAULT
+    }
+    schema.WriteByte(byte(flag) | column.kind)
+    binary.Write(schema, binary.BigEndian, addString(column.name))
+    if column.constant {
+      write(schema, column.kind, column.values[0])
+    }
+  }
+  rowData := &bytes.Buffer{}
+  for i := range rows {
+    for _, column := range columns {
+      if !column.constant {
+        write(rowData, column.kind, column.values[i])
+      }
+    }
+  }
+  rowWidth := 0
+  if rows > 0 {
+    rowWidth = rowData.Len() / rows
+  }
+
+  rowsOffset := 0x18 + schema.Len()
+  stringsOffset := rowsOffset + rowData.Len()
+  dataOffset := stringsOffset + strs.Len()
+  body := &bytes.Buffer{}
+  binary.Write(body, binary.BigEndian, uint16(1))
+  binary.Write(body, binary.BigEndian, uint16(rowsOffset))
+  binary.Write(body, binary.BigEndian, uint32(stringsOffset))
+  binary.Write(body, binary.BigEndian, uint32(dataOffset))
+  binary.Write(body, binary.BigEndian, nameOffset)
+  binary.Write(body, binary.BigEndian, uint16(len(columns)))
+  binary.Write(body, binary.BigEndian, uint16(rowWidth))
+  binary.Write(body, binary.BigEndian, uint32(rows))
+  body.Write(schema.Bytes())
+  body.Write(rowData.Bytes())
+  body.Write(strs.Bytes())
+  body.Write(blob.Bytes())
+
+  table := []byte(UTF_SIGNATURE)
+  table = binary.BigEndian.AppendUint32(table, uint32(body.Len()))
+  return append(table, body.Bytes()...)
+}
+
+func TestParseUtfTable(t *testing.T) {
+  nested := encodeTestUtf("Nested", 1, utfTestColumn{name: "Value", kind: UTF_TYPE_S16, values: []any{int16(-2)}})
+  data := encodeTestUtf("Test", 2,
+    utfTestColumn{name: "Id", kind: UTF_TYPE_U16, values: []any{uint16(3), uint16(65535)}},
+    utfTestColumn{name: "Delta", kind: UTF_TYPE_S32, values: []any{int32(-5), int32(5)}},
+    utfTestColumn{name: "Name", kind: UTF_TYPE_STRING, values: []any{"first", "second"}},
+    utfTestColumn{name: "Version", kind: UTF_TYPE_U32, values: []any{uint32(7)}, constant: true},
+    utfTestColumn{name: "Gain", kind: UTF_TYPE_FLOAT, values: []any{float32(0.5), float32(-1)}},
+    utfTestColumn{name: "Blob", kind: UTF_TYPE_DATA, values: []any{[]byte{1, 2, 3}, nested}},
+  )
+  table, err := ParseUtfTable(data)
+  if err != nil {
+    t.Fatal(err)
+  }
+  if table.Name != "Test" || len(table.Columns) != 6 || len(table.Rows) != 2 {
+    t.Fatalf("parsed table %q of %d columns and %d rows", table.Name, len(table.Columns), len(table.Rows))
+  }
+  if !table.Has("Gain") || table.Has("Missing") {
+    t.Error("Has does not tell the columns")
+  }
+  for row, want := range []struct {
+    id    int64
+    delta int64
+    name  string
+    gain  float32
+  }{
+    {3, -5, "first", 0.5},
+    {65535, 5, "second", -1},
+  } {
+    if got := table.Int(row, "Id"); got != want.id {
+      t.Errorf("Id of row %d is %d, want %d", row, got, want.id)
+    }
+    if got := table.Int(row, "Delta"); got != want.delta {
+      t.Errorf("Delta of row %d is %d, want %d", row, got, want.delta)
+    }
+    if got := table.String(row, "Name"); got != want.name {
+      t.Errorf("Name of row %d is %q, want %q", row, got, want.name)
+    }
+    if got := table.Int(row, "Version"); got != 7 {
+      t.Errorf("default Version of row %d is %d, want 7", row, got)
+    }
+    if got := table.Rows[row]["Gain"]; got != want.gain {
+      t.Errorf("Gain of row %d is %v, want %v", row, got, want.gain)
+    }
+  }
+  if got := table.Data(0, "Blob"); !bytes.Equal(got, []byte{1, 2, 3}) {
+    t.Errorf("Blob of row 0 is %v", got)
+  }
+  if table.Int(2, "Id") != 0 || table.String(-1, "Name") != "" {
+    t.Error("rows out of range are not empty")
+  }
+  inner, err := table.Table(1, "Blob")
+  if err != nil {
+    t.Fatal(err)
+  }
+  if inner.Name != "Nested" || inner.Int(0, "Value") != -2 {
+    t.Errorf("nested table %q has value %d", inner.Name, inner.Int(0, "Value"))
+  }
+}
+
+func TestParseUtfTableCorrupted(t *testing.T) {
+  data := encodeTestUtf("Test", 2,
+    utfTestColumn{name: "Id", kind: UTF_TYPE_U16, values: []any{uint16(1), uint16(2)}},
+    utfTestColumn{name: "Name", kind: UTF_TYPE_STRING, values: []any{"a", "b"}},
+    utfTestColumn{name: "Blob", kind: UTF_TYPE_DATA, values: []any{[]byte{1}, []byte{2, 3}}},
+  )
+  patched := func(offset int, value uint32) []byte {
+    corrupted := bytes.Clone(data)
+    binary.BigEndian.PutUint32(corrupted[offset:], value)
+    return corrupted
+  }
+  for name, corrupted := range map[string][]byte{
+    "signature":  append([]byte("@UTX"), data[4:]...),
+    "truncated":  data[:len(data)-1],
+    "header":     data[:12],
+    "size":       patched(4, 0xFFFFFFF0),
+    "row count":  patched(8+20, 0xFFFFFFFF),
+    "row width":  patched(8+18, 0xFFFF0000|2),
+    "strings":    patched(8+4, 0x7FFFFFFF),
+    "empty rows": append(data[:8+18:8+18], append([]byte{0, 0, 0x10, 0, 0, 0}, data[8+24:]...)...),
+  } {
+    if _, err := ParseUtfTable(corrupted); err == nil {
+      t.Errorf("corrupted %s was parsed", name)
+    }
+  }
+
+  // no corruption of a single byte may panic
+  for i := range data {
+    for _, value := range []byte{0x00, 0x7F, 0xFF} {
+      corrupted := bytes.Clone(data)
+      corrupted[i] = value
+      ParseUtfTable(corrupted)
+    }
+  }
+}
@@ -0,0 +1,46 @@
+package cri
+
+import (
+  "encoding/binary"
+  "fmt"
+  "io"
+)
+
+// WriteWav writes interleaved 16-bit samples as a PCM WAV file.
+func WriteWav(w io.Writer, samples []int16, channels int, sampleRate int) error {
+  if channels <= 0 || sampleRate <= 0 {
+    return fmt.Errorf("invalid WAV format of %d channels at %d Hz", channels, sampleRate)
+  }
+  dataSize := len(samples) * 2
+  header := make([]byte, 44)
+  copy(header[0:], "RIFF")
+  binary.LittleEndian.PutUint32(header[4:], uint32(36+dataSize))
+  copy(header[8:], "WAVEfmt ")
+  binary.LittleEndian.PutUint32(header[16:], 16)
+  binary.LittleEndian.PutUint16(header[20:], 1)
+  binary.LittleEndian.PutUint16(header[22:], uint16(channels))
+  binary.LittleEndian.PutUint32(header[24:], uint32(sampleRate))
+  binary.LittleEndian.PutUint32(header[28:], uint32(sampleRate*channels*2))
+  binary.LittleEndian.PutUint16(header[32:], uint16(channels*2))
+  binary.LittleEndian.PutUint16(header[34:], 16)
+  copy(header[36:], "data")
+  binary.LittleEndian.PutUint32(header[40:], uint32(dataSize))
+  if _, err := w.Write(header); err != nil {
+    return err
+  }
+  data := make([]byte, dataSize)
+  for i, sample := range samples {
+    binary.LittleEndian.PutUint16(data[i*2:], uint16(sample))
+  }
+  _, err := w.Write(data)
+  return err
+}
+
+// HcaToWav decodes an HCA stream and writes it as a WAV file.
+func HcaToWav(w io.Writer, data []byte, key uint64, subkey uint16) error {
+  h, samples, err := DecodeHca(data, key, subkey)
+  if err != nil {
+    return err
+  }
+  return WriteWav(w, samples, h.Channels, h.SampleRate)
+}
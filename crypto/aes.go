@@ -21,45 +21,135 @@ var (
   ErrInvalidPKCS7Padding = errors.New("invalid padding on input")
 )
 
+// streamChunkSize is how much ciphertext a decryptReader handles at once, it
+// must be a multiple of aes.BlockSize.
+const streamChunkSize = 64 * 1024
+
 func Decrypt(key []byte, iv []byte, reader io.Reader, writer io.Writer) {
-  ciphertext, err := io.ReadAll(reader)
+  plainReader, err := NewDecryptReader(key, iv, reader)
   if err != nil {
     panic(err)
   }
 
-  block, err := aes.NewCipher(key)
+  n, err := io.Copy(writer, plainReader)
   if err != nil {
     panic(err)
   }
+  if n <= 0 {
+    log.Panicf("%q bytes of data has been written.", n)
+  }
+}
+
+// decryptReader decrypts AES-CBC ciphertext chunk by chunk, so that memory
+// usage does not depend on the size of the input. The last decrypted block is
+// held back until the end of the input tells it carries the PKCS7 padding.
+type decryptReader struct {
+  src   io.Reader
+  mode  cipher.BlockMode
+  chunk []byte
+  buf   []byte
+  held  []byte
+  out   []byte
+  err   error
+}
 
-  mode := cipher.NewCBCDecrypter(block, iv)
+// NewDecryptReader returns a reader yielding the unpadded plaintext of the
+// AES-CBC ciphertext read from src.
+func NewDecryptReader(key []byte, iv []byte, src io.Reader) (io.Reader, error) {
+  block, err := aes.NewCipher(key)
+  if err != nil {
+    return nil, err
+  }
+  return &decryptReader{
+    src:   src,
+    mode:  cipher.NewCBCDecrypter(block, iv),
+    chunk: make([]byte, streamChunkSize),
+    buf:   make([]byte, 0, streamChunkSize+aes.BlockSize),
+    held:  make([]byte, 0, aes.BlockSize),
+  }, nil
+}
 
-  // CryptBlocks can work in-place if the two arguments are the same.
-  plainBytes := make([]byte, len(ciphertext))
-  mode.CryptBlocks(plainBytes, ciphertext)
+func (r *decryptReader) Read(p []byte) (int, error) {
+  for len(r.out) == 0 {
+    if r.err != nil {
+      return 0, r.err
+    }
+    r.fill()
+  }
+  n := copy(p, r.out)
+  r.out = r.out[n:]
+  return n, nil
+}
 
-  // If the original plaintext lengths are not a multiple of the block
-  // size, padding would have to be added when encrypting, which would be
-  // removed at this point. For an example, see
-  // https://tools.ietf.org/html/rfc5246#section-6.2.3.2. However, it's
-  // critical to note that ciphertexts must be authenticated (i.e. by
-  // using crypto/hmac) before being decrypted in order to avoid creating
-  // a padding oracle.
+func (r *decryptReader) fill() {
+  n, err := io.ReadFull(r.src, r.chunk)
+  switch err {
+  case nil:
+  case io.EOF, io.ErrUnexpectedEOF:
+    r.err = io.EOF
+  default:
+    r.err = err
+    return
+  }
+  if n%aes.BlockSize != 0 {
+    r.err = ErrInvalidPKCS7Padding
+    return
+  }
+  data := r.chunk[:n]
+  r.mode.CryptBlocks(data, data)
 
-  plainBytes, err = pkcs7Unpad(plainBytes, 128)
+  plainBytes := append(append(r.buf[:0], r.held...), data...)
+  if r.err == io.EOF {
+    // If the original plaintext lengths are not a multiple of the block
+    // size, padding would have to be added when encrypting, which would be
+    // removed at this point. For an example, see
+    // https://tools.ietf.org/html/rfc5246#section-6.2.3.2. However, it's
+    // critical to note that ciphertexts must be authenticated (i.e. by
+    // using crypto/hmac) before being decrypted in order to avoid creating
+    // a padding oracle.
+    r.held = r.held[:0]
+    if r.out, err = pkcs7Unpad(plainBytes, 128); err != nil {
+      r.err = err
+    }
+    return
+  }
+  split := len(plainBytes) - aes.BlockSize
+  r.held = append(r.held[:0], plainBytes[split:]...)
+  r.out = plainBytes[:split]
+}
+
+// Encrypt is the inverse of Decrypt, it pads everything read from reader with
+// PKCS7 and writes the AES-CBC ciphertext to writer.
+func Encrypt(key []byte, iv []byte, reader io.Reader, writer io.Writer) {
+  plainBytes, err := io.ReadAll(reader)
   if err != nil {
     panic(err)
   }
 
-  n, err := io.Copy(writer, bytes.NewBuffer(plainBytes))
+  block, err := aes.NewCipher(key)
   if err != nil {
     panic(err)
   }
-  if n <= 0 {
-    log.Panicf("%q bytes of data has been written.", n)
+
+  plainBytes, err = pkcs7Pad(plainBytes, 128)
+  if err != nil {
+    panic(err)
+  }
+
+  mode := cipher.NewCBCEncrypter(block, iv)
+  mode.CryptBlocks(plainBytes, plainBytes)
+
+  if _, err := writer.Write(plainBytes); err != nil {
+    panic(err)
   }
 }
 
+// PaddedSize returns the size of the ciphertext Encrypt produces for size bytes
+// of plaintext.
+func PaddedSize(size int) int {
+  return size + aes.BlockSize - size%aes.BlockSize
+}
+
 // pkcs7Pad right-pads the given byte slice with 1 to n bytes, where
 // n is the block size. The size of the result is x times n, where x
 // is at least 1.
@@ -83,23 +173,23 @@ func pkcs7Pad(b []byte, blocksize int) ([]byte, error) {
 // amount of padding, where n is the block size.
 func pkcs7Unpad(b []byte, blocksize int) ([]byte, error) {
   if blocksize <= 0 {
-    panic(ErrInvalidBlockSize)
+    return nil, ErrInvalidBlockSize
   }
   if len(b) == 0 {
-    panic(ErrInvalidPKCS7Data)
+    return nil, ErrInvalidPKCS7Data
   }
   blocksize = blocksize / 8
   if len(b)%blocksize != 0 {
-    panic(ErrInvalidPKCS7Padding)
+    return nil, ErrInvalidPKCS7Padding
   }
   c := b[len(b)-1]
   n := int(c)
   if n == 0 || n > len(b) {
-    panic(ErrInvalidPKCS7Padding)
+    return nil, ErrInvalidPKCS7Padding
   }
   for i := 0; i < n; i++ {
     if b[len(b)-n+i] != c {
-      panic(ErrInvalidPKCS7Padding)
+      return nil, ErrInvalidPKCS7Padding
     }
   }
   return b[:len(b)-n], nil
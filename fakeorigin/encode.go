@@ -0,0 +1,68 @@
+package fakeorigin
+
+import (
+	"bytes"
+
+	"vertesan/hailstorm/crypto"
+	"vertesan/hailstorm/manifest"
+	"vertesan/hailstorm/rich"
+)
+
+// encodeEntry builds the catalog entry of asset together with the bytes the
+// origin serves for it.
+func encodeEntry(asset Asset) (manifest.Entry, []byte) {
+	if len(asset.ContentTypes) != len(asset.ContentNames) {
+		rich.Panic("Asset %q has %d content types but %d content names.", asset.Label, len(asset.ContentTypes), len(asset.ContentNames))
+	}
+	labelCrc := crypto.UpdateCrc64(0, []byte(asset.Label), len(asset.Label), nil)
+	var seed uint64
+	var body []byte
+	switch asset.ResourceType {
+	case 0, 128:
+		body = asset.Data
+	case 1:
+		// the real origin puts 2 unknown bytes in front of every AssetBundle
+		body = append([]byte{0x00, 0x01}, asset.Data...)
+	case 192:
+		// Seeds are serialized in 8 bytes only when the first one is nonzero.
+		// Only the lower 63 bits take part in the key derivation of raw assets,
+		// so setting the top bit is free.
+		seed = labelCrc | 1<<63
+		encrypted := new(bytes.Buffer)
+		manifest.EncodeAsset(&manifest.Asset{
+			Seed:          seed,
+			CalcCrc64Name: asset.Label,
+			Type:          manifest.RAW,
+		}, encrypted, bytes.NewReader(asset.Data))
+		body = encrypted.Bytes()
+	default:
+		rich.Panic("Unsupported resource type %d of asset %q.", asset.ResourceType, asset.Label)
+	}
+
+	entry := manifest.Entry{
+		Priority:           asset.Priority,
+		ResourceType:       asset.ResourceType,
+		NumDeps:            uint32(len(asset.Deps)),
+		NumContents:        uint32(len(asset.ContentNames)),
+		NumCategories:      uint32(len(asset.Categories)),
+		Size:               uint64(len(body)),
+		TypeCrc:            crypto.UpdateCrc32(0, []byte(asset.Type), len(asset.Type)),
+		LabelCrc:           labelCrc,
+		Checksum:           checksumOf(body),
+		Seed:               seed,
+		StrTypeCrc:         asset.Type,
+		StrContentTypeCrcs: asset.ContentTypes,
+		StrCategoryCrcs:    asset.Categories,
+		StrLabelCrc:        asset.Label,
+		StrContentNameCrcs: asset.ContentNames,
+		StrDepCrcs:         asset.Deps,
+	}
+	entry.RealName = manifest.GetRealName(entry.Checksum, entry.LabelCrc, entry.Size)
+	return entry, body
+}
+
+// checksumOf uses the same CRC-64 as label hashes, which is what
+// manifest.VerifyFile derives for the fake origin.
+func checksumOf(body []byte) uint64 {
+	return crypto.UpdateCrc64(0, body, len(body), nil)
+}
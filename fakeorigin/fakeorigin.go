@@ -0,0 +1,164 @@
+// Package fakeorigin serves a synthetic game backend: an encrypted catalog and
+// assets built with the same key derivation as manifest.DecodeAsset, a login
+// endpoint and a Google Play page. It lets the whole update flow run offline,
+// either from go test through httptest or as `hailstorm fake-origin`.
+package fakeorigin
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"vertesan/hailstorm/crypto"
+	"vertesan/hailstorm/manifest"
+	"vertesan/hailstorm/network"
+)
+
+const (
+	LoginPath     = "/v1/user/login"
+	PlayStorePath = "/store/apps/details"
+)
+
+// Asset describes a single catalog entry served by the fake origin. Data is
+// the plain content, the origin encrypts or prefixes it according to
+// ResourceType the way the real one does.
+type Asset struct {
+	Label        string
+	Type         string
+	ResourceType uint32
+	Priority     uint32
+	Categories   []string
+	ContentTypes []string
+	ContentNames []string
+	Deps         []string
+	Data         []byte
+}
+
+// Origin is an http.Handler serving a fixed resource version.
+type Origin struct {
+	ClientVersion string
+	ResVersion    string
+	// ResInfo is the value of `x-res-version` returned by the login endpoint.
+	ResInfo string
+	// Entries is the catalog exactly as manifest.Catalog.Init parses it.
+	Entries []manifest.Entry
+
+	manifestName string
+	files        map[string][]byte
+	modTime      time.Time
+}
+
+// New encodes assets into a catalog for clientVersion and resVersion, eg.
+// "1.0.0" and "R0000001".
+func New(clientVersion string, resVersion string, assets []Asset) *Origin {
+	o := &Origin{
+		ClientVersion: clientVersion,
+		ResVersion:    resVersion,
+		files:         make(map[string][]byte, len(assets)+1),
+		modTime:       time.Now(),
+	}
+	entries := make([]manifest.Entry, 0, len(assets))
+	for _, asset := range assets {
+		entry, body := encodeEntry(asset)
+		entries = append(entries, entry)
+		o.files[assetPath(entry.ResourceType, entry.RealName)] = body
+	}
+
+	// parse the catalog back, so that Entries are exactly what the updater sees
+	plainCatalog := new(bytes.Buffer)
+	manifest.EncodeTransposedArray(entries, plainCatalog)
+	catalog := new(manifest.Catalog)
+	revMap := make(map[uint64]int)
+	catalog.ParseTransposedArray(plainCatalog, revMap)
+	catalog.ResolveAllDeps(revMap)
+	catalog.ResolveAllRealNames()
+	o.Entries = catalog.Entries
+
+	resVerCrc := crypto.UpdateCrc64(0, []byte(resVersion), len(resVersion), nil)
+	mani := &manifest.Manifest{
+		// Catalog seeds are used in full, any value works.
+		Asset:         manifest.Asset{Seed: resVerCrc ^ 0x5EED5EED5EED5EED},
+		SimpleResver:  resVersion,
+		ClientVersion: clientVersion,
+	}
+	blob := manifest.EncodeCatalog(entries, mani)
+	o.ResInfo = mani.ResHeader()
+
+	// the manifest is always downloaded as a raw resource
+	o.manifestName = mani.RealName
+	o.files[assetPath(999, o.manifestName)] = blob
+	return o
+}
+
+// Endpoints returns the network endpoints pointing at an Origin served from
+// baseURL.
+func (o *Origin) Endpoints(baseURL string) network.Endpoints {
+	baseURL = strings.TrimRight(baseURL, "/")
+	return network.Endpoints{
+		Origins:      []string{baseURL},
+		LoginUrl:     baseURL + LoginPath,
+		PlayStoreUrl: baseURL + PlayStorePath,
+	}
+}
+
+func (o *Origin) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case LoginPath:
+		o.handleLogin(w, r)
+	case PlayStorePath:
+		o.handlePlayStore(w, r)
+	default:
+		o.handleAsset(w, r)
+	}
+}
+
+func (o *Origin) handleLogin(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if clientVersion := r.Header.Get("X-Client-Version"); clientVersion != o.ClientVersion {
+		http.Error(w, fmt.Sprintf("unsupported client version %q", clientVersion), http.StatusUpgradeRequired)
+		return
+	}
+	w.Header().Set("x-res-version", o.ResInfo)
+	w.Header().Set("Content-Type", "application/json")
+	w.Write([]byte(`{}`))
+}
+
+// handlePlayStore imitates the `ds:5` script block network.GetPlayVersion
+// scrapes the client version from.
+func (o *Origin) handlePlayStore(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	fmt.Fprintf(
+		w,
+		"<html><body><script>AF_initDataCallback({key: 'ds:5', data:[[[\"%s\"]],[[[33]],[[[33,\"13\"]]]]]});</script></body></html>",
+		o.ClientVersion,
+	)
+}
+
+// handleAsset serves asset files, http.ServeContent takes care of Range
+// requests so that resuming downloads can be exercised too.
+func (o *Origin) handleAsset(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	body, ok := o.files[r.URL.Path]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	http.ServeContent(w, r, "", o.modTime, bytes.NewReader(body))
+}
+
+func assetPath(resourceType uint32, realName string) string {
+	resType := "raw"
+	if resourceType <= 1 {
+		resType = "android"
+	}
+	return fmt.Sprintf("/%v/%v/%v", resType, realName[:2], realName)
+}
@@ -0,0 +1,160 @@
+package fakeorigin
+
+import (
+	"bytes"
+	"context"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"vertesan/hailstorm/manifest"
+	"vertesan/hailstorm/master"
+	"vertesan/hailstorm/network"
+)
+
+// TestUpdateFlow runs the update flow of the runner against the fake origin:
+// login, manifest, catalog, assets, decryption and masterdata.
+func TestUpdateFlow(t *testing.T) {
+	assets := DefaultAssets()
+	origin := New(DefaultClientVersion, DefaultResVersion, assets)
+	server := httptest.NewServer(origin)
+	defer server.Close()
+	network.SetEndpoints(origin.Endpoints(server.URL))
+	defer network.SetEndpoints(network.Endpoints{})
+
+	for _, stream := range []bool{false, true} {
+		name := "decrypt"
+		if stream {
+			name = "stream"
+		}
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			dir := t.TempDir()
+			rawDir := filepath.Join(dir, "assets")
+			plainDir := filepath.Join(dir, "plain")
+
+			resInfo := network.Login(ctx, origin.ClientVersion)
+			if resInfo != origin.ResInfo {
+				t.Fatalf("login returned resInfo %q, want %q", resInfo, origin.ResInfo)
+			}
+			mani := new(manifest.Manifest)
+			mani.Init(resInfo, origin.ClientVersion)
+			network.DownloadManifestSync(ctx, mani.RealName, mani.Size, dir)
+			manifestFile, err := os.Open(filepath.Join(dir, mani.RealName))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer manifestFile.Close()
+			catalog := new(manifest.Catalog)
+			catalog.Init(mani, manifestFile)
+			if len(catalog.Entries) != len(assets) {
+				t.Fatalf("catalog has %d entries, want %d", len(catalog.Entries), len(assets))
+			}
+
+			opts := network.DownloadOptions{Concurrency: 2}
+			if stream {
+				opts.PlainDir = plainDir
+			}
+			results, failures := network.DownloadAssetsAsync(ctx, catalog, rawDir, opts)
+			for _, result := range results {
+				if !result.Ok() {
+					t.Errorf("verification of %q failed: %v", result.Label, result.Status)
+				}
+			}
+			if len(failures) > 0 {
+				t.Fatalf("decoding failed: %+v", failures)
+			}
+			if !stream {
+				if failures := manifest.DecryptAllAssets(ctx, catalog, plainDir, rawDir, 2, nil); len(failures) > 0 {
+					t.Fatalf("decryption failed: %+v", failures)
+				}
+			}
+
+			entries := make(map[string]*manifest.Entry, len(catalog.Entries))
+			for i := range catalog.Entries {
+				entries[catalog.Entries[i].StrLabelCrc] = &catalog.Entries[i]
+			}
+			for _, asset := range assets {
+				entry, ok := entries[asset.Label]
+				if !ok {
+					t.Fatalf("catalog has no entry %q", asset.Label)
+				}
+				plain, err := os.ReadFile(filepath.Join(plainDir, manifest.PlainName(entry)))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !bytes.Equal(plain, asset.Data) {
+					t.Errorf("plain file of %q differs from the served asset", asset.Label)
+				}
+			}
+
+			dbFile, err := os.Open(filepath.Join(plainDir, "advalbums.tsv"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer dbFile.Close()
+			ins := master.MasterMap["advalbums.tsv"]
+			rows, err := master.Parse(dbFile, "advalbums.tsv", &ins)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(rows) != 2 {
+				t.Fatalf("advalbums.tsv has %d rows, want 2", len(rows))
+			}
+		})
+	}
+}
+
+// TestUndecodableAsset checks that an asset served whole but impossible to
+// decode is reported as a failure without stopping the others, in both modes.
+func TestUndecodableAsset(t *testing.T) {
+	assets := append(DefaultAssets(), Asset{
+		Label:        "broken_bundle",
+		Type:         "assetbundle",
+		ResourceType: 1,
+		Data:         []byte("not a bundle at all"),
+	})
+	origin := New(DefaultClientVersion, DefaultResVersion, assets)
+	server := httptest.NewServer(origin)
+	defer server.Close()
+	network.SetEndpoints(origin.Endpoints(server.URL))
+	defer network.SetEndpoints(network.Endpoints{})
+
+	for _, stream := range []bool{false, true} {
+		name := "decrypt"
+		if stream {
+			name = "stream"
+		}
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			dir := t.TempDir()
+			rawDir := filepath.Join(dir, "assets")
+			plainDir := filepath.Join(dir, "plain")
+			catalog := &manifest.Catalog{Entries: origin.Entries}
+
+			opts := network.DownloadOptions{Concurrency: 2}
+			if stream {
+				opts.PlainDir = plainDir
+				opts.KeepRaw = true
+			}
+			_, failures := network.DownloadAssetsAsync(ctx, catalog, rawDir, opts)
+			if !stream {
+				failures = manifest.DecryptAllAssets(ctx, catalog, plainDir, rawDir, 2, nil)
+			}
+			if len(failures) != 1 || failures[0].Label != "broken_bundle" {
+				t.Fatalf("failures are %+v, want broken_bundle only", failures)
+			}
+			for i := range catalog.Entries {
+				entry := &catalog.Entries[i]
+				if _, err := os.Stat(filepath.Join(rawDir, entry.RealName)); err != nil {
+					t.Errorf("raw file of %q is missing: %v", entry.StrLabelCrc, err)
+				}
+				_, err := os.Stat(filepath.Join(plainDir, manifest.PlainName(entry)))
+				if broken := entry.StrLabelCrc == "broken_bundle"; broken != os.IsNotExist(err) {
+					t.Errorf("plain file of %q: %v", entry.StrLabelCrc, err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,105 @@
+package fakeorigin
+
+import (
+	"bytes"
+	"encoding/binary"
+	"time"
+
+	"vertesan/hailstorm/crypto"
+)
+
+const (
+	DefaultClientVersion = "1.0.0"
+	DefaultResVersion    = "R0000001"
+)
+
+// DefaultAssets covers every resource type handled by
+// manifest.DecryptAllAssets, including a database master.Parse can read and
+// AssetBundles depending on each other.
+func DefaultAssets() []Asset {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	return []Asset{
+		{
+			Label:        "advalbums.tsv",
+			Type:         "tsv",
+			ResourceType: 192,
+			Categories:   []string{"master"},
+			Data: encodeTable(
+				[]string{"Id", "StartTime", "EndTime"},
+				[]uint32{0x33, 0x10, 0x10},
+				[][]any{
+					{int64(1), start, start.AddDate(1, 0, 0)},
+					{int64(2), start.AddDate(0, 6, 0), start.AddDate(2, 0, 0)},
+				},
+			),
+		},
+		{
+			Label:        "bgm_fake_0001.acb",
+			Type:         "acb",
+			ResourceType: 192,
+			Priority:     1,
+			Categories:   []string{"sound"},
+			Data:         bytes.Repeat([]byte("@UTF fake cue sheet "), 64),
+		},
+		{
+			Label:        "movie_fake_0001.usm",
+			Type:         "usm",
+			ResourceType: 0,
+			Priority:     2,
+			Categories:   []string{"movie"},
+			Data:         bytes.Repeat([]byte("CRID"), 256),
+		},
+		{
+			Label:        "fake_shared",
+			Type:         "assetbundle",
+			ResourceType: 1,
+			ContentTypes: []string{"Texture2D"},
+			ContentNames: []string{"fake_shared_tex"},
+			Data:         append([]byte("UnityFS\x00"), bytes.Repeat([]byte{0xAB}, 128)...),
+		},
+		{
+			Label:        "fake_character",
+			Type:         "assetbundle",
+			ResourceType: 1,
+			Priority:     1,
+			ContentTypes: []string{"GameObject", "Material"},
+			ContentNames: []string{"fake_character", "fake_character_mat"},
+			Deps:         []string{"fake_shared"},
+			Data:         append([]byte("UnityFS\x00"), bytes.Repeat([]byte{0xCD}, 256)...),
+		},
+	}
+}
+
+// encodeTable writes a database in the 0xDA00 format read by master.Parse.
+// Supported cell types are 0x10 (string or time.Time), 0x20 (int) and 0x33
+// (int64).
+func encodeTable(names []string, types []uint32, rows [][]any) []byte {
+	buf := new(bytes.Buffer)
+	buf.Write([]byte{0xDA, 0x00, 0x00, 0x00})
+	buf.Write(binary.AppendUvarint(nil, uint64(len(rows))))
+	buf.Write(binary.AppendUvarint(nil, uint64(len(names))))
+	for i, name := range names {
+		binary.Write(buf, binary.BigEndian, crypto.UpdateCrc32(0, []byte(name), len(name)))
+		binary.Write(buf, binary.BigEndian, types[i])
+	}
+	// cells are stored column by column
+	for col := range names {
+		for _, row := range rows {
+			switch v := row[col].(type) {
+			case string:
+				buf.WriteString(v)
+				buf.WriteByte(0x00)
+			case time.Time:
+				buf.WriteString(v.Format(time.DateTime))
+				buf.WriteByte(0x00)
+			case int:
+				buf.Write(binary.AppendUvarint(nil, uint64(uint32(int32(v)))))
+			case int64:
+				binary.Write(buf, binary.BigEndian, v)
+			default:
+				panic("unsupported cell type")
+			}
+		}
+	}
+	return buf.Bytes()
+}
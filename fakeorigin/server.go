@@ -0,0 +1,41 @@
+package fakeorigin
+
+import (
+	"flag"
+	"net"
+	"net/http"
+	"strings"
+
+	"vertesan/hailstorm/rich"
+)
+
+// Command is the hidden subcommand of the hailstorm binary starting a fake
+// origin, eg. `hailstorm fake-origin --addr 127.0.0.1:8090`.
+const Command = "fake-origin"
+
+// Main runs the fake-origin subcommand until the process is killed.
+func Main(args []string) error {
+	flags := flag.NewFlagSet(Command, flag.ContinueOnError)
+	fAddr := flags.String("addr", "127.0.0.1:8090", "Listen address of the fake origin.")
+	fClientVersion := flags.String("client-version", DefaultClientVersion, "Client version reported by the fake Google Play page.")
+	fResVersion := flags.String("res-version", DefaultResVersion, "Resource version of the served catalog.")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	origin := New(*fClientVersion, *fResVersion, DefaultAssets())
+	listener, err := net.Listen("tcp", *fAddr)
+	if err != nil {
+		return err
+	}
+	url := "http://" + listener.Addr().String()
+	endpoints := origin.Endpoints(url)
+	rich.Info("Fake origin is serving %d assets of %q on %v.", len(origin.Entries), origin.ResInfo, url)
+	rich.Info(
+		"Run the updater against it with: --origin %v --login-url %v --play-url %v",
+		strings.Join(endpoints.Origins, ","),
+		endpoints.LoginUrl,
+		endpoints.PlayStoreUrl,
+	)
+	return http.Serve(listener, origin)
+}
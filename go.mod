@@ -8,6 +8,7 @@ require (
 	github.com/goccy/go-json v0.10.4
 	github.com/goccy/go-yaml v1.15.11
 	github.com/pierrec/lz4/v4 v4.1.22
+	github.com/ulikunitz/xz v0.5.12
 	golang.org/x/sync v0.10.0
 )
 
@@ -1,15 +1,27 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"os"
+	"os/signal"
+	"syscall"
 
+	"vertesan/hailstorm/fakeorigin"
 	"vertesan/hailstorm/rich"
 	"vertesan/hailstorm/runner"
 	"vertesan/hailstorm/webui"
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == fakeorigin.Command {
+		if err := fakeorigin.Main(os.Args[2:]); err != nil {
+			rich.Error("Fake origin failed: %v", err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	fWeb := flag.Bool("web", false, "Start the WebUI server.")
 	fAddr := flag.String("addr", "127.0.0.1:5001", "WebUI listen address.")
 	fDebug := flag.Bool("debug", false, "Enable debug logging.")
@@ -24,7 +36,10 @@ func main() {
 		return
 	}
 
-	if err := runner.Run(opts); err != nil {
+	// Ctrl-C stops the runner between files instead of killing it mid-write
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if err := runner.Run(ctx, opts); err != nil {
 		rich.Error("%v", err)
 		os.Exit(1)
 	}
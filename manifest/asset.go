@@ -3,12 +3,16 @@ package manifest
 import (
   "bufio"
   "bytes"
+  "context"
   "crypto/sha256"
   "encoding/binary"
   "encoding/hex"
+  "fmt"
   "io"
   "log"
   "os"
+  "runtime"
+  "sync"
 
   "vertesan/hailstorm/crypto"
   "vertesan/hailstorm/rich"
@@ -35,79 +39,211 @@ type Asset struct {
   // Md5           [16]byte
 }
 
-func DecryptAllAssets(catalog *Catalog, dstDir string, srcDir string) {
-  counter := 0
+// DecryptFailure records an entry DecryptAllAssets could not process.
+type DecryptFailure struct {
+  Label    string `json:"label"`
+  RealName string `json:"realName"`
+  Error    string `json:"error"`
+}
+
+type decryptResult struct {
+  idx int
+  err error
+}
+
+// DecryptAllAssets processes the raw files of catalog with a pool of workers,
+// runtime.NumCPU() of them when workers <= 0. Progress is still reported in
+// catalog order. A failed entry does not stop the others, every failure is
+// returned instead. ctx is checked between files, so a cancellation never
+// leaves a half-written one behind. Processed entries are recorded into state,
+// which may be nil.
+func DecryptAllAssets(ctx context.Context, catalog *Catalog, dstDir string, srcDir string, workers int, state *State) []DecryptFailure {
   amount := len(catalog.Entries)
+  if workers <= 0 {
+    workers = runtime.NumCPU()
+  }
+  workers = min(workers, max(amount, 1))
 
   // decrypt (or just copy) asset files
   if err := os.MkdirAll(dstDir, 0755); err != nil {
     panic(err)
   }
-  for _, entry := range catalog.Entries {
-    counter++
-    var suffix = ""
-    if entry.ResourceType == 1 {
-      suffix = ".assetbundle"
+
+  jobs := make(chan int)
+  results := make(chan decryptResult)
+  var wg sync.WaitGroup
+  for range workers {
+    wg.Add(1)
+    go func() {
+      defer wg.Done()
+      for idx := range jobs {
+        results <- decryptResult{idx, decryptOne(&catalog.Entries[idx], dstDir, srcDir)}
+      }
+    }()
+  }
+  go func() {
+    defer close(jobs)
+    for idx := range catalog.Entries {
+      select {
+      case <-ctx.Done():
+        return
+      case jobs <- idx:
+      }
+    }
+  }()
+  go func() {
+    wg.Wait()
+    close(results)
+  }()
+
+  var totalBytes uint64
+  for i := range catalog.Entries {
+    totalBytes += catalog.Entries[i].Size
+  }
+  progress := rich.NewTracker("decrypt", amount, totalBytes)
+
+  // results arrive in any order, hold them back until every earlier entry is
+  // reported
+  done := make([]*error, amount)
+  next := 0
+  failures := []DecryptFailure{}
+  for result := range results {
+    done[result.idx] = &result.err
+    for next < amount && done[next] != nil {
+      entry := &catalog.Entries[next]
+      if err := *done[next]; err != nil {
+        rich.Error("(%d/%d) Failed to process asset file %q(%v): %v", next+1, amount, entry.StrLabelCrc, entry.RealName, err)
+        failures = append(failures, DecryptFailure{
+          Label:    entry.StrLabelCrc,
+          RealName: entry.RealName,
+          Error:    err.Error(),
+        })
+      } else {
+        if err := state.Record(entry); err != nil {
+          panic(err)
+        }
+        rich.Info("(%d/%d) Asset file %q(%v) was successfully processed.", next+1, amount, entry.StrLabelCrc, entry.RealName)
+      }
+      progress.AddBytes(int(entry.Size))
+      progress.Complete()
+      done[next] = nil
+      next++
+    }
+  }
+  progress.Finish()
+
+  if err := ctx.Err(); err != nil {
+    rich.Warning("Decrypting was cancelled, %d/%d assets processed.", next, amount)
+    panic(err)
+  }
+  if len(failures) > 0 {
+    rich.Error("%d of %d asset files failed to be processed.", len(failures), amount)
+  } else {
+    rich.Info("All asset files processed.")
+  }
+  return failures
+}
+
+// decryptOne decodes a single entry into a temporary file which is renamed
+// once complete, panics are turned into the returned error.
+func decryptOne(entry *Entry, dstDir string, srcDir string) (err error) {
+  dst := dstDir + "/" + PlainName(entry)
+  tmp := dst + ".tmp"
+  defer func() {
+    if r := recover(); r != nil {
+      err = fmt.Errorf("%v", r)
+    }
+    if err != nil {
+      os.Remove(tmp)
+    }
+  }()
+
+  rawFile, err := os.Open(srcDir + "/" + entry.RealName)
+  if err != nil {
+    return err
+  }
+  defer rawFile.Close()
+  plainFile, err := os.Create(tmp)
+  if err != nil {
+    return err
+  }
+  plainBuf := bufio.NewWriter(plainFile)
+  DecodeEntry(entry, plainBuf, rawFile)
+  if err := plainBuf.Flush(); err != nil {
+    plainFile.Close()
+    return err
+  }
+  if err := plainFile.Close(); err != nil {
+    return err
+  }
+  return os.Rename(tmp, dst)
+}
+
+// PlainName returns the file name of the decoded entry inside the plain
+// directory.
+func PlainName(entry *Entry) string {
+  if entry.ResourceType == 1 {
+    return entry.StrLabelCrc + ".assetbundle"
+  }
+  return entry.StrLabelCrc
+}
+
+// DecodeEntry turns the raw file of entry read from src into its plain form,
+// according to its resource type.
+func DecodeEntry(entry *Entry, dst io.Writer, src io.Reader) {
+  rawBuf := bufio.NewReader(src)
+  switch entry.ResourceType {
+  case 0, 128: // do nothing
+    if _, err := io.Copy(dst, rawBuf); err != nil {
+      panic(err)
     }
-    // check existing
-    // if _, err := os.Stat(dstDir + "/" + entry.StrLabelCrc + suffix); err == nil {
-    //   rich.Info("(%d/%d) Asset file %q(%v) already exists, skip decrypting.", counter, amount, entry.StrLabelCrc, entry.RealName)
-    //   continue
-    // }
-    
-    rawFile, err := os.Open(srcDir + "/" + entry.RealName)
+  case 1: // skip first 2 bytes
+    offset, err := io.ReadFull(rawBuf, make([]byte, 2))
     if err != nil {
       panic(err)
     }
-    rawBuf := bufio.NewReader(rawFile)
-    plainFile, err := os.Create(dstDir + "/" + entry.StrLabelCrc + suffix)
+    if offset != 2 {
+      rich.Panic("Failed to seek asset file %q.", entry.RealName)
+    }
+    signature, err := rawBuf.Peek(7)
     if err != nil {
       panic(err)
     }
-    plainBuf := bufio.NewWriter(plainFile)
-
-    switch entry.ResourceType {
-    case 0, 128: // do nothing
-      if _, err := io.Copy(plainBuf, rawBuf); err != nil {
-        panic(err)
-      }
-    case 1: // skip first 2 bytes
-      offset, err := io.ReadFull(rawBuf, make([]byte, 2))
-      if err != nil {
-        panic(err)
-      }
-      if offset != 2 {
-        rich.Panic("Failed to seek asset file %q.", rawFile.Name())
-      }
-      signature, err := rawBuf.Peek(7)
-      if err != nil {
-        panic(err)
-      }
-      if string(signature) != "UnityFS" {
-        rich.Panic("AssetBundle signature mismatches for %q.", entry.StrLabelCrc)
-      }
-      if _, err := io.Copy(plainBuf, rawBuf); err != nil {
-        panic(err)
-      }
-    case 192: // need decrypting
-      asset := &Asset{
-        Seed:          entry.Seed,
-        Size:          entry.Size,
-        RealName:      entry.RealName,
-        CalcCrc64Name: entry.StrLabelCrc,
-        Type:          RAW,
-      }
-      DecodeAsset(asset, plainBuf, rawBuf)
+    if string(signature) != "UnityFS" {
+      rich.Panic("AssetBundle signature mismatches for %q.", entry.StrLabelCrc)
     }
-    plainBuf.Flush()
-    rich.Info("(%d/%d) Asset file %q(%v) was successfully processed.", counter, amount, entry.StrLabelCrc, entry.RealName)
-    rawFile.Close()
-    plainFile.Close()
+    if _, err := io.Copy(dst, rawBuf); err != nil {
+      panic(err)
+    }
+  case 192: // need decrypting
+    asset := &Asset{
+      Seed:          entry.Seed,
+      Size:          entry.Size,
+      RealName:      entry.RealName,
+      CalcCrc64Name: entry.StrLabelCrc,
+      Type:          RAW,
+    }
+    DecodeAsset(asset, dst, rawBuf)
   }
-  rich.Info("All asset files processed.")
 }
 
 func DecodeAsset(asset *Asset, dst io.Writer, src io.Reader) {
+  key, iv := DeriveKeyIV(asset)
+
+  // Decrypt and decompress on the fly, memory usage stays the same whatever
+  // the size of the asset is
+  plainReader, err := crypto.NewDecryptReader(key, iv, src)
+  if err != nil {
+    panic(err)
+  }
+  lz4Reader := lz4.NewReader(plainReader)
+  if _, err := io.Copy(dst, lz4Reader); err != nil {
+    panic(err)
+  }
+}
+
+// DeriveKeyIV computes the AES-128 key and CBC IV of asset.
+func DeriveKeyIV(asset *Asset) (key []byte, iv []byte) {
   hexPrefix, _ := hex.DecodeString(PREFIX)
 
   buf := new(bytes.Buffer)
@@ -151,22 +287,5 @@ func DecodeAsset(asset *Asset, dst io.Writer, src io.Reader) {
   // Compute sha256 of all bytes
   keyiv := sha256.Sum256(buf.Bytes())
 
-  key := keyiv[:16]
-  iv := keyiv[16:]
-
-  internalBuf := new(bytes.Buffer)
-  // middleRwter := bufio.NewReadWriter(
-  //   bufio.NewReader(internalBuf),
-  //   bufio.NewWriter(internalBuf),
-  // )
-
-  // Decrypt
-  crypto.Decrypt(key, iv, src, internalBuf)
-
-  // Decompress
-  lz4Reader := lz4.NewReader(internalBuf)
-  _, err := io.Copy(dst, lz4Reader)
-  if err != nil {
-    panic(err)
-  }
+  return keyiv[:16], keyiv[16:]
 }
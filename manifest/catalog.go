@@ -8,7 +8,6 @@ import (
 	"io"
 	"log"
 	"reflect"
-	"slices"
 
 	"vertesan/hailstorm/crypto"
 	"vertesan/hailstorm/rich"
@@ -218,38 +217,137 @@ func (c *Catalog) ParseTransposedArray(bBuf *bytes.Buffer, revMap map[uint64]int
   }
 }
 
+// ResolveAllDeps computes RecDepCrcs of every entry: the entry itself followed
+// by its dependencies in depth-first pre-order, each listed once. Closures are
+// computed once per entry and shared by everything depending on it, so the
+// cost is about the total size of RecDepCrcs. Dependency cycles are reported,
+// entries reaching one are walked one by one instead, which gives the same
+// order.
 func (c *Catalog) ResolveAllDeps(revMap map[uint64]int) {
   maxLen := len(c.Entries)
 
-  var resolveRecursiveDeps func(label uint64, ordDict *[]uint64)
-  resolveRecursiveDeps = func(label uint64, ordDict *[]uint64) {
-    if slices.Contains(*ordDict, label) {
+  // resolve DepCrcs to entry indexes once
+  deps := make([][]int32, maxLen)
+  for i := range c.Entries {
+    entry := &c.Entries[i]
+    deps[i] = make([]int32, entry.NumDeps)
+    for j := range deps[i] {
+      label := binary.BigEndian.Uint64(entry.DepCrcs[j*8:])
+      revIdx, ok := revMap[label]
+      if !ok {
+        log.Panicf("Label: %q not inside revMap", label)
+      }
+      deps[i][j] = int32(revIdx)
+    }
+  }
+
+  const (
+    unvisited = iota
+    visiting
+    resolved
+  )
+  state := make([]uint8, maxLen)
+  cyclic := make([]bool, maxLen)
+  closures := make([][]int32, maxLen)
+  // seen[i] == stamp marks entry i as already part of the closure being built
+  seen := make([]int, maxLen)
+  stamp := 0
+
+  // appendClosure appends the unseen part of the closure of an acyclic entry.
+  // No entry of it can be on the way to the current one, so skipping the seen
+  // ones gives the order a walk from here would.
+  appendClosure := func(closure []int32, idx int32) []int32 {
+    for _, dep := range closures[idx] {
+      if seen[dep] != stamp {
+        seen[dep] = stamp
+        closure = append(closure, dep)
+      }
+    }
+    return closure
+  }
+
+  var resolve func(idx int32)
+  resolve = func(idx int32) {
+    state[idx] = visiting
+    for _, dep := range deps[idx] {
+      switch state[dep] {
+      case unvisited:
+        resolve(dep)
+      case visiting:
+        rich.Warning("Dependency cycle: %q depends on %q, which already depends on it.", c.Entries[idx].StrLabelCrc, c.Entries[dep].StrLabelCrc)
+        cyclic[idx] = true
+      }
+      if cyclic[dep] {
+        cyclic[idx] = true
+      }
+    }
+    state[idx] = resolved
+    if cyclic[idx] {
       return
     }
-    *ordDict = append(*ordDict, label)
-    revIdx, ok := revMap[label]
-    if !ok {
-      log.Panicf("Label: %q not inside revMap", label)
+    stamp++
+    seen[idx] = stamp
+    closure := []int32{idx}
+    for _, dep := range deps[idx] {
+      closure = appendClosure(closure, dep)
     }
-    revIdxEntry := &c.Entries[revIdx]
-    numDeps := revIdxEntry.NumDeps
-    for i := 0; i < int(numDeps); i++ {
-      depCrcs := binary.BigEndian.Uint64(revIdxEntry.DepCrcs[i*8:])
-      resolveRecursiveDeps(depCrcs, ordDict)
+    closures[idx] = closure
+  }
+
+  var walk func(idx int32, closure []int32) []int32
+  walk = func(idx int32, closure []int32) []int32 {
+    seen[idx] = stamp
+    closure = append(closure, idx)
+    for _, dep := range deps[idx] {
+      switch {
+      case seen[dep] == stamp:
+      case cyclic[dep]:
+        closure = walk(dep, closure)
+      default:
+        closure = appendClosure(closure, dep)
+      }
     }
+    return closure
   }
 
-  for i := 0; i < maxLen; i++ {
-    entry := &c.Entries[i]
-    buf := new(bytes.Buffer)
-    var ordDict []uint64
-    resolveRecursiveDeps(entry.LabelCrc, &ordDict)
-    binary.Write(buf, binary.BigEndian, ordDict)
-    entry.RecDepCrcs = buf.Bytes()
-    if len(c.Entries) > 16396 {
-      log.Default()
+  for i := range maxLen {
+    if state[i] == unvisited {
+      resolve(int32(i))
+    }
+  }
+
+  for i := range maxLen {
+    closure := closures[i]
+    if cyclic[i] {
+      stamp++
+      closure = walk(int32(i), nil)
+    }
+    recDeps := make([]byte, len(closure)*8)
+    for j, dep := range closure {
+      binary.BigEndian.PutUint64(recDeps[j*8:], c.Entries[dep].LabelCrc)
+    }
+    c.Entries[i].RecDepCrcs = recDeps
+  }
+}
+
+// DepClosure returns the entries of c which are in selected or a recursive
+// dependency of one of them, in catalog order. RecDepCrcs must be resolved.
+func (c *Catalog) DepClosure(selected []Entry) []Entry {
+  wanted := make(map[uint64]struct{})
+  for i := range selected {
+    wanted[selected[i].LabelCrc] = struct{}{}
+    deps := selected[i].RecDepCrcs
+    for off := 0; off+8 <= len(deps); off += 8 {
+      wanted[binary.BigEndian.Uint64(deps[off:])] = struct{}{}
+    }
+  }
+  closure := []Entry{}
+  for _, entry := range c.Entries {
+    if _, ok := wanted[entry.LabelCrc]; ok {
+      closure = append(closure, entry)
     }
   }
+  return closure
 }
 
 func (c *Catalog) ResolveAllRealNames() {
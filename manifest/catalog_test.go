@@ -0,0 +1,106 @@
+package manifest
+
+import (
+  "bytes"
+  "encoding/binary"
+  "slices"
+  "testing"
+)
+
+// resolveTestCatalog parses a catalog of entries named after their label,
+// each depending on deps[label], and resolves their dependencies.
+func resolveTestCatalog(labels []string, deps map[string][]string) *Catalog {
+  entries := make([]Entry, len(labels))
+  for i, label := range labels {
+    entries[i] = Entry{
+      ResourceType:       1,
+      StrTypeCrc:         "assetbundle",
+      StrLabelCrc:        label,
+      StrCategoryCrcs:    []string{},
+      StrContentTypeCrcs: []string{},
+      StrContentNameCrcs: []string{},
+      StrDepCrcs:         append([]string{}, deps[label]...),
+    }
+  }
+  buf := new(bytes.Buffer)
+  EncodeTransposedArray(entries, buf)
+  catalog := new(Catalog)
+  revMap := make(map[uint64]int)
+  catalog.ParseTransposedArray(buf, revMap)
+  catalog.ResolveAllDeps(revMap)
+  return catalog
+}
+
+// recDepLabels lists the labels of the recursive dependencies of every entry.
+func recDepLabels(c *Catalog) map[string][]string {
+  labels := make(map[uint64]string)
+  for _, entry := range c.Entries {
+    labels[entry.LabelCrc] = entry.StrLabelCrc
+  }
+  recDeps := make(map[string][]string)
+  for _, entry := range c.Entries {
+    names := []string{}
+    for off := 0; off+8 <= len(entry.RecDepCrcs); off += 8 {
+      names = append(names, labels[binary.BigEndian.Uint64(entry.RecDepCrcs[off:])])
+    }
+    recDeps[entry.StrLabelCrc] = names
+  }
+  return recDeps
+}
+
+func TestResolveAllDeps(t *testing.T) {
+  // e is shared by b and c, d by b and e
+  catalog := resolveTestCatalog(
+    []string{"f", "e", "d", "c", "b", "a"},
+    map[string][]string{
+      "a": {"b", "c"},
+      "b": {"d", "e"},
+      "c": {"e", "f"},
+      "e": {"d"},
+    },
+  )
+  got := recDepLabels(catalog)
+  for label, want := range map[string][]string{
+    "a": {"a", "b", "d", "e", "c", "f"},
+    "b": {"b", "d", "e"},
+    "c": {"c", "e", "d", "f"},
+    "d": {"d"},
+    "e": {"e", "d"},
+    "f": {"f"},
+  } {
+    if !slices.Equal(got[label], want) {
+      t.Errorf("%s depends on %v, want %v", label, got[label], want)
+    }
+  }
+}
+
+func TestResolveAllDepsCycle(t *testing.T) {
+  // x, y and z depend on each other, p reaches the cycle from outside
+  catalog := resolveTestCatalog(
+    []string{"p", "x", "y", "z", "w"},
+    map[string][]string{
+      "p": {"x"},
+      "x": {"y"},
+      "y": {"z"},
+      "z": {"x", "w"},
+    },
+  )
+  got := recDepLabels(catalog)
+  for label, want := range map[string][]string{
+    "p": {"p", "x", "y", "z", "w"},
+    "x": {"x", "y", "z", "w"},
+    "y": {"y", "z", "x", "w"},
+    "z": {"z", "x", "y", "w"},
+    "w": {"w"},
+  } {
+    if !slices.Equal(got[label], want) {
+      t.Errorf("%s depends on %v, want %v", label, got[label], want)
+    }
+  }
+
+  // an entry depending on itself lists itself once
+  catalog = resolveTestCatalog([]string{"s"}, map[string][]string{"s": {"s"}})
+  if got := recDepLabels(catalog)["s"]; !slices.Equal(got, []string{"s"}) {
+    t.Errorf("s depends on %v, want [s]", got)
+  }
+}
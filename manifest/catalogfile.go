@@ -0,0 +1,388 @@
+package manifest
+
+import (
+  "bytes"
+  "encoding/binary"
+  "errors"
+  "fmt"
+  "hash/crc32"
+  "os"
+  "sort"
+
+  "vertesan/hailstorm/crypto"
+
+  "github.com/goccy/go-json"
+)
+
+// A catalog file holds the entries of a catalog in far less space than JSON,
+// and is decoded entry by entry through a label index. Every string is stored
+// once, the CRC fields and RealName are derived from the strings again when
+// decoding. All integers are big endian.
+//
+//   header   magic "HSCF", version u16, reserved u16, entry count u32,
+//            string count u32, offsets u32 of strings, records and index
+//   strings  uvarint length followed by the bytes, for every string
+//   records  per entry: uvarints of label, type, priority, resource type,
+//            size, checksum u64, seed u64, uvarint NumRecDepCrcs, then the
+//            count and string ids of content types, categories, content
+//            names, dependencies and recursive dependencies
+//   index    record offset u32 of every entry, then the entry indexes u32
+//            sorted by label
+//   trailer  CRC-32 (IEEE) u32 of everything before
+const (
+  CATALOG_FILE_MAGIC   = "HSCF"
+  CATALOG_FILE_VERSION = 1
+
+  catalogFileHeaderSize = 28
+)
+
+// CatalogFile is a decoded catalog file. It is safe for concurrent use.
+type CatalogFile struct {
+  strs    []string
+  crc64s  []uint64
+  records []byte
+  offsets []byte
+  index   []byte
+}
+
+// EncodeCatalogFile serializes entries into a catalog file. Recursive
+// dependencies must be entries themselves, like in every resolved catalog.
+func EncodeCatalogFile(entries []Entry) ([]byte, error) {
+  strIds := make(map[string]uint64)
+  strs := new(bytes.Buffer)
+  strCount := 0
+  strId := func(s string) uint64 {
+    id, ok := strIds[s]
+    if !ok {
+      id = uint64(strCount)
+      strIds[s] = id
+      strs.Write(binary.AppendUvarint(nil, uint64(len(s))))
+      strs.WriteString(s)
+      strCount++
+    }
+    return id
+  }
+
+  labels := make(map[uint64]uint64, len(entries))
+  for i := range entries {
+    labels[entries[i].LabelCrc] = strId(entries[i].StrLabelCrc)
+  }
+
+  records := new(bytes.Buffer)
+  offsets := make([]byte, 0, len(entries)*4)
+  var scratch []byte
+  putUvarint := func(v uint64) {
+    scratch = binary.AppendUvarint(scratch[:0], v)
+    records.Write(scratch)
+  }
+  putStrs := func(values []string) {
+    putUvarint(uint64(len(values)))
+    for _, s := range values {
+      putUvarint(strId(s))
+    }
+  }
+
+  for i := range entries {
+    entry := &entries[i]
+    offsets = binary.BigEndian.AppendUint32(offsets, uint32(records.Len()))
+    putUvarint(labels[entry.LabelCrc])
+    putUvarint(strId(entry.StrTypeCrc))
+    putUvarint(uint64(entry.Priority))
+    putUvarint(uint64(entry.ResourceType))
+    putUvarint(entry.Size)
+    binary.Write(records, binary.BigEndian, entry.Checksum)
+    binary.Write(records, binary.BigEndian, entry.Seed)
+    putUvarint(uint64(entry.NumRecDepCrcs))
+    putStrs(entry.StrContentTypeCrcs)
+    putStrs(entry.StrCategoryCrcs)
+    putStrs(entry.StrContentNameCrcs)
+    putStrs(entry.StrDepCrcs)
+
+    putUvarint(uint64(len(entry.RecDepCrcs) / 8))
+    for off := 0; off+8 <= len(entry.RecDepCrcs); off += 8 {
+      label := binary.BigEndian.Uint64(entry.RecDepCrcs[off:])
+      id, ok := labels[label]
+      if !ok {
+        return nil, fmt.Errorf("dependency %X of %q is not in the catalog", label, entry.StrLabelCrc)
+      }
+      putUvarint(id)
+    }
+  }
+
+  sorted := make([]int, len(entries))
+  for i := range sorted {
+    sorted[i] = i
+  }
+  sort.SliceStable(sorted, func(a, b int) bool {
+    return entries[sorted[a]].StrLabelCrc < entries[sorted[b]].StrLabelCrc
+  })
+
+  strOff := catalogFileHeaderSize
+  recOff := strOff + strs.Len()
+  idxOff := recOff + records.Len()
+  buf := bytes.NewBuffer(make([]byte, 0, idxOff+len(entries)*8+4))
+  buf.WriteString(CATALOG_FILE_MAGIC)
+  for _, v := range []any{
+    uint16(CATALOG_FILE_VERSION),
+    uint16(0),
+    uint32(len(entries)),
+    uint32(strCount),
+    uint32(strOff),
+    uint32(recOff),
+    uint32(idxOff),
+  } {
+    binary.Write(buf, binary.BigEndian, v)
+  }
+  buf.Write(strs.Bytes())
+  buf.Write(records.Bytes())
+  buf.Write(offsets)
+  for _, idx := range sorted {
+    binary.Write(buf, binary.BigEndian, uint32(idx))
+  }
+  binary.Write(buf, binary.BigEndian, crc32.ChecksumIEEE(buf.Bytes()))
+  return buf.Bytes(), nil
+}
+
+// WriteCatalogFile writes entries as a catalog file at path. The file is
+// replaced at once, so it is never left half-written.
+func WriteCatalogFile(entries []Entry, path string) error {
+  data, err := EncodeCatalogFile(entries)
+  if err != nil {
+    return err
+  }
+  tmp := path + ".tmp"
+  if err := os.WriteFile(tmp, data, 0644); err != nil {
+    return err
+  }
+  return os.Rename(tmp, path)
+}
+
+// OpenCatalogFile reads the catalog file at path. Entries are only decoded
+// when asked for.
+func OpenCatalogFile(path string) (*CatalogFile, error) {
+  data, err := os.ReadFile(path)
+  if err != nil {
+    return nil, err
+  }
+  f, err := DecodeCatalogFile(data)
+  if err != nil {
+    return nil, fmt.Errorf("%s: %w", path, err)
+  }
+  return f, nil
+}
+
+// IsCatalogFile tells whether data starts like a catalog file.
+func IsCatalogFile(data []byte) bool {
+  return bytes.HasPrefix(data, []byte(CATALOG_FILE_MAGIC))
+}
+
+// DecodeCatalogFile checks data and decodes its string table.
+func DecodeCatalogFile(data []byte) (*CatalogFile, error) {
+  if len(data) < catalogFileHeaderSize+4 || !IsCatalogFile(data) {
+    return nil, errors.New("not a catalog file")
+  }
+  body := data[:len(data)-4]
+  if crc32.ChecksumIEEE(body) != binary.BigEndian.Uint32(data[len(body):]) {
+    return nil, errors.New("catalog file is corrupted, checksum mismatch")
+  }
+  if version := binary.BigEndian.Uint16(data[4:]); version != CATALOG_FILE_VERSION {
+    return nil, fmt.Errorf("unsupported catalog file version %d, expect %d", version, CATALOG_FILE_VERSION)
+  }
+  count := int(binary.BigEndian.Uint32(data[8:]))
+  strCount := int(binary.BigEndian.Uint32(data[12:]))
+  strOff := int(binary.BigEndian.Uint32(data[16:]))
+  recOff := int(binary.BigEndian.Uint32(data[20:]))
+  idxOff := int(binary.BigEndian.Uint32(data[24:]))
+  if strOff != catalogFileHeaderSize || recOff < strOff || idxOff < recOff || idxOff+count*8 != len(body) {
+    return nil, errors.New("catalog file is corrupted, bad section offsets")
+  }
+
+  f := &CatalogFile{
+    strs:    make([]string, strCount),
+    crc64s:  make([]uint64, strCount),
+    records: body[recOff:idxOff],
+    offsets: body[idxOff : idxOff+count*4],
+    index:   body[idxOff+count*4:],
+  }
+  // one allocation for every string, they are slices of it
+  table := string(body[strOff:recOff])
+  pos := 0
+  for i := range strCount {
+    n, read := binary.Uvarint(body[strOff+pos : recOff])
+    if read <= 0 || pos+read+int(n) > len(table) {
+      return nil, errors.New("catalog file is corrupted, bad string table")
+    }
+    pos += read
+    f.strs[i] = table[pos : pos+int(n)]
+    f.crc64s[i] = crypto.UpdateCrc64(0, body[strOff+pos:], int(n), nil)
+    pos += int(n)
+  }
+  for i := range count {
+    if int(binary.BigEndian.Uint32(f.offsets[i*4:])) >= len(f.records) || int(binary.BigEndian.Uint32(f.index[i*4:])) >= count {
+      return nil, errors.New("catalog file is corrupted, bad index")
+    }
+  }
+  return f, nil
+}
+
+func (f *CatalogFile) Len() int {
+  return len(f.offsets) / 4
+}
+
+// Entry decodes the entry at idx, in catalog order.
+func (f *CatalogFile) Entry(idx int) Entry {
+  r := catalogFileRecord{f: f, buf: f.records[binary.BigEndian.Uint32(f.offsets[idx*4:]):]}
+  label := r.uvarint()
+  entry := Entry{
+    StrLabelCrc:  f.str(label),
+    LabelCrc:     f.crc64(label),
+    StrTypeCrc:   f.str(r.uvarint()),
+    Priority:     uint32(r.uvarint()),
+    ResourceType: uint32(r.uvarint()),
+    Size:         r.uvarint(),
+    Checksum:     r.uint64(),
+    Seed:         r.uint64(),
+  }
+  entry.TypeCrc = crypto.UpdateCrc32(0, []byte(entry.StrTypeCrc), len(entry.StrTypeCrc))
+  entry.NumRecDepCrcs = uint32(r.uvarint())
+
+  for _, id := range r.ids() {
+    s := f.str(id)
+    entry.StrContentTypeCrcs = append(entry.StrContentTypeCrcs, s)
+    entry.ContentTypeCrcs = binary.BigEndian.AppendUint32(entry.ContentTypeCrcs, crypto.UpdateCrc32(0, []byte(s), len(s)))
+  }
+  for _, id := range r.ids() {
+    s := f.str(id)
+    entry.StrCategoryCrcs = append(entry.StrCategoryCrcs, s)
+    entry.CategoryCrcs = binary.BigEndian.AppendUint32(entry.CategoryCrcs, crypto.UpdateCrc32(0, []byte(s), len(s)))
+  }
+  for _, id := range r.ids() {
+    entry.StrContentNameCrcs = append(entry.StrContentNameCrcs, f.str(id))
+    entry.ContentNameCrcs = binary.BigEndian.AppendUint64(entry.ContentNameCrcs, f.crc64(id))
+  }
+  for _, id := range r.ids() {
+    entry.StrDepCrcs = append(entry.StrDepCrcs, f.str(id))
+    entry.DepCrcs = binary.BigEndian.AppendUint64(entry.DepCrcs, f.crc64(id))
+  }
+  if recDeps := r.ids(); len(recDeps) > 0 {
+    entry.RecDepCrcs = make([]byte, 0, len(recDeps)*8)
+    for _, id := range recDeps {
+      entry.RecDepCrcs = binary.BigEndian.AppendUint64(entry.RecDepCrcs, f.crc64(id))
+    }
+  }
+  entry.NumDeps = uint32(len(entry.StrDepCrcs))
+  entry.NumContents = uint32(len(entry.StrContentNameCrcs))
+  entry.NumCategories = uint32(len(entry.StrCategoryCrcs))
+  entry.RealName = GetRealName(entry.Checksum, entry.LabelCrc, entry.Size)
+  return entry
+}
+
+// Entries decodes every entry, in catalog order.
+func (f *CatalogFile) Entries() []Entry {
+  entries := make([]Entry, f.Len())
+  for i := range entries {
+    entries[i] = f.Entry(i)
+  }
+  return entries
+}
+
+// Lookup finds the entry labelled label through the index.
+func (f *CatalogFile) Lookup(label string) (Entry, bool) {
+  n := f.Len()
+  pos := sort.Search(n, func(i int) bool {
+    return f.label(f.indexAt(i)) >= label
+  })
+  if pos < n {
+    if idx := f.indexAt(pos); f.label(idx) == label {
+      return f.Entry(idx), true
+    }
+  }
+  return Entry{}, false
+}
+
+func (f *CatalogFile) indexAt(pos int) int {
+  return int(binary.BigEndian.Uint32(f.index[pos*4:]))
+}
+
+func (f *CatalogFile) label(idx int) string {
+  r := catalogFileRecord{f: f, buf: f.records[binary.BigEndian.Uint32(f.offsets[idx*4:]):]}
+  return f.str(r.uvarint())
+}
+
+func (f *CatalogFile) str(id uint64) string {
+  if id >= uint64(len(f.strs)) {
+    panic(fmt.Sprintf("catalog file is corrupted, string %d out of %d", id, len(f.strs)))
+  }
+  return f.strs[id]
+}
+
+func (f *CatalogFile) crc64(id uint64) uint64 {
+  f.str(id)
+  return f.crc64s[id]
+}
+
+// catalogFileRecord reads the fields of one record.
+type catalogFileRecord struct {
+  f   *CatalogFile
+  buf []byte
+}
+
+func (r *catalogFileRecord) uvarint() uint64 {
+  v, n := binary.Uvarint(r.buf)
+  if n <= 0 {
+    panic("catalog file is corrupted, truncated record")
+  }
+  r.buf = r.buf[n:]
+  return v
+}
+
+func (r *catalogFileRecord) uint64() uint64 {
+  if len(r.buf) < 8 {
+    panic("catalog file is corrupted, truncated record")
+  }
+  v := binary.BigEndian.Uint64(r.buf)
+  r.buf = r.buf[8:]
+  return v
+}
+
+func (r *catalogFileRecord) ids() []uint64 {
+  n := r.uvarint()
+  if n > uint64(len(r.buf)) {
+    panic("catalog file is corrupted, truncated record")
+  }
+  ids := make([]uint64, n)
+  for i := range ids {
+    ids[i] = r.uvarint()
+  }
+  return ids
+}
+
+// ReadCatalogFile decodes every entry of the catalog file at path.
+func ReadCatalogFile(path string) ([]Entry, error) {
+  f, err := OpenCatalogFile(path)
+  if err != nil {
+    return nil, err
+  }
+  return f.Entries(), nil
+}
+
+// LoadCatalogEntries reads the entries at path, either a catalog file or the
+// JSON export written by earlier versions.
+func LoadCatalogEntries(path string) ([]Entry, error) {
+  data, err := os.ReadFile(path)
+  if err != nil {
+    return nil, err
+  }
+  if IsCatalogFile(data) {
+    f, err := DecodeCatalogFile(data)
+    if err != nil {
+      return nil, fmt.Errorf("%s: %w", path, err)
+    }
+    return f.Entries(), nil
+  }
+  entries := []Entry{}
+  if err := json.Unmarshal(data, &entries); err != nil {
+    return nil, fmt.Errorf("%s: %w", path, err)
+  }
+  return entries, nil
+}
@@ -0,0 +1,96 @@
+package manifest
+
+import (
+  "bytes"
+  "os"
+  "path/filepath"
+  "reflect"
+  "testing"
+
+  "vertesan/hailstorm/utils"
+)
+
+// resolvedTestEntries are the test entries as parsed from a catalog, with
+// their recursive dependencies and real names.
+func resolvedTestEntries() []Entry {
+  buf := new(bytes.Buffer)
+  EncodeTransposedArray(testEntries(), buf)
+  catalog := new(Catalog)
+  revMap := make(map[uint64]int)
+  catalog.ParseTransposedArray(buf, revMap)
+  catalog.ResolveAllDeps(revMap)
+  catalog.ResolveAllRealNames()
+  return catalog.Entries
+}
+
+func TestCatalogFileRoundTrip(t *testing.T) {
+  entries := resolvedTestEntries()
+  path := filepath.Join(t.TempDir(), "catalog.bin")
+  if err := WriteCatalogFile(entries, path); err != nil {
+    t.Fatal(err)
+  }
+  got, err := LoadCatalogEntries(path)
+  if err != nil {
+    t.Fatal(err)
+  }
+  if !reflect.DeepEqual(got, entries) {
+    t.Fatalf("read back\n%+v, want\n%+v", got, entries)
+  }
+
+  f, err := OpenCatalogFile(path)
+  if err != nil {
+    t.Fatal(err)
+  }
+  if f.Len() != len(entries) {
+    t.Fatalf("catalog file has %d entries, want %d", f.Len(), len(entries))
+  }
+  for _, want := range entries {
+    entry, ok := f.Lookup(want.StrLabelCrc)
+    if !ok || !reflect.DeepEqual(entry, want) {
+      t.Errorf("lookup of %q gives %+v", want.StrLabelCrc, entry)
+    }
+  }
+  if _, ok := f.Lookup("missing"); ok {
+    t.Error("missing label was found")
+  }
+}
+
+func TestCatalogFileCorrupted(t *testing.T) {
+  data, err := EncodeCatalogFile(resolvedTestEntries())
+  if err != nil {
+    t.Fatal(err)
+  }
+  if !IsCatalogFile(data) || IsCatalogFile([]byte("[]")) {
+    t.Fatal("IsCatalogFile does not tell catalog files")
+  }
+  for i := range data {
+    corrupted := bytes.Clone(data)
+    corrupted[i] ^= 0x01
+    if _, err := DecodeCatalogFile(corrupted); err == nil {
+      t.Errorf("catalog file with byte %d flipped was decoded", i)
+    }
+  }
+  if _, err := DecodeCatalogFile(data[:len(data)-1]); err == nil {
+    t.Error("truncated catalog file was decoded")
+  }
+}
+
+func TestLoadCatalogEntriesJson(t *testing.T) {
+  entries := resolvedTestEntries()
+  path := filepath.Join(t.TempDir(), "catalog.json")
+  utils.WriteToJsonFile(entries, path)
+  got, err := LoadCatalogEntries(path)
+  if err != nil {
+    t.Fatal(err)
+  }
+  if !reflect.DeepEqual(got, entries) {
+    t.Errorf("read back\n%+v, want\n%+v", got, entries)
+  }
+
+  if err := os.WriteFile(path, []byte("{broken"), 0o644); err != nil {
+    t.Fatal(err)
+  }
+  if _, err := LoadCatalogEntries(path); err == nil {
+    t.Error("broken JSON was loaded")
+  }
+}
@@ -0,0 +1,132 @@
+package manifest
+
+import (
+  "bytes"
+  "encoding/base64"
+  "encoding/binary"
+  "io"
+
+  "vertesan/hailstorm/crypto"
+  "vertesan/hailstorm/rich"
+
+  "github.com/pierrec/lz4/v4"
+)
+
+// EncodeCatalog is the inverse of Catalog.Init. It serializes entries into the
+// CA01 layout, compresses and encrypts it the way catalogs are served. m must
+// hold the Seed, SimpleResver and ClientVersion of the catalog, everything
+// else is filled from the result, so that m.ResHeader() gives the matching
+// resInfo. The checksum is the CRC-64 manifest.VerifyFile checks first, the
+// one of the official origin is not known.
+func EncodeCatalog(entries []Entry, m *Manifest) []byte {
+  plain := new(bytes.Buffer)
+  EncodeTransposedArray(entries, plain)
+
+  m.Type = CATALOG
+  m.CalcCrc64Name = m.ClientVersion + ":" + m.SimpleResver
+  blob := new(bytes.Buffer)
+  EncodeAsset(&m.Asset, blob, plain)
+
+  m.Checksum = crypto.UpdateCrc64(0, blob.Bytes(), blob.Len(), nil)
+  m.LabelCrc = crypto.UpdateCrc64(0, []byte(m.SimpleResver), len(m.SimpleResver), nil)
+  m.RealName = GetRealName(m.Checksum, m.LabelCrc, m.Size)
+  return blob.Bytes()
+}
+
+// ResHeader is the inverse of Manifest.Init, like `R2402010@B/FicABV0d3BUb8PQHvXSsDwHw==`.
+func (m *Manifest) ResHeader() string {
+  buf := new(bytes.Buffer)
+  binary.Write(buf, binary.BigEndian, m.Checksum)
+  binary.Write(buf, binary.BigEndian, m.Seed)
+  buf.Write(binary.AppendUvarint(nil, m.Size))
+  return m.SimpleResver + "@" + base64.StdEncoding.EncodeToString(buf.Bytes())
+}
+
+// EncodeTransposedArray writes entries in the transposed CA01 layout read by
+// Catalog.ParseTransposedArray. Only the string fields are written, the CRC
+// fields are derived from them when parsing. Nonzero seeds whose first byte is
+// zero are read back with their top bit set, which derives the same key.
+func EncodeTransposedArray(entries []Entry, dst io.Writer) {
+  buf := new(bytes.Buffer)
+  binary.Write(buf, binary.BigEndian, uint16(0xCA01))
+  binary.Write(buf, binary.BigEndian, uint16(0))
+  buf.Write(binary.AppendUvarint(nil, uint64(len(entries))))
+
+  for i := range entries {
+    entry := &entries[i]
+    if len(entry.StrContentTypeCrcs) != len(entry.StrContentNameCrcs) {
+      rich.Panic("Entry %q has %d content types but %d content names.", entry.StrLabelCrc, len(entry.StrContentTypeCrcs), len(entry.StrContentNameCrcs))
+    }
+  }
+
+  uvarints := []func(e *Entry) uint64{
+    func(e *Entry) uint64 { return uint64(e.Priority) },
+    func(e *Entry) uint64 { return uint64(e.ResourceType) },
+    func(e *Entry) uint64 { return uint64(len(e.StrDepCrcs)) },
+    func(e *Entry) uint64 { return uint64(len(e.StrContentNameCrcs)) },
+    func(e *Entry) uint64 { return uint64(len(e.StrCategoryCrcs)) },
+    func(e *Entry) uint64 { return e.Size },
+  }
+  for _, field := range uvarints {
+    for i := range entries {
+      buf.Write(binary.AppendUvarint(nil, field(&entries[i])))
+    }
+  }
+
+  strs := []func(e *Entry) []string{
+    func(e *Entry) []string { return []string{e.StrTypeCrc} },
+    func(e *Entry) []string { return e.StrContentTypeCrcs },
+    func(e *Entry) []string { return e.StrCategoryCrcs },
+    func(e *Entry) []string { return []string{e.StrLabelCrc} },
+    func(e *Entry) []string { return e.StrContentNameCrcs },
+    func(e *Entry) []string { return e.StrDepCrcs },
+  }
+  for _, field := range strs {
+    for i := range entries {
+      for _, s := range field(&entries[i]) {
+        buf.WriteString(s)
+        buf.WriteByte(0x00)
+      }
+    }
+  }
+
+  for i := range entries {
+    binary.Write(buf, binary.BigEndian, entries[i].Checksum)
+  }
+  for i := range entries {
+    // seeds are serialized in 8 bytes only when the first one is nonzero.
+    // DeriveKeyIV drops the top bit of raw seeds, setting it leaves the key
+    // unchanged for seeds whose first byte is zero.
+    seed := entries[i].Seed
+    switch {
+    case seed == 0:
+      buf.WriteByte(0x00)
+      continue
+    case seed>>56 == 0:
+      seed |= 1 << 63
+    }
+    binary.Write(buf, binary.BigEndian, seed)
+  }
+
+  if _, err := dst.Write(buf.Bytes()); err != nil {
+    panic(err)
+  }
+}
+
+// EncodeAsset is the inverse of DecodeAsset: src is compressed with LZ4, padded
+// with PKCS7 and encrypted with AES-CBC under the key and IV derived from
+// asset. The derivation depends on the size of the ciphertext, which is set
+// into asset.Size, so src is compressed in memory before anything is written.
+func EncodeAsset(asset *Asset, dst io.Writer, src io.Reader) {
+  compressed := new(bytes.Buffer)
+  lz4Writer := lz4.NewWriter(compressed)
+  if _, err := io.Copy(lz4Writer, src); err != nil {
+    panic(err)
+  }
+  if err := lz4Writer.Close(); err != nil {
+    panic(err)
+  }
+  asset.Size = uint64(crypto.PaddedSize(compressed.Len()))
+  key, iv := DeriveKeyIV(asset)
+  crypto.Encrypt(key, iv, compressed, dst)
+}
@@ -0,0 +1,129 @@
+package manifest
+
+import (
+  "bytes"
+  "slices"
+  "testing"
+
+  "vertesan/hailstorm/crypto"
+)
+
+func testEntries() []Entry {
+  return []Entry{
+    {
+      Priority:           3,
+      ResourceType:       192,
+      Size:               1234,
+      Checksum:           0x0123456789ABCDEF,
+      Seed:               0xCF222F1FE0748978,
+      StrTypeCrc:         "tsv",
+      StrCategoryCrcs:    []string{"master"},
+      StrLabelCrc:        "advalbums.tsv",
+      StrContentTypeCrcs: []string{},
+      StrContentNameCrcs: []string{},
+      StrDepCrcs:         []string{},
+    },
+    {
+      ResourceType:       1,
+      Size:               1 << 20,
+      Checksum:           0xFEDCBA9876543210,
+      StrTypeCrc:         "assetbundle",
+      StrCategoryCrcs:    []string{},
+      StrLabelCrc:        "img_card_full_1",
+      StrContentTypeCrcs: []string{"Texture2D", "Sprite"},
+      StrContentNameCrcs: []string{"card_full_1", "card_full_1_sprite"},
+      StrDepCrcs:         []string{"advalbums.tsv"},
+    },
+    {
+      // the first byte of the seed is zero
+      Priority:           1,
+      ResourceType:       192,
+      Size:               7,
+      Checksum:           42,
+      Seed:               0x0000ABCDEF012345,
+      StrTypeCrc:         "tsv",
+      StrCategoryCrcs:    []string{},
+      StrLabelCrc:        "musics.tsv",
+      StrContentTypeCrcs: []string{},
+      StrContentNameCrcs: []string{},
+      StrDepCrcs:         []string{"advalbums.tsv", "img_card_full_1"},
+    },
+  }
+}
+
+func checkEntries(t *testing.T, got []Entry, want []Entry) {
+  t.Helper()
+  if len(got) != len(want) {
+    t.Fatalf("parsed %d entries, want %d", len(got), len(want))
+  }
+  for i := range want {
+    g, w := &got[i], &want[i]
+    if g.Priority != w.Priority || g.ResourceType != w.ResourceType || g.Size != w.Size || g.Checksum != w.Checksum {
+      t.Errorf("entry %d is %+v, want %+v", i, g, w)
+    }
+    if g.StrTypeCrc != w.StrTypeCrc || g.StrLabelCrc != w.StrLabelCrc ||
+      !slices.Equal(g.StrCategoryCrcs, w.StrCategoryCrcs) ||
+      !slices.Equal(g.StrContentTypeCrcs, w.StrContentTypeCrcs) ||
+      !slices.Equal(g.StrContentNameCrcs, w.StrContentNameCrcs) ||
+      !slices.Equal(g.StrDepCrcs, w.StrDepCrcs) {
+      t.Errorf("strings of entry %d are %+v, want %+v", i, g, w)
+    }
+    if g.NumDeps != uint32(len(w.StrDepCrcs)) || g.NumContents != uint32(len(w.StrContentNameCrcs)) || g.NumCategories != uint32(len(w.StrCategoryCrcs)) {
+      t.Errorf("counts of entry %d are %d/%d/%d", i, g.NumDeps, g.NumContents, g.NumCategories)
+    }
+    if crc := crypto.UpdateCrc64(0, []byte(w.StrLabelCrc), len(w.StrLabelCrc), nil); g.LabelCrc != crc {
+      t.Errorf("label CRC of entry %d is %X, want %X", i, g.LabelCrc, crc)
+    }
+    // only the lower 63 bits are kept
+    if g.Seed&0x7FFFFFFFFFFFFFFF != w.Seed&0x7FFFFFFFFFFFFFFF {
+      t.Errorf("seed of entry %d is %X, want %X", i, g.Seed, w.Seed)
+    }
+    if g.Seed != w.Seed && w.Seed>>56 != 0 {
+      t.Errorf("seed %X of entry %d was changed to %X", w.Seed, i, g.Seed)
+    }
+  }
+}
+
+func TestEncodeTransposedArray(t *testing.T) {
+  entries := testEntries()
+  buf := new(bytes.Buffer)
+  EncodeTransposedArray(entries, buf)
+
+  catalog := new(Catalog)
+  revMap := make(map[uint64]int)
+  catalog.ParseTransposedArray(buf, revMap)
+  checkEntries(t, catalog.Entries, entries)
+  if len(revMap) != len(entries) {
+    t.Errorf("revMap has %d labels, want %d", len(revMap), len(entries))
+  }
+
+  // the normalized seed derives the same key
+  wantKey, _ := DeriveKeyIV(&Asset{Seed: entries[2].Seed, Size: 7, CalcCrc64Name: "musics.tsv", Type: RAW})
+  gotKey, _ := DeriveKeyIV(&Asset{Seed: catalog.Entries[2].Seed, Size: 7, CalcCrc64Name: "musics.tsv", Type: RAW})
+  if !bytes.Equal(gotKey, wantKey) {
+    t.Error("the normalized seed derives another key")
+  }
+}
+
+func TestEncodeCatalog(t *testing.T) {
+  entries := testEntries()
+  m := &Manifest{
+    Asset:         Asset{Seed: 0x5EED5EED5EED5EED},
+    SimpleResver:  "R2402010",
+    ClientVersion: "1.0.0",
+  }
+  blob := EncodeCatalog(entries, m)
+
+  mani := new(Manifest)
+  mani.Init(m.ResHeader(), m.ClientVersion)
+  if mani.RealName != m.RealName || mani.Size != uint64(len(blob)) {
+    t.Fatalf("manifest of %q is %q of %d bytes, want %q of %d bytes", m.ResHeader(), mani.RealName, mani.Size, m.RealName, len(blob))
+  }
+  catalog := new(Catalog)
+  catalog.Init(mani, bytes.NewReader(blob))
+  checkEntries(t, catalog.Entries, entries)
+  // the second entry depends on the first one
+  if n := len(catalog.Entries[1].RecDepCrcs) / 8; n != 2 {
+    t.Errorf("entry 1 has %d recursive dependencies, want 2", n)
+  }
+}
@@ -4,6 +4,7 @@ import (
   "bytes"
   "encoding/base64"
   "encoding/binary"
+  "fmt"
   "strings"
 
   "vertesan/hailstorm/crypto"
@@ -20,32 +21,40 @@ type Manifest struct {
 
 // resHeader: something like `R2402010@B/FicABV0d3BUb8PQHvXSsDwHw==`
 func (m *Manifest) Init(resHeader string, clientVer string) {
+  parsed, err := ParseResInfo(resHeader, clientVer)
+  if err != nil {
+    rich.Panic("%v", err)
+  }
+  *m = *parsed
+
+  rich.Info("Initialize manifest completed.")
+  rich.Info("Manifest realname: %q.", m.RealName)
+}
+
+// ParseResInfo decodes resHeader like Init does, without logging anything.
+func ParseResInfo(resHeader string, clientVer string) (*Manifest, error) {
+  m := &Manifest{}
   m.Type = CATALOG
   m.ClientVersion = clientVer
   splitted := strings.Split(resHeader, "@")
   if len(splitted) != 2 {
-    rich.Panic("resHeader %q cannot be splitted by `@`", resHeader)
+    return nil, fmt.Errorf("resHeader %q cannot be splitted by `@`", resHeader)
   }
   m.SimpleResver = splitted[0]
   decoded, err := base64.StdEncoding.DecodeString(splitted[1])
   if err != nil {
-    panic(err)
+    return nil, fmt.Errorf("resHeader %q is not valid base64 after `@`: %v", resHeader, err)
   }
   reader := bytes.NewReader(decoded)
 
-  err = binary.Read(reader, binary.BigEndian, &m.Checksum)
-  if err != nil {
-    panic(err)
+  if err := binary.Read(reader, binary.BigEndian, &m.Checksum); err != nil {
+    return nil, fmt.Errorf("resHeader %q is too short for a checksum: %v", resHeader, err)
   }
-
-  err = binary.Read(reader, binary.BigEndian, &m.Seed)
-  if err != nil {
-    panic(err)
+  if err := binary.Read(reader, binary.BigEndian, &m.Seed); err != nil {
+    return nil, fmt.Errorf("resHeader %q is too short for a seed: %v", resHeader, err)
   }
-
-  m.Size, err = binary.ReadUvarint(reader)
-  if err != nil {
-    panic(err)
+  if m.Size, err = binary.ReadUvarint(reader); err != nil {
+    return nil, fmt.Errorf("resHeader %q is too short for a size: %v", resHeader, err)
   }
 
   m.LabelCrc = crypto.UpdateCrc64(0, []byte(m.SimpleResver), len(m.SimpleResver), nil)
@@ -53,7 +62,5 @@ func (m *Manifest) Init(resHeader string, clientVer string) {
   m.RealName = GetRealName(m.Checksum, m.LabelCrc, m.Size)
 
   m.CalcCrc64Name = m.ClientVersion + ":" + m.SimpleResver
-
-  rich.Info("Initialize manifest completed.")
-  rich.Info("Manifest realname: %q.", m.RealName)
+  return m, nil
 }
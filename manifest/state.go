@@ -0,0 +1,117 @@
+package manifest
+
+import (
+  "encoding/json"
+  "errors"
+  "os"
+  "sync"
+)
+
+// STATE_AUTOSAVE is the number of records after which State saves itself, so
+// that a killed run loses little of its progress.
+const STATE_AUTOSAVE = 64
+
+// StateEntry describes the entry a plain file was produced from.
+type StateEntry struct {
+  Checksum uint64 `json:"checksum"`
+  Size     uint64 `json:"size"`
+}
+
+// State records, per label, the entry each file of the plain directory was
+// produced from. Unlike a catalog diff, it stays correct whatever happened to
+// the previous run. It is safe for concurrent use, and a nil *State records
+// nothing.
+type State struct {
+  mu      sync.Mutex
+  path    string
+  entries map[string]StateEntry
+  dirty   int
+}
+
+// LoadState reads the state stored at path, a missing file gives an empty
+// state.
+func LoadState(path string) (*State, error) {
+  s := &State{
+    path:    path,
+    entries: make(map[string]StateEntry),
+  }
+  raw, err := os.ReadFile(path)
+  if err != nil {
+    if errors.Is(err, os.ErrNotExist) {
+      return s, nil
+    }
+    return nil, err
+  }
+  if err := json.Unmarshal(raw, &s.entries); err != nil {
+    return nil, err
+  }
+  return s, nil
+}
+
+func (s *State) Len() int {
+  s.mu.Lock()
+  defer s.mu.Unlock()
+  return len(s.entries)
+}
+
+// Fresh tells whether the plain file of entry inside plainDir exists and was
+// produced from the same checksum.
+func (s *State) Fresh(entry *Entry, plainDir string) bool {
+  if s == nil {
+    return false
+  }
+  s.mu.Lock()
+  recorded, ok := s.entries[entry.StrLabelCrc]
+  s.mu.Unlock()
+  if !ok || recorded.Checksum != entry.Checksum || recorded.Size != entry.Size {
+    return false
+  }
+  _, err := os.Stat(plainDir + "/" + PlainName(entry))
+  return err == nil
+}
+
+// Record marks the plain file of entry as produced from it. The error is the
+// one of the autosave, the record itself is kept anyway.
+func (s *State) Record(entry *Entry) error {
+  if s == nil {
+    return nil
+  }
+  s.mu.Lock()
+  s.entries[entry.StrLabelCrc] = StateEntry{
+    Checksum: entry.Checksum,
+    Size:     entry.Size,
+  }
+  s.dirty++
+  autosave := s.dirty >= STATE_AUTOSAVE
+  s.mu.Unlock()
+  if autosave {
+    return s.Save()
+  }
+  return nil
+}
+
+// Save writes the state if anything was recorded since the last save. The
+// file is replaced at once, so it is never left half-written.
+func (s *State) Save() error {
+  if s == nil {
+    return nil
+  }
+  s.mu.Lock()
+  defer s.mu.Unlock()
+  if s.dirty == 0 {
+    return nil
+  }
+  raw, err := json.Marshal(s.entries)
+  if err != nil {
+    return err
+  }
+  tmp := s.path + ".tmp"
+  if err := os.WriteFile(tmp, raw, 0644); err != nil {
+    return err
+  }
+  if err := os.Rename(tmp, s.path); err != nil {
+    return err
+  }
+  s.dirty = 0
+  return nil
+}
@@ -0,0 +1,194 @@
+package manifest
+
+import (
+  "bufio"
+  "hash"
+  "hash/crc64"
+  "io"
+  "os"
+  "sort"
+  "sync"
+
+  "vertesan/hailstorm/crypto"
+  "vertesan/hailstorm/rich"
+)
+
+type VerifyStatus string
+
+const (
+  // size and checksum both match
+  VerifyOk VerifyStatus = "ok"
+  // size matches, but the checksum algorithm of this resource type is not derived yet
+  VerifySizeOnly         VerifyStatus = "size-only"
+  VerifySizeMismatch     VerifyStatus = "size-mismatch"
+  VerifyChecksumMismatch VerifyStatus = "checksum-mismatch"
+  VerifyReadError        VerifyStatus = "read-error"
+)
+
+type VerifyResult struct {
+  Label        string       `json:"label"`
+  RealName     string       `json:"realName"`
+  ResourceType uint32       `json:"resourceType"`
+  Status       VerifyStatus `json:"status"`
+  ExpectedSize uint64       `json:"expectedSize"`
+  ActualSize   uint64       `json:"actualSize"`
+  Algorithm    string       `json:"algorithm,omitempty"`
+  Attempts     int          `json:"attempts,omitempty"`
+}
+
+func (r VerifyResult) Ok() bool {
+  return r.Status == VerifyOk || r.Status == VerifySizeOnly
+}
+
+// The catalog does not tell how Entry.Checksum is computed. Every candidate is
+// evaluated against downloaded files, and the first one that matches is taken
+// as the algorithm of that resource type from then on. Until that happens only
+// the size can be verified, so that an unknown algorithm never turns into an
+// endless re-download.
+var checksumCandidates = []struct {
+  name string
+  new  func() hash.Hash64
+}{
+  {"crc64-ecma182", func() hash.Hash64 { return &crc64Digest{} }},
+  {"crc64-ecma", func() hash.Hash64 { return crc64.New(crc64.MakeTable(crc64.ECMA)) }},
+  {"crc64-iso", func() hash.Hash64 { return crc64.New(crc64.MakeTable(crc64.ISO)) }},
+}
+
+var (
+  derivedMu   sync.RWMutex
+  derivedAlgo = make(map[uint32]string)
+)
+
+// DerivedChecksumAlgorithm returns the checksum algorithm derived so far for
+// resourceType, or an empty string.
+func DerivedChecksumAlgorithm(resourceType uint32) string {
+  derivedMu.RLock()
+  defer derivedMu.RUnlock()
+  return derivedAlgo[resourceType]
+}
+
+// Verifier is an io.Writer which checks everything written to it against the
+// Size and Checksum of an entry.
+type Verifier struct {
+  entry  *Entry
+  size   uint64
+  hashes map[string]hash.Hash64
+}
+
+func NewVerifier(entry *Entry) *Verifier {
+  v := &Verifier{
+    entry:  entry,
+    hashes: make(map[string]hash.Hash64, len(checksumCandidates)),
+  }
+  algo := DerivedChecksumAlgorithm(entry.ResourceType)
+  for _, candidate := range checksumCandidates {
+    if algo == "" || algo == candidate.name {
+      v.hashes[candidate.name] = candidate.new()
+    }
+  }
+  return v
+}
+
+func (v *Verifier) Write(p []byte) (int, error) {
+  v.size += uint64(len(p))
+  for _, h := range v.hashes {
+    h.Write(p)
+  }
+  return len(p), nil
+}
+
+func (v *Verifier) Result() VerifyResult {
+  result := VerifyResult{
+    Label:        v.entry.StrLabelCrc,
+    RealName:     v.entry.RealName,
+    ResourceType: v.entry.ResourceType,
+    ExpectedSize: v.entry.Size,
+    ActualSize:   v.size,
+  }
+  if v.size != v.entry.Size {
+    result.Status = VerifySizeMismatch
+    return result
+  }
+
+  if algo := DerivedChecksumAlgorithm(v.entry.ResourceType); algo != "" {
+    result.Algorithm = algo
+    if h, ok := v.hashes[algo]; ok && h.Sum64() == v.entry.Checksum {
+      result.Status = VerifyOk
+    } else {
+      result.Status = VerifyChecksumMismatch
+    }
+    return result
+  }
+
+  names := make([]string, 0, len(v.hashes))
+  for name := range v.hashes {
+    names = append(names, name)
+  }
+  sort.Strings(names)
+  for _, name := range names {
+    if v.hashes[name].Sum64() != v.entry.Checksum {
+      continue
+    }
+    derivedMu.Lock()
+    if _, exists := derivedAlgo[v.entry.ResourceType]; !exists {
+      derivedAlgo[v.entry.ResourceType] = name
+      rich.Info("Derived checksum algorithm %q for resource type %d.", name, v.entry.ResourceType)
+    }
+    derivedMu.Unlock()
+    result.Algorithm = name
+    result.Status = VerifyOk
+    return result
+  }
+  result.Status = VerifySizeOnly
+  return result
+}
+
+// VerifyFile checks the file at path against the Size and Checksum of entry.
+func VerifyFile(entry *Entry, path string) VerifyResult {
+  v := NewVerifier(entry)
+  fs, err := os.Open(path)
+  if err != nil {
+    result := v.Result()
+    result.Status = VerifyReadError
+    return result
+  }
+  defer fs.Close()
+  if _, err := io.Copy(v, bufio.NewReader(fs)); err != nil {
+    result := v.Result()
+    result.Status = VerifyReadError
+    return result
+  }
+  return v.Result()
+}
+
+// crc64Digest adapts crypto.UpdateCrc64, the same CRC-64 used for label
+// hashes, to hash.Hash64.
+type crc64Digest struct {
+  crc uint64
+}
+
+func (d *crc64Digest) Write(p []byte) (int, error) {
+  d.crc = crypto.UpdateCrc64(d.crc, p, len(p), nil)
+  return len(p), nil
+}
+
+func (d *crc64Digest) Sum(b []byte) []byte {
+  s := d.Sum64()
+  return append(b, byte(s>>56), byte(s>>48), byte(s>>40), byte(s>>32), byte(s>>24), byte(s>>16), byte(s>>8), byte(s))
+}
+
+func (d *crc64Digest) Sum64() uint64 {
+  return d.crc
+}
+
+func (d *crc64Digest) Reset() {
+  d.crc = 0
+}
+
+func (d *crc64Digest) Size() int {
+  return 8
+}
+
+func (d *crc64Digest) BlockSize() int {
+  return 1
+}
@@ -0,0 +1,140 @@
+package network
+
+import (
+  "crypto/tls"
+  "crypto/x509"
+  "fmt"
+  "net/http"
+  "net/url"
+  "os"
+  "strings"
+  "sync"
+  "time"
+)
+
+// ClientConfig describes how every outbound request of this package is made.
+type ClientConfig struct {
+  // Proxy URL like "http://127.0.0.1:7890" or "socks5://127.0.0.1:1080". The
+  // HTTP_PROXY, HTTPS_PROXY and NO_PROXY environment variables are used when
+  // empty.
+  Proxy string
+  // PEM files whose certificates are trusted on top of the system roots.
+  CAFiles []string
+  // Reuse connections between requests.
+  KeepAlive bool
+  // Time limit for downloading a single file.
+  DownloadTimeout time.Duration
+  // Time limit for the other requests, like login.
+  RequestTimeout time.Duration
+  // Replaces the User-Agent of every request when set.
+  UserAgent string
+}
+
+func DefaultClientConfig() ClientConfig {
+  return ClientConfig{
+    // As of 2024.2, the largest file size is 363MB (one of the feslive videos),
+    // make sure this value is large enough for downloading large files.
+    DownloadTimeout: 1200 * time.Second,
+    RequestTimeout:  30 * time.Second,
+  }
+}
+
+var (
+  clientMu      sync.RWMutex
+  assetClient   *http.Client
+  requestClient *http.Client
+)
+
+func init() {
+  if err := ConfigureClient(DefaultClientConfig()); err != nil {
+    panic(err)
+  }
+}
+
+// ConfigureClient rebuilds the clients used by every request of this package.
+// Unset durations fall back to DefaultClientConfig.
+func ConfigureClient(cfg ClientConfig) error {
+  defaults := DefaultClientConfig()
+  if cfg.DownloadTimeout <= 0 {
+    cfg.DownloadTimeout = defaults.DownloadTimeout
+  }
+  if cfg.RequestTimeout <= 0 {
+    cfg.RequestTimeout = defaults.RequestTimeout
+  }
+  transport, err := NewTransport(cfg)
+  if err != nil {
+    return err
+  }
+  clientMu.Lock()
+  defer clientMu.Unlock()
+  assetClient = &http.Client{
+    Timeout:   cfg.DownloadTimeout,
+    Transport: transport,
+  }
+  requestClient = &http.Client{
+    Timeout:   cfg.RequestTimeout,
+    Transport: transport,
+  }
+  return nil
+}
+
+// NewTransport builds the http.RoundTripper described by cfg, timeouts aside.
+func NewTransport(cfg ClientConfig) (http.RoundTripper, error) {
+  transport := http.DefaultTransport.(*http.Transport).Clone()
+  transport.Proxy = http.ProxyFromEnvironment
+  if proxy := strings.TrimSpace(cfg.Proxy); proxy != "" {
+    proxyUrl, err := url.Parse(proxy)
+    if err != nil || proxyUrl.Host == "" {
+      return nil, fmt.Errorf("invalid proxy %q", proxy)
+    }
+    transport.Proxy = http.ProxyURL(proxyUrl)
+  }
+  if len(cfg.CAFiles) > 0 {
+    pool, err := x509.SystemCertPool()
+    if err != nil {
+      pool = x509.NewCertPool()
+    }
+    for _, caFile := range cfg.CAFiles {
+      pem, err := os.ReadFile(caFile)
+      if err != nil {
+        return nil, err
+      }
+      if !pool.AppendCertsFromPEM(pem) {
+        return nil, fmt.Errorf("no certificate found in %q", caFile)
+      }
+    }
+    transport.TLSClientConfig = &tls.Config{RootCAs: pool}
+  }
+  transport.DisableKeepAlives = !cfg.KeepAlive
+  transport.MaxIdleConnsPerHost = MAX_CONCURRENCY
+  if cfg.UserAgent == "" {
+    return transport, nil
+  }
+  return &userAgentTransport{transport, cfg.UserAgent}, nil
+}
+
+// userAgentTransport overrides the User-Agent of every request.
+type userAgentTransport struct {
+  base      http.RoundTripper
+  userAgent string
+}
+
+func (t *userAgentTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+  req = req.Clone(req.Context())
+  req.Header.Set("User-Agent", t.userAgent)
+  return t.base.RoundTrip(req)
+}
+
+// downloadClient is used for assets and the manifest.
+func downloadClient() *http.Client {
+  clientMu.RLock()
+  defer clientMu.RUnlock()
+  return assetClient
+}
+
+// apiClient is used for every other request.
+func apiClient() *http.Client {
+  clientMu.RLock()
+  defer clientMu.RUnlock()
+  return requestClient
+}
@@ -3,36 +3,30 @@ package network
 import (
   "bufio"
   "context"
+  "errors"
   "fmt"
+  "io"
   "net/http"
   "os"
   "path"
+  "slices"
+  "strconv"
+  "strings"
   "sync"
   "time"
 
+  "golang.org/x/sync/errgroup"
+
   "vertesan/hailstorm/manifest"
   "vertesan/hailstorm/rich"
-
-  "golang.org/x/sync/semaphore"
 )
 
 const MAX_CONCURRENCY = 10
 const MAX_RETRIES = 3
-const ORIGIN = "https://assets.link-like-lovelive.app"
+const PART_SUFFIX = ".part"
 
-var (
-  ctx       = context.Background()
-  transport = &http.Transport{
-    DisableKeepAlives: true,
-  }
-  client = &http.Client{
-    // Timeout seconds for downloading a single file.
-    // As of 2024.2, the largest file size is 363MB (one of the feslive videos),
-    // make sure this value is large enough for downloading large files.
-    Timeout:   1200 * time.Second,
-    Transport: transport,
-  }
-)
+// ORIGIN is the default asset origin, see SetEndpoints for overriding it.
+const ORIGIN = "https://assets.link-like-lovelive.app"
 
 type SafeCounter struct {
   mutex sync.Mutex
@@ -57,37 +51,173 @@ func (c *SafeCounter) Clear() {
   c.mutex.Unlock()
 }
 
-func DownloadManifestSync(realName string, saveDir string) {
+// VerifyLog collects the verification result of every downloaded entry, and
+// the entries which could not be decoded in streaming mode.
+type VerifyLog struct {
+  mutex    sync.Mutex
+  results  []manifest.VerifyResult
+  failures []manifest.DecryptFailure
+}
+
+func (l *VerifyLog) Add(result manifest.VerifyResult) {
+  l.mutex.Lock()
+  l.results = append(l.results, result)
+  l.mutex.Unlock()
+}
+
+func (l *VerifyLog) AddFailure(failure manifest.DecryptFailure) {
+  l.mutex.Lock()
+  l.failures = append(l.failures, failure)
+  l.mutex.Unlock()
+}
+
+// Failures returns the collected decode failures sorted by label.
+func (l *VerifyLog) Failures() []manifest.DecryptFailure {
+  l.mutex.Lock()
+  defer l.mutex.Unlock()
+  failures := slices.Clone(l.failures)
+  slices.SortFunc(failures, func(a, b manifest.DecryptFailure) int {
+    return strings.Compare(a.Label, b.Label)
+  })
+  return failures
+}
+
+// Results returns the collected results sorted by label.
+func (l *VerifyLog) Results() []manifest.VerifyResult {
+  l.mutex.Lock()
+  defer l.mutex.Unlock()
+  results := slices.Clone(l.results)
+  slices.SortFunc(results, func(a, b manifest.VerifyResult) int {
+    return strings.Compare(a.Label, b.Label)
+  })
+  return results
+}
+
+// DownloadManifestSync downloads the manifest named realName into saveDir. Its
+// checksum algorithm is unknown, so it is only verified against size.
+func DownloadManifestSync(ctx context.Context, realName string, size uint64, saveDir string) {
   counter := &SafeCounter{}
-  entry := &manifest.Entry{
+  entry := manifestEntry(realName, size)
+  if err := os.MkdirAll(saveDir, 0755); err != nil {
+    panic(err)
+  }
+  if err := downloadOne(ctx, entry, saveDir, "", nil, assetHeader, nil, counter, nil, 1); err != nil {
+    panic(err)
+  }
+  rich.Info("Manifest is successfully downloaded.")
+}
+
+// manifestEntry describes the manifest named realName of size bytes to the
+// downloader.
+func manifestEntry(realName string, size uint64) *manifest.Entry {
+  return &manifest.Entry{
     RealName:     realName,
     ResourceType: 999,
     StrLabelCrc:  "Manifest",
+    Size:         size,
   }
-  if err := os.MkdirAll(saveDir, 0755); err != nil {
-    panic(err)
+}
+
+// DownloadOptions controls where DownloadAssetsAsync puts files.
+type DownloadOptions struct {
+  // Imitate url download path under the download directory.
+  KeepPath bool
+  // Streaming mode: response bodies are decoded on the fly into PlainDir, the
+  // same way manifest.DecryptAllAssets would, and raw files are only written
+  // when KeepRaw is set.
+  PlainDir string
+  KeepRaw  bool
+  // Upper bound of parallel downloads, MAX_CONCURRENCY when <= 0. It is
+  // lowered automatically while the origin answers with 429 or 5xx.
+  Concurrency int
+  // Total bandwidth in bytes per second, unlimited when <= 0.
+  RateLimit int64
+  // One of DownloadOrders, ORDER_CATALOG when empty.
+  Order string
+  // Records the entries decoded into PlainDir in streaming mode, may be nil.
+  State *manifest.State
+}
+
+// downloadLimits is shared by all downloads of a DownloadAssetsAsync call,
+// along with the progress they report to.
+type downloadLimits struct {
+  concurrency *concurrencyLimiter
+  rate        *rateLimiter
+  progress    *rich.Tracker
+}
+
+// body wraps a response body with the rate limit and progress tracking, l may
+// be nil.
+func (l *downloadLimits) body(ctx context.Context, body io.Reader) io.Reader {
+  if l == nil {
+    return body
   }
-  downloadOne(entry, saveDir, assetHeader, nil, counter, 1)
-  rich.Info("Manifest is successfully downloaded.")
+  if l.progress != nil {
+    body = &progressReader{body, l.progress}
+  }
+  return limitBody(ctx, body, l.rate)
+}
+
+// progressReader reports every byte read from r to progress.
+type progressReader struct {
+  r        io.Reader
+  progress *rich.Tracker
+}
+
+func (r *progressReader) Read(p []byte) (int, error) {
+  n, err := r.r.Read(p)
+  r.progress.AddBytes(n)
+  return n, err
+}
+
+func (o DownloadOptions) streaming() bool {
+  return o.PlainDir != ""
 }
 
-func DownloadAssetsAsync(catalog *manifest.Catalog, downloadDir string, keepPath *bool) {
-  sem := semaphore.NewWeighted(MAX_CONCURRENCY)
+// DownloadAssetsAsync downloads all entries of catalog and returns the
+// verification result of each downloaded file. In streaming mode, the entries
+// whose verified body cannot be decoded are returned as failures the way
+// manifest.DecryptAllAssets does, without stopping the others. When ctx is
+// cancelled, it waits for the running downloads to stop and panics with
+// ctx.Err(), unfinished files are left as .part files to be resumed later. A
+// download failing for good cancels the others the same way, and its error is
+// panicked with.
+func DownloadAssetsAsync(ctx context.Context, catalog *manifest.Catalog, downloadDir string, opts DownloadOptions) ([]manifest.VerifyResult, []manifest.DecryptFailure) {
+  var dlBytes uint64
+  for i := range catalog.Entries {
+    dlBytes += catalog.Entries[i].Size
+  }
+  limits := &downloadLimits{
+    concurrency: newConcurrencyLimiter(opts.Concurrency),
+    rate:        newRateLimiter(opts.RateLimit),
+    progress:    rich.NewTracker("download", len(catalog.Entries), dlBytes),
+  }
   dlAmount := len(catalog.Entries)
   counter := &SafeCounter{}
-  if err := os.MkdirAll(downloadDir, 0755); err != nil {
+  verifyLog := &VerifyLog{}
+  writeRaw := !opts.streaming() || opts.KeepRaw
+  if writeRaw {
+    if err := os.MkdirAll(downloadDir, 0755); err != nil {
+      panic(err)
+    }
+  }
+  if opts.streaming() {
+    if err := os.MkdirAll(opts.PlainDir, 0755); err != nil {
+      panic(err)
+    }
+  }
+
+  entries, err := OrderEntries(catalog.Entries, opts.Order)
+  if err != nil {
     panic(err)
   }
 
-  for _, entry := range catalog.Entries {
-    // if already exists, skip downloading
-    // if _, err := os.Stat(downloadDir + "/" + entry.RealName); err == nil {
-    //   counter.Increase()
-    //   rich.Info("(%d/%d) File %q already exists, skip downloading.", counter.Value(), dlAmount, entry.RealName)
-    //   continue
-    // }
+  group, groupCtx := errgroup.WithContext(ctx)
+  for _, entry := range entries {
     saveToDir := downloadDir
-    if *keepPath {
+    if !writeRaw {
+      saveToDir = ""
+    } else if opts.KeepPath {
       var resType string
       if entry.ResourceType <= 1 {
         resType = "android"
@@ -99,95 +229,467 @@ func DownloadAssetsAsync(catalog *manifest.Catalog, downloadDir string, keepPath
         panic(err)
       }
     }
-    if err := sem.Acquire(ctx, 1); err != nil {
-      panic(err)
+    if err := limits.concurrency.Acquire(groupCtx); err != nil || groupCtx.Err() != nil {
+      if err == nil {
+        limits.concurrency.Release()
+      }
+      break
     }
-    go downloadOne(&entry, saveToDir, assetHeader, sem, counter, dlAmount)
+    group.Go(func() error {
+      return downloadOne(groupCtx, &entry, saveToDir, opts.PlainDir, opts.State, assetHeader, limits, counter, verifyLog, dlAmount)
+    })
   }
 
-  // wait all concurrencies completed
-  if err := sem.Acquire(ctx, MAX_CONCURRENCY); err != nil {
+  // wait all concurrencies completed, the running ones stop by themselves
+  // once ctx is cancelled or a download failed
+  err = group.Wait()
+  limits.progress.Finish()
+  if ctxErr := ctx.Err(); ctxErr != nil {
+    rich.Warning("Downloading was cancelled, %d/%d assets completed.", counter.Value(), dlAmount)
+    panic(ctxErr)
+  }
+  if err != nil {
+    rich.Error("Downloading was stopped, %d/%d assets completed.", counter.Value(), dlAmount)
     panic(err)
   }
-  rich.Info("Successfully downloaded all assets.")
+  failures := verifyLog.Failures()
+  if len(failures) > 0 {
+    rich.Error("%d of %d downloaded assets failed to be decoded.", len(failures), dlAmount)
+  } else {
+    rich.Info("Successfully downloaded all assets.")
+  }
+  return verifyLog.Results(), failures
 }
 
+// downloadOne downloads entry into saveDir. With a plainDir the body is also
+// decoded on the fly into plainDir, in which case saveDir may be empty to skip
+// the raw file, and the decoded entry is recorded into state. It runs on the
+// download goroutines, so failures are returned rather than panicked with.
 func downloadOne(
+  ctx context.Context,
   entry *manifest.Entry,
   saveDir string,
+  plainDir string,
+  state *manifest.State,
   header http.Header,
-  sem *semaphore.Weighted,
+  limits *downloadLimits,
   counter *SafeCounter,
+  verifyLog *VerifyLog,
   amount int,
-) {
-  if sem != nil {
-    defer sem.Release(1)
+) error {
+  if limits != nil {
+    defer limits.concurrency.Release()
+  }
+  urlPath := assetPath(entry)
+  var dst, part, plainDst, plainPart string
+  if saveDir != "" {
+    dst = fmt.Sprintf("%v/%v", saveDir, entry.RealName)
+    part = dst + PART_SUFFIX
+  }
+  if plainDir != "" {
+    plainDst = fmt.Sprintf("%v/%v", plainDir, manifest.PlainName(entry))
+    plainPart = plainDst + PART_SUFFIX
+  } else if info, err := os.Stat(part); err == nil && limits != nil {
+    // resumed from an earlier run
+    limits.progress.Skip(uint64(info.Size()))
   }
-  request := prepareRequest(entry, header)
-  for i := range MAX_RETRIES {
-    res, err := client.Do(request)
+  // every origin gets MAX_RETRIES attempts before this file falls through to the next mirror
+  origins := currentMirrors()
+  maxAttempts := MAX_RETRIES * origins.Len()
+  failed := make([]int, origins.Len())
+  for i := range maxAttempts {
+    idx, origin := origins.Pick(failed)
+    url := origin + urlPath
+    var result manifest.VerifyResult
+    var err error
+    if plainPart != "" {
+      result, err = streamToPlain(ctx, url, header, limits, entry, plainPart, part)
+    } else if err = fetchToPart(ctx, url, header, limits, part); err == nil && entry.Size > 0 {
+      result = manifest.VerifyFile(entry, part)
+    }
+    var local *localError
+    if errors.As(err, &local) {
+      return err
+    }
+    var undecodable *decodeError
+    if errors.As(err, &undecodable) {
+      // the body is what the origin serves, another attempt gives the same
+      undecodable.result.Attempts = i + 1
+      return skipUndecodable(entry, undecodable, part, dst, plainPart, limits, counter, verifyLog, amount)
+    }
     if err != nil {
+      if plainPart != "" {
+        // a decoded file cannot be resumed
+        removePart(plainPart)
+        if part != "" {
+          removePart(part)
+        }
+      }
+      if ctx.Err() != nil {
+        return ctx.Err()
+      }
+      failed[idx]++
+      origins.Fail(idx)
       rich.Error("%v", err)
-      rich.Warning("An internal error was occurred when downloading %v, retrying...(%d/%d)", request.URL, i+1, MAX_RETRIES)
+      var throttled *throttleError
+      if errors.As(err, &throttled) {
+        if limits != nil {
+          limits.concurrency.Throttle()
+        }
+        // back off exponentially unless the origin tells how long to wait
+        wait := throttled.retryAfter
+        if wait == 0 {
+          wait = time.Duration(1<<failed[idx]) * time.Second
+        }
+        rich.Warning("Origin asked to slow down, retrying %v in %v...(%d/%d)", url, wait, i+1, maxAttempts)
+        if err := sleepContext(ctx, wait); err != nil {
+          return err
+        }
+        continue
+      }
+      rich.Warning("An error was occurred when downloading %v, retrying...(%d/%d)", url, i+1, maxAttempts)
       continue
     }
-    if res.StatusCode != 200 {
-      rich.Error("Status code: %d, message: %v.", res.StatusCode, res.Status)
-      rich.Warning("A HTTP error was occurred when downloading %v, retrying...(%d/%d)", request.URL, i+1, MAX_RETRIES)
-      if err := res.Body.Close(); err != nil {
-        panic(err)
+    // nothing to verify against without a size
+    status := "unverified"
+    if entry.Size > 0 {
+      result.Attempts = i + 1
+      if !result.Ok() {
+        failed[idx]++
+        origins.Fail(idx)
+        rich.Error("Verification of %q(%v) failed: %v (size %d/%d).", entry.StrLabelCrc, entry.RealName, result.Status, result.ActualSize, result.ExpectedSize)
+        if part != "" {
+          removePart(part)
+        }
+        if plainPart != "" {
+          removePart(plainPart)
+        }
+        rich.Warning("Downloaded file of %v is broken, retrying...(%d/%d)", url, i+1, maxAttempts)
+        continue
       }
-      continue
+      if verifyLog != nil {
+        verifyLog.Add(result)
+      }
+      status = string(result.Status)
     }
-    // save response stream to a file
-    fs, err := os.Create(fmt.Sprintf("%v/%v", saveDir, entry.RealName))
-    if err != nil {
-      panic(err)
+    origins.Succeed(idx)
+    if limits != nil {
+      limits.concurrency.Succeed()
     }
-    defer fs.Close()
-    bufw := bufio.NewWriter(fs)
-    if _, err := bufw.ReadFrom(res.Body); err != nil {
-      rich.Error("Error reading response body: %v", err)
-      fs.Close()
-      res.Body.Close()
-      if err := os.Remove(fmt.Sprintf("%v/%v", saveDir, entry.RealName)); err != nil {
-        rich.Warning("Failed to remove incomplete file: %v", err)
+    if part != "" {
+      if err := os.Rename(part, dst); err != nil {
+        return err
       }
-      rich.Warning("Failed to read response body for %v, retrying...(%d/%d)", request.URL, i+1, MAX_RETRIES)
-      continue
     }
-    if err := bufw.Flush(); err != nil {
-      rich.Error("Error flushing buffer: %v", err)
-      fs.Close()
-      res.Body.Close()
-      if err := os.Remove(fmt.Sprintf("%v/%v", saveDir, entry.RealName)); err != nil {
-        rich.Warning("Failed to remove incomplete file: %v", err)
+    if plainPart != "" {
+      if err := os.Rename(plainPart, plainDst); err != nil {
+        return err
+      }
+      if err := state.Record(entry); err != nil {
+        return err
       }
-      rich.Warning("Failed to flush buffer for %v, retrying...(%d/%d)", request.URL, i+1, MAX_RETRIES)
-      continue
     }
-
+    if limits != nil {
+      limits.progress.Complete()
+    }
     counter.Increase()
-    rich.Info("(%d/%d) Download completed: %q(%v).", counter.Value(), amount, entry.StrLabelCrc, entry.RealName)
-    res.Body.Close()
-    return
+    rich.Info("(%d/%d) Download completed: %q(%v), %v.", counter.Value(), amount, entry.StrLabelCrc, entry.RealName, status)
+    return nil
+  }
+  // max retry exhausted, the partial file is kept so that the next run can resume it
+  rich.Error("Max retries exhausted when downloading %v from all origins.", urlPath)
+  return fmt.Errorf("max retries exhausted when downloading %v from all origins", urlPath)
+}
+
+// skipUndecodable records entry, whose verified body could not be decoded, as
+// a failure. The raw file is kept like manifest.DecryptAllAssets would.
+func skipUndecodable(
+  entry *manifest.Entry,
+  undecodable *decodeError,
+  part string,
+  dst string,
+  plainPart string,
+  limits *downloadLimits,
+  counter *SafeCounter,
+  verifyLog *VerifyLog,
+  amount int,
+) error {
+  removePart(plainPart)
+  if part != "" {
+    if err := os.Rename(part, dst); err != nil {
+      return err
+    }
+  }
+  if verifyLog != nil {
+    verifyLog.Add(undecodable.result)
+    verifyLog.AddFailure(manifest.DecryptFailure{
+      Label:    entry.StrLabelCrc,
+      RealName: entry.RealName,
+      Error:    undecodable.Error(),
+    })
+  }
+  if limits != nil {
+    limits.progress.Complete()
   }
-  // max retry exhausted
-  rich.Panic("Max retries exhausted when downloading %v. Will be stopping process.", request.URL)
+  counter.Increase()
+  rich.Error("(%d/%d) Downloaded asset %q(%v) cannot be decoded: %v", counter.Value(), amount, entry.StrLabelCrc, entry.RealName, undecodable)
+  return nil
+}
+
+// localError is a failure writing a downloaded file, which no other attempt
+// or origin would fix.
+type localError struct {
+  err error
+}
+
+func (e *localError) Error() string {
+  return e.err.Error()
+}
+
+func (e *localError) Unwrap() error {
+  return e.err
+}
+
+// decodeError is a body which was received whole and verified, but which
+// cannot be decoded. Unlike a body broken on the way, retrying will not help.
+type decodeError struct {
+  err    error
+  result manifest.VerifyResult
 }
 
-func prepareRequest(entry *manifest.Entry, header http.Header) *http.Request {
+func (e *decodeError) Error() string {
+  return e.err.Error()
+}
+
+func (e *decodeError) Unwrap() error {
+  return e.err
+}
+
+// readErrorRecorder keeps the first error other than io.EOF read from r.
+type readErrorRecorder struct {
+  r   io.Reader
+  err error
+}
+
+func (r *readErrorRecorder) Read(p []byte) (int, error) {
+  n, err := r.r.Read(p)
+  if err != nil && err != io.EOF && r.err == nil {
+    r.err = err
+  }
+  return n, err
+}
+
+// streamToPlain downloads url and decodes the body on the fly into plainPath.
+// The raw body is written to rawPath as well unless it is empty. Decoding has
+// to start from the first byte, so unlike fetchToPart nothing is resumed.
+func streamToPlain(
+  ctx context.Context,
+  url string,
+  header http.Header,
+  limits *downloadLimits,
+  entry *manifest.Entry,
+  plainPath string,
+  rawPath string,
+) (manifest.VerifyResult, error) {
+  request, err := prepareRequest(ctx, url, header, 0)
+  if err != nil {
+    return manifest.VerifyResult{}, err
+  }
+  res, err := downloadClient().Do(request)
+  if err != nil {
+    return manifest.VerifyResult{}, err
+  }
+  defer res.Body.Close()
+  if err := checkThrottled(url, res); err != nil {
+    return manifest.VerifyResult{}, err
+  }
+  if res.StatusCode != http.StatusOK {
+    return manifest.VerifyResult{}, fmt.Errorf("status code: %d, message: %v", res.StatusCode, res.Status)
+  }
+
+  verifier := manifest.NewVerifier(entry)
+  body := &readErrorRecorder{r: limits.body(ctx, res.Body)}
+  var src io.Reader = io.TeeReader(body, verifier)
+  var rawBuf *bufio.Writer
+  if rawPath != "" {
+    rawFile, err := os.Create(rawPath)
+    if err != nil {
+      return manifest.VerifyResult{}, &localError{err}
+    }
+    defer rawFile.Close()
+    rawBuf = bufio.NewWriter(rawFile)
+    src = io.TeeReader(src, rawBuf)
+  }
+
+  plainFile, err := os.Create(plainPath)
+  if err != nil {
+    return manifest.VerifyResult{}, &localError{err}
+  }
+  defer plainFile.Close()
+  plainBuf := bufio.NewWriter(plainFile)
+  decodeErr := decodeEntry(entry, plainBuf, src)
+  if decodeErr != nil && body.err != nil {
+    return manifest.VerifyResult{}, decodeErr
+  }
+  // whatever the decoder left unread still counts for verification
+  if _, err := io.Copy(io.Discard, src); err != nil {
+    return manifest.VerifyResult{}, fmt.Errorf("error reading response body: %v", err)
+  }
+  if rawBuf != nil {
+    if err := rawBuf.Flush(); err != nil {
+      return manifest.VerifyResult{}, fmt.Errorf("error flushing buffer: %v", err)
+    }
+  }
+  if decodeErr != nil {
+    // a body failing verification was broken on the way and is retried
+    result := verifier.Result()
+    if entry.Size > 0 && !result.Ok() {
+      return result, nil
+    }
+    return manifest.VerifyResult{}, &decodeError{decodeErr, result}
+  }
+  if err := plainBuf.Flush(); err != nil {
+    return manifest.VerifyResult{}, fmt.Errorf("error flushing buffer: %v", err)
+  }
+  return verifier.Result(), nil
+}
+
+// decodeEntry turns the panics of manifest.DecodeEntry, eg. a broken
+// connection in the middle of a body or a body which is not what the entry
+// tells, into an error.
+func decodeEntry(entry *manifest.Entry, dst io.Writer, src io.Reader) (err error) {
+  defer func() {
+    if r := recover(); r != nil {
+      err = fmt.Errorf("failed to decode %q(%v): %v", entry.StrLabelCrc, entry.RealName, r)
+    }
+  }()
+  manifest.DecodeEntry(entry, dst, src)
+  return nil
+}
+
+// fetchToPart downloads url into partPath. If partPath already holds some bytes
+// from an earlier attempt, only the remaining range is requested and appended.
+// Origins that ignore the Range header answer with 200, in which case the
+// partial file is truncated and the whole body is written again.
+func fetchToPart(ctx context.Context, url string, header http.Header, limits *downloadLimits, partPath string) error {
+  var offset int64
+  if info, err := os.Stat(partPath); err == nil {
+    offset = info.Size()
+  }
+  request, err := prepareRequest(ctx, url, header, offset)
+  if err != nil {
+    return err
+  }
+  res, err := downloadClient().Do(request)
+  if err != nil {
+    return err
+  }
+  defer res.Body.Close()
+
+  flag := os.O_CREATE | os.O_WRONLY
+  switch res.StatusCode {
+  case http.StatusOK:
+    if offset > 0 {
+      rich.Warning("Origin ignored range request for %v, restarting from scratch.", url)
+    }
+    flag |= os.O_TRUNC
+  case http.StatusPartialContent:
+    start, _, err := parseContentRange(res.Header.Get("Content-Range"))
+    if err != nil || start != offset {
+      removePart(partPath)
+      return fmt.Errorf("unexpected Content-Range %q for %v (expect start at %d)", res.Header.Get("Content-Range"), url, offset)
+    }
+    flag |= os.O_APPEND
+    rich.Info("Resuming %v from byte %d.", url, offset)
+  case http.StatusRequestedRangeNotSatisfiable:
+    // The partial file may already be complete if the previous run was
+    // interrupted right before renaming it.
+    if _, total, err := parseContentRange(res.Header.Get("Content-Range")); err == nil && total == offset {
+      return nil
+    }
+    removePart(partPath)
+    return fmt.Errorf("range not satisfiable for %v, partial file discarded", url)
+  default:
+    if err := checkThrottled(url, res); err != nil {
+      return err
+    }
+    return fmt.Errorf("status code: %d, message: %v", res.StatusCode, res.Status)
+  }
+
+  fs, err := os.OpenFile(partPath, flag, 0644)
+  if err != nil {
+    return &localError{err}
+  }
+  bufw := bufio.NewWriter(fs)
+  if _, err := bufw.ReadFrom(limits.body(ctx, res.Body)); err != nil {
+    bufw.Flush()
+    fs.Close()
+    return fmt.Errorf("error reading response body: %v", err)
+  }
+  if err := bufw.Flush(); err != nil {
+    fs.Close()
+    return fmt.Errorf("error flushing buffer: %v", err)
+  }
+  return fs.Close()
+}
+
+// parseContentRange parses `bytes <start>-<end>/<total>` as well as the
+// `bytes */<total>` form sent along with 416 responses. total is -1 when the
+// origin does not know it.
+func parseContentRange(value string) (start int64, total int64, err error) {
+  rangeSpec, found := strings.CutPrefix(strings.TrimSpace(value), "bytes ")
+  if !found {
+    return 0, 0, fmt.Errorf("invalid Content-Range %q", value)
+  }
+  span, size, found := strings.Cut(rangeSpec, "/")
+  if !found {
+    return 0, 0, fmt.Errorf("invalid Content-Range %q", value)
+  }
+  total = -1
+  if size != "*" {
+    if total, err = strconv.ParseInt(size, 10, 64); err != nil {
+      return 0, 0, err
+    }
+  }
+  if span == "*" {
+    return 0, total, nil
+  }
+  first, _, found := strings.Cut(span, "-")
+  if !found {
+    return 0, 0, fmt.Errorf("invalid Content-Range %q", value)
+  }
+  if start, err = strconv.ParseInt(first, 10, 64); err != nil {
+    return 0, 0, err
+  }
+  return start, total, nil
+}
+
+func removePart(partPath string) {
+  if err := os.Remove(partPath); err != nil && !os.IsNotExist(err) {
+    rich.Warning("Failed to remove incomplete file: %v", err)
+  }
+}
+
+// assetPath returns the path of entry relative to the asset origin.
+func assetPath(entry *manifest.Entry) string {
   var resType string
   if entry.ResourceType <= 1 {
     resType = "android"
   } else {
     resType = "raw"
   }
-  url := fmt.Sprintf("%v/%v/%v/%v", ORIGIN, resType, entry.RealName[:2], entry.RealName)
-  request, err := http.NewRequest("GET", url, nil)
+  return fmt.Sprintf("/%v/%v/%v", resType, entry.RealName[:2], entry.RealName)
+}
+
+func prepareRequest(ctx context.Context, url string, header http.Header, offset int64) (*http.Request, error) {
+  request, err := http.NewRequestWithContext(ctx, "GET", url, nil)
   if err != nil {
-    panic(err)
+    return nil, err
+  }
+  // header is shared by all concurrent downloads, never modify it in place
+  request.Header = header.Clone()
+  if offset > 0 {
+    request.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
   }
-  request.Header = header
-  return request
+  return request, nil
 }
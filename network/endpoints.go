@@ -0,0 +1,134 @@
+package network
+
+import (
+  "fmt"
+  "slices"
+  "strings"
+  "sync"
+
+  "vertesan/hailstorm/rich"
+)
+
+// MAX_MIRROR_FAILURES is the number of consecutive failed downloads after
+// which the current asset origin is abandoned for the next one.
+const MAX_MIRROR_FAILURES = 3
+
+// Endpoints holds every remote address this package talks to. Empty fields
+// fall back to the official servers.
+type Endpoints struct {
+  // Asset origins in order of preference, the first one is the primary origin
+  // and the others are mirrors.
+  Origins      []string
+  LoginUrl     string
+  PlayStoreUrl string
+}
+
+var (
+  endpointsMutex sync.RWMutex
+  endpoints      = DefaultEndpoints()
+  mirrors        = newMirrorSet(endpoints.Origins)
+)
+
+func DefaultEndpoints() Endpoints {
+  return Endpoints{
+    Origins:      []string{ORIGIN},
+    LoginUrl:     LOGIN_URL,
+    PlayStoreUrl: fmt.Sprintf("https://play.google.com/store/apps/details?id=%s", GAME_ID),
+  }
+}
+
+// SetEndpoints replaces the endpoints used by all subsequent requests.
+func SetEndpoints(e Endpoints) {
+  defaults := DefaultEndpoints()
+  origins := make([]string, 0, len(e.Origins))
+  for _, origin := range e.Origins {
+    origin = strings.TrimRight(strings.TrimSpace(origin), "/")
+    if origin != "" && !slices.Contains(origins, origin) {
+      origins = append(origins, origin)
+    }
+  }
+  if len(origins) == 0 {
+    origins = defaults.Origins
+  }
+  if e.LoginUrl = strings.TrimSpace(e.LoginUrl); e.LoginUrl == "" {
+    e.LoginUrl = defaults.LoginUrl
+  }
+  if e.PlayStoreUrl = strings.TrimSpace(e.PlayStoreUrl); e.PlayStoreUrl == "" {
+    e.PlayStoreUrl = defaults.PlayStoreUrl
+  }
+  e.Origins = origins
+
+  endpointsMutex.Lock()
+  endpoints = e
+  mirrors = newMirrorSet(origins)
+  endpointsMutex.Unlock()
+  if len(origins) > 1 || origins[0] != ORIGIN {
+    rich.Info("Asset origins: %v.", strings.Join(origins, ", "))
+  }
+}
+
+func currentEndpoints() Endpoints {
+  endpointsMutex.RLock()
+  defer endpointsMutex.RUnlock()
+  return endpoints
+}
+
+func currentMirrors() *mirrorSet {
+  endpointsMutex.RLock()
+  defer endpointsMutex.RUnlock()
+  return mirrors
+}
+
+// mirrorSet keeps track of which origin downloads should currently go to.
+type mirrorSet struct {
+  mutex    sync.Mutex
+  origins  []string
+  current  int
+  failures int
+}
+
+func newMirrorSet(origins []string) *mirrorSet {
+  return &mirrorSet{origins: origins}
+}
+
+func (m *mirrorSet) Len() int {
+  return len(m.origins)
+}
+
+// Pick returns the origin for the next attempt of a single download, failed
+// holds how many times this download already failed on each origin. Once it
+// failed MAX_RETRIES times on an origin the download moves on to the next one,
+// even if the other downloads are still fine with it.
+func (m *mirrorSet) Pick(failed []int) (int, string) {
+  m.mutex.Lock()
+  defer m.mutex.Unlock()
+  for i := range m.origins {
+    idx := (m.current + i) % len(m.origins)
+    if failed[idx] < MAX_RETRIES {
+      return idx, m.origins[idx]
+    }
+  }
+  return m.current, m.origins[m.current]
+}
+
+func (m *mirrorSet) Fail(idx int) {
+  m.mutex.Lock()
+  defer m.mutex.Unlock()
+  if idx != m.current || len(m.origins) < 2 {
+    return
+  }
+  m.failures++
+  if m.failures >= MAX_MIRROR_FAILURES {
+    m.current = (m.current + 1) % len(m.origins)
+    m.failures = 0
+    rich.Warning("Origin %v failed repeatedly, switching to %v.", m.origins[idx], m.origins[m.current])
+  }
+}
+
+func (m *mirrorSet) Succeed(idx int) {
+  m.mutex.Lock()
+  defer m.mutex.Unlock()
+  if idx == m.current {
+    m.failures = 0
+  }
+}
@@ -0,0 +1,61 @@
+package network
+
+import (
+  "fmt"
+  "strings"
+
+  "vertesan/hailstorm/manifest"
+)
+
+// ResInfoInspection is everything a resInfo tells about the manifest it points
+// to. 64-bit values are hexadecimal, so that they survive JavaScript.
+type ResInfoInspection struct {
+  ResInfo       string `json:"resInfo"`
+  SimpleResver  string `json:"simpleResver"`
+  ClientVersion string `json:"clientVersion"`
+  Checksum      string `json:"checksum"`
+  Seed          string `json:"seed"`
+  Size          uint64 `json:"size"`
+  LabelCrc      string `json:"labelCrc"`
+  RealName      string `json:"realName"`
+  // The name the key and IV of the manifest are derived from, empty without
+  // a client version.
+  CalcCrc64Name string `json:"calcCrc64Name"`
+  // Path of the manifest relative to an asset origin, and the full URLs on
+  // each origin in order.
+  UrlPath string   `json:"urlPath"`
+  Urls    []string `json:"urls"`
+}
+
+// InspectResInfo decodes resInfo without downloading anything. The manifest
+// URLs are built on origins.
+func InspectResInfo(resInfo string, clientVersion string, origins []string) (*ResInfoInspection, error) {
+  resInfo = strings.TrimSpace(resInfo)
+  clientVersion = strings.TrimSpace(clientVersion)
+  mani, err := manifest.ParseResInfo(resInfo, clientVersion)
+  if err != nil {
+    return nil, err
+  }
+  entry := manifestEntry(mani.RealName, mani.Size)
+  inspection := &ResInfoInspection{
+    ResInfo:       resInfo,
+    SimpleResver:  mani.SimpleResver,
+    ClientVersion: clientVersion,
+    Checksum:      fmt.Sprintf("%016X", mani.Checksum),
+    Seed:          fmt.Sprintf("%016X", mani.Seed),
+    Size:          mani.Size,
+    LabelCrc:      fmt.Sprintf("%016X", mani.LabelCrc),
+    RealName:      mani.RealName,
+    UrlPath:       assetPath(entry),
+    Urls:          []string{},
+  }
+  if clientVersion != "" {
+    inspection.CalcCrc64Name = mani.CalcCrc64Name
+  }
+  for _, origin := range origins {
+    if origin = strings.TrimRight(strings.TrimSpace(origin), "/"); origin != "" {
+      inspection.Urls = append(inspection.Urls, origin+inspection.UrlPath)
+    }
+  }
+  return inspection, nil
+}
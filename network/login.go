@@ -2,6 +2,7 @@ package network
 
 import (
   "bytes"
+  "context"
   "fmt"
   "math/rand"
   "net/http"
@@ -12,9 +13,9 @@ const LOGIN_URL = "https://api.link-like-lovelive.app/v1/user/login"
 
 var letterRunes = []rune("abcdef0123456789")
 
-func Login(clientVersion string) string {
+func Login(ctx context.Context, clientVersion string) string {
   buf := bytes.NewBufferString(`{"device_specific_id":"","player_id":"","version":1}`)
-  req, err := http.NewRequest("POST", LOGIN_URL, buf)
+  req, err := http.NewRequestWithContext(ctx, "POST", currentEndpoints().LoginUrl, buf)
   if err != nil {
     panic(err)
   }
@@ -28,7 +29,7 @@ func Login(clientVersion string) string {
 
   req.Header = *loginHeader
 
-  res, err := http.DefaultClient.Do(req)
+  res, err := apiClient().Do(req)
   if err != nil {
     panic(err)
   }
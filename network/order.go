@@ -0,0 +1,97 @@
+package network
+
+import (
+  "encoding/binary"
+  "fmt"
+  "slices"
+  "strings"
+
+  "vertesan/hailstorm/manifest"
+)
+
+// Download orders accepted by DownloadOptions.Order. Every order but
+// ORDER_CATALOG puts databases (tsv) first, so that an interrupted run has
+// already fetched them.
+const (
+  // the order of the catalog itself
+  ORDER_CATALOG = "catalog"
+  // ascending Entry.Priority
+  ORDER_PRIORITY = "priority"
+  // smallest files first
+  ORDER_SIZE = "size"
+  // dependencies before the entries depending on them
+  ORDER_DEPS = "deps"
+)
+
+var DownloadOrders = []string{ORDER_CATALOG, ORDER_PRIORITY, ORDER_SIZE, ORDER_DEPS}
+
+// OrderEntries returns a reordered copy of entries.
+func OrderEntries(entries []manifest.Entry, order string) ([]manifest.Entry, error) {
+  order = strings.ToLower(strings.TrimSpace(order))
+  ordered := slices.Clone(entries)
+  switch order {
+  case "", ORDER_CATALOG:
+    return ordered, nil
+  case ORDER_PRIORITY:
+    slices.SortStableFunc(ordered, func(a, b manifest.Entry) int {
+      return int(a.Priority) - int(b.Priority)
+    })
+  case ORDER_SIZE:
+    slices.SortStableFunc(ordered, func(a, b manifest.Entry) int {
+      switch {
+      case a.Size < b.Size:
+        return -1
+      case a.Size > b.Size:
+        return 1
+      }
+      return 0
+    })
+  case ORDER_DEPS:
+    ordered = orderByDeps(ordered)
+  default:
+    return nil, fmt.Errorf("unknown download order %q, expect one of %v", order, strings.Join(DownloadOrders, ", "))
+  }
+  // databases first, keeping the order above among them and among the others
+  slices.SortStableFunc(ordered, func(a, b manifest.Entry) int {
+    return dbRank(&a) - dbRank(&b)
+  })
+  return ordered, nil
+}
+
+func dbRank(entry *manifest.Entry) int {
+  if entry.StrTypeCrc == "tsv" {
+    return 0
+  }
+  return 1
+}
+
+// orderByDeps sorts entries in post-order of their dependencies. RecDepCrcs is
+// used instead of the direct DepCrcs, so that entries depending on each other
+// through one which is not in entries are still ordered correctly.
+func orderByDeps(entries []manifest.Entry) []manifest.Entry {
+  index := make(map[uint64]int, len(entries))
+  for i := range entries {
+    index[entries[i].LabelCrc] = i
+  }
+  visited := make([]bool, len(entries))
+  ordered := make([]manifest.Entry, 0, len(entries))
+
+  var visit func(i int)
+  visit = func(i int) {
+    visited[i] = true
+    deps := entries[i].RecDepCrcs
+    for off := 0; off+8 <= len(deps); off += 8 {
+      dep, ok := index[binary.BigEndian.Uint64(deps[off:])]
+      if ok && !visited[dep] {
+        visit(dep)
+      }
+    }
+    ordered = append(ordered, entries[i])
+  }
+  for i := range entries {
+    if !visited[i] {
+      visit(i)
+    }
+  }
+  return ordered
+}
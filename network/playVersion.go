@@ -1,21 +1,21 @@
 package network
 
 import (
+  "context"
   "errors"
   "fmt"
   "net/http"
   "regexp"
   "strings"
-  "vertesan/hailstorm/rich"
 
   "github.com/PuerkitoBio/goquery"
 )
 
 const GAME_ID = "com.oddno.lovelive"
 
-func GetPlayVersion() (string, error) {
-  url := fmt.Sprintf("https://play.google.com/store/apps/details?id=%s", GAME_ID)
-  req, err := http.NewRequest("GET", url, nil)
+func GetPlayVersion(ctx context.Context) (string, error) {
+  url := currentEndpoints().PlayStoreUrl
+  req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
   if err != nil {
     panic(err)
   }
@@ -23,13 +23,13 @@ func GetPlayVersion() (string, error) {
     "User-Agent": {"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/119.0.0.0 Safari/537.36 Edg/119.0.0.0"},
   }
   req.Header = header
-  res, err := http.DefaultClient.Do(req)
+  res, err := apiClient().Do(req)
   if err != nil {
-    panic(err)
+    return "", err
   }
   defer res.Body.Close()
   if res.StatusCode != 200 {
-    rich.Panic("Abnormal HTTP status code: %d. Message: %s", res.StatusCode, res.Status)
+    return "", fmt.Errorf("Abnormal HTTP status code: %d. Message: %s", res.StatusCode, res.Status)
   }
   doc, err := goquery.NewDocumentFromReader(res.Body)
   if err != nil {
@@ -40,8 +40,9 @@ func GetPlayVersion() (string, error) {
     scriptContent := strings.TrimSpace(s.Text())
     if strings.Contains(scriptContent, "key: 'ds:5'") {
       reg := regexp.MustCompile(`\[\[\["([\d\.]+)"\]\],\[\[\[\d+\]\]\,\[\[\[\d+,"`)
-      match := reg.FindStringSubmatch(scriptContent)
-      version = match[1]
+      if match := reg.FindStringSubmatch(scriptContent); match != nil {
+        version = match[1]
+      }
       return false
     }
     return true
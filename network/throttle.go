@@ -0,0 +1,251 @@
+package network
+
+import (
+  "context"
+  "fmt"
+  "io"
+  "net/http"
+  "strconv"
+  "strings"
+  "sync"
+  "time"
+
+  "vertesan/hailstorm/rich"
+)
+
+// MAX_RETRY_AFTER caps how long a single Retry-After header may pause a
+// download.
+const MAX_RETRY_AFTER = 5 * time.Minute
+
+// rateLimiter is a token bucket shared by all downloads. Bytes are taken after
+// they were read, a download which went over budget sleeps until the bucket
+// is refilled.
+type rateLimiter struct {
+  mutex  sync.Mutex
+  rate   float64
+  burst  float64
+  tokens float64
+  last   time.Time
+}
+
+func newRateLimiter(bytesPerSec int64) *rateLimiter {
+  if bytesPerSec <= 0 {
+    return nil
+  }
+  rate := float64(bytesPerSec)
+  return &rateLimiter{
+    rate:   rate,
+    burst:  rate,
+    tokens: rate,
+    last:   time.Now(),
+  }
+}
+
+func (l *rateLimiter) Take(ctx context.Context, n int) error {
+  l.mutex.Lock()
+  now := time.Now()
+  l.tokens = min(l.burst, l.tokens+now.Sub(l.last).Seconds()*l.rate)
+  l.last = now
+  l.tokens -= float64(n)
+  var wait time.Duration
+  if l.tokens < 0 {
+    wait = time.Duration(-l.tokens / l.rate * float64(time.Second))
+  }
+  l.mutex.Unlock()
+  return sleepContext(ctx, wait)
+}
+
+// limitedReader throttles reads from r through a shared rateLimiter.
+type limitedReader struct {
+  ctx     context.Context
+  r       io.Reader
+  limiter *rateLimiter
+}
+
+func (r *limitedReader) Read(p []byte) (int, error) {
+  // never take more than a second worth of tokens at once
+  if len(p) > int(r.limiter.burst) {
+    p = p[:int(r.limiter.burst)]
+  }
+  n, err := r.r.Read(p)
+  if n > 0 {
+    if waitErr := r.limiter.Take(r.ctx, n); waitErr != nil {
+      return n, waitErr
+    }
+  }
+  return n, err
+}
+
+// limitBody wraps a response body with limiter, which may be nil.
+func limitBody(ctx context.Context, body io.Reader, limiter *rateLimiter) io.Reader {
+  if limiter == nil {
+    return body
+  }
+  return &limitedReader{ctx: ctx, r: body, limiter: limiter}
+}
+
+// concurrencyLimiter bounds the number of running downloads. The bound halves
+// whenever the origin pushes back with 429 or 5xx and grows by one after as
+// many successful downloads in a row, up to max.
+type concurrencyLimiter struct {
+  mutex     sync.Mutex
+  limit     int
+  max       int
+  inflight  int
+  successes int
+  lastCut   time.Time
+  wake      chan struct{}
+}
+
+func newConcurrencyLimiter(max int) *concurrencyLimiter {
+  if max <= 0 {
+    max = MAX_CONCURRENCY
+  }
+  return &concurrencyLimiter{
+    limit: max,
+    max:   max,
+    wake:  make(chan struct{}),
+  }
+}
+
+func (l *concurrencyLimiter) Acquire(ctx context.Context) error {
+  for {
+    l.mutex.Lock()
+    if l.inflight < l.limit {
+      l.inflight++
+      l.mutex.Unlock()
+      return nil
+    }
+    wake := l.wake
+    l.mutex.Unlock()
+    select {
+    case <-ctx.Done():
+      return ctx.Err()
+    case <-wake:
+    }
+  }
+}
+
+func (l *concurrencyLimiter) Release() {
+  l.mutex.Lock()
+  l.inflight--
+  l.broadcast()
+  l.mutex.Unlock()
+}
+
+func (l *concurrencyLimiter) Succeed() {
+  l.mutex.Lock()
+  defer l.mutex.Unlock()
+  if l.limit >= l.max {
+    return
+  }
+  l.successes++
+  if l.successes >= l.limit {
+    l.successes = 0
+    l.limit++
+    l.broadcast()
+    rich.Info("Origin recovered, raising concurrency to %d.", l.limit)
+  }
+}
+
+// Throttle halves the bound, at most once a second so that a burst of
+// failures of the downloads already running counts as one.
+func (l *concurrencyLimiter) Throttle() {
+  l.mutex.Lock()
+  defer l.mutex.Unlock()
+  l.successes = 0
+  if l.limit <= 1 || time.Since(l.lastCut) < time.Second {
+    return
+  }
+  l.limit = max(1, l.limit/2)
+  l.lastCut = time.Now()
+  rich.Warning("Origin is overloaded, lowering concurrency to %d.", l.limit)
+}
+
+func (l *concurrencyLimiter) broadcast() {
+  close(l.wake)
+  l.wake = make(chan struct{})
+}
+
+// throttleError is returned for responses telling the client to slow down.
+type throttleError struct {
+  url        string
+  status     string
+  retryAfter time.Duration
+}
+
+func (e *throttleError) Error() string {
+  return fmt.Sprintf("origin is throttling %v, status: %v", e.url, e.status)
+}
+
+// checkThrottled returns a throttleError for 429 and 5xx responses.
+func checkThrottled(url string, res *http.Response) error {
+  if res.StatusCode != http.StatusTooManyRequests && res.StatusCode < 500 {
+    return nil
+  }
+  return &throttleError{
+    url:        url,
+    status:     res.Status,
+    retryAfter: parseRetryAfter(res.Header.Get("Retry-After")),
+  }
+}
+
+// parseRetryAfter accepts both forms of Retry-After, delay seconds and an
+// HTTP date.
+func parseRetryAfter(value string) time.Duration {
+  value = strings.TrimSpace(value)
+  if value == "" {
+    return 0
+  }
+  var wait time.Duration
+  if seconds, err := strconv.Atoi(value); err == nil {
+    wait = time.Duration(seconds) * time.Second
+  } else if date, err := http.ParseTime(value); err == nil {
+    wait = time.Until(date)
+  }
+  return min(max(wait, 0), MAX_RETRY_AFTER)
+}
+
+func sleepContext(ctx context.Context, d time.Duration) error {
+  if d <= 0 {
+    return ctx.Err()
+  }
+  timer := time.NewTimer(d)
+  defer timer.Stop()
+  select {
+  case <-ctx.Done():
+    return ctx.Err()
+  case <-timer.C:
+    return nil
+  }
+}
+
+// ParseRate parses a bandwidth such as "512K", "2M" or "1.5MB/s" into bytes
+// per second. Units are powers of 1024, an empty string or "0" means
+// unlimited.
+func ParseRate(value string) (int64, error) {
+  s := strings.ToUpper(strings.TrimSpace(value))
+  s = strings.TrimSuffix(s, "/S")
+  s = strings.TrimSuffix(s, "B")
+  s = strings.TrimSuffix(s, "I")
+  if s == "" {
+    return 0, nil
+  }
+  multiplier := 1.0
+  switch s[len(s)-1] {
+  case 'K':
+    multiplier = 1 << 10
+  case 'M':
+    multiplier = 1 << 20
+  case 'G':
+    multiplier = 1 << 30
+  }
+  if multiplier > 1 {
+    s = s[:len(s)-1]
+  }
+  number, err := strconv.ParseFloat(s, 64)
+  if err != nil || number < 0 {
+    return 0, fmt.Errorf("invalid rate %q", value)
+  }
+  return int64(number * multiplier), nil
+}
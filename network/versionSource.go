@@ -0,0 +1,287 @@
+package network
+
+import (
+  "bufio"
+  "context"
+  "encoding/json"
+  "errors"
+  "fmt"
+  "io"
+  "net/http"
+  "os"
+  "path/filepath"
+  "regexp"
+  "strconv"
+  "strings"
+  "time"
+
+  "vertesan/hailstorm/rich"
+)
+
+// Names of the version sources, see ParseVersionSources.
+const (
+  SOURCE_PLAY_STORE = "playstore"
+  SOURCE_FILE       = "file"
+  SOURCE_STATIC     = "static"
+  SOURCE_HISTORY    = "history"
+)
+
+// DefaultVersionSources is the order sources are tried in when none is given.
+var DefaultVersionSources = []string{SOURCE_PLAY_STORE, SOURCE_FILE, SOURCE_STATIC, SOURCE_HISTORY}
+
+var versionPattern = regexp.MustCompile(`^\d+(\.\d+)*$`)
+
+// VersionSource discovers the client version the login endpoint expects.
+type VersionSource interface {
+  Name() string
+  ClientVersion(ctx context.Context) (string, error)
+}
+
+// PlayStoreSource scrapes the Google Play page of the game.
+type PlayStoreSource struct{}
+
+func (PlayStoreSource) Name() string {
+  return SOURCE_PLAY_STORE
+}
+
+func (PlayStoreSource) ClientVersion(ctx context.Context) (string, error) {
+  return GetPlayVersion(ctx)
+}
+
+// StaticSource always gives the same version, usually one from the config.
+type StaticSource struct {
+  Version string
+}
+
+func (s StaticSource) Name() string {
+  return SOURCE_STATIC
+}
+
+func (s StaticSource) ClientVersion(ctx context.Context) (string, error) {
+  if s.Version == "" {
+    return "", errors.New("no static client version configured")
+  }
+  return s.Version, nil
+}
+
+// FileSource reads the version from the first non-empty line of a local file
+// or of an http(s) URL.
+type FileSource struct {
+  Location string
+}
+
+func (s FileSource) Name() string {
+  return SOURCE_FILE
+}
+
+func (s FileSource) ClientVersion(ctx context.Context) (string, error) {
+  var src io.ReadCloser
+  if strings.HasPrefix(s.Location, "http://") || strings.HasPrefix(s.Location, "https://") {
+    req, err := http.NewRequestWithContext(ctx, "GET", s.Location, nil)
+    if err != nil {
+      return "", err
+    }
+    res, err := apiClient().Do(req)
+    if err != nil {
+      return "", err
+    }
+    if res.StatusCode != 200 {
+      res.Body.Close()
+      return "", fmt.Errorf("abnormal HTTP status from %q: %v", s.Location, res.Status)
+    }
+    src = res.Body
+  } else {
+    fs, err := os.Open(s.Location)
+    if err != nil {
+      return "", err
+    }
+    src = fs
+  }
+  defer src.Close()
+  scanner := bufio.NewScanner(src)
+  for scanner.Scan() {
+    if line := strings.TrimSpace(scanner.Text()); line != "" {
+      return line, nil
+    }
+  }
+  if err := scanner.Err(); err != nil {
+    return "", err
+  }
+  return "", fmt.Errorf("%q is empty", s.Location)
+}
+
+// HistorySource gives the highest of the versions already seen.
+type HistorySource struct {
+  Versions []string
+}
+
+func (s HistorySource) Name() string {
+  return SOURCE_HISTORY
+}
+
+func (s HistorySource) ClientVersion(ctx context.Context) (string, error) {
+  highest := ""
+  for _, version := range s.Versions {
+    if versionPattern.MatchString(version) && (highest == "" || CompareVersions(version, highest) > 0) {
+      highest = version
+    }
+  }
+  if highest == "" {
+    return "", errors.New("no client version in history")
+  }
+  return highest, nil
+}
+
+// CompareVersions compares dotted numeric versions like "3.10.0" and "3.9.2".
+func CompareVersions(a string, b string) int {
+  aParts := strings.Split(a, ".")
+  bParts := strings.Split(b, ".")
+  for i := range max(len(aParts), len(bParts)) {
+    var x, y int
+    if i < len(aParts) {
+      x, _ = strconv.Atoi(aParts[i])
+    }
+    if i < len(bParts) {
+      y, _ = strconv.Atoi(bParts[i])
+    }
+    if x != y {
+      return x - y
+    }
+  }
+  return 0
+}
+
+// VersionSourceConfig holds what the sources besides the Play Store need.
+type VersionSourceConfig struct {
+  StaticVersion string
+  File          string
+  History       []string
+}
+
+// ParseVersionSources builds the sources named in order, DefaultVersionSources
+// when empty. Sources which are not configured are left out, unless they are
+// named explicitly.
+func ParseVersionSources(order []string, cfg VersionSourceConfig) ([]VersionSource, error) {
+  explicit := len(order) > 0
+  if !explicit {
+    order = DefaultVersionSources
+  }
+  sources := []VersionSource{}
+  for _, name := range order {
+    switch strings.ToLower(strings.TrimSpace(name)) {
+    case SOURCE_PLAY_STORE:
+      sources = append(sources, PlayStoreSource{})
+    case SOURCE_FILE:
+      if cfg.File != "" {
+        sources = append(sources, FileSource{cfg.File})
+      } else if explicit {
+        return nil, errors.New("version source \"file\" needs a version file")
+      }
+    case SOURCE_STATIC:
+      if cfg.StaticVersion != "" || explicit {
+        sources = append(sources, StaticSource{cfg.StaticVersion})
+      }
+    case SOURCE_HISTORY:
+      if len(cfg.History) > 0 || explicit {
+        sources = append(sources, HistorySource{cfg.History})
+      }
+    default:
+      return nil, fmt.Errorf("unknown version source %q, expect one of %v", name, strings.Join(DefaultVersionSources, ", "))
+    }
+  }
+  return sources, nil
+}
+
+// versionCache is what ResolveClientVersion keeps between runs.
+type versionCache struct {
+  ClientVersion string    `json:"clientVersion"`
+  Source        string    `json:"source"`
+  CheckedAt     time.Time `json:"checkedAt"`
+}
+
+// ResolveClientVersion tries sources in order and returns the first version
+// found, which is cached at cachePath. The cached version is returned without
+// asking any source while it is younger than ttl, and as a last resort when
+// every source fails.
+func ResolveClientVersion(ctx context.Context, sources []VersionSource, cachePath string, ttl time.Duration) (string, error) {
+  cached := readVersionCache(cachePath)
+  if cached != nil && ttl > 0 && time.Since(cached.CheckedAt) < ttl {
+    rich.Info("Using cached client version %q from %s.", cached.ClientVersion, cached.Source)
+    return cached.ClientVersion, nil
+  }
+
+  errs := []error{}
+  for _, source := range sources {
+    version, err := tryVersionSource(ctx, source)
+    if err == nil && !versionPattern.MatchString(version) {
+      err = fmt.Errorf("malformed client version %q", version)
+    }
+    if err != nil {
+      if ctxErr := ctx.Err(); ctxErr != nil {
+        return "", ctxErr
+      }
+      rich.Warning("Version source %q failed: %v", source.Name(), err)
+      errs = append(errs, fmt.Errorf("%s: %w", source.Name(), err))
+      continue
+    }
+    rich.Info("Client version %q found by %s.", version, source.Name())
+    writeVersionCache(cachePath, &versionCache{
+      ClientVersion: version,
+      Source:        source.Name(),
+      CheckedAt:     time.Now(),
+    })
+    return version, nil
+  }
+
+  if cached != nil {
+    rich.Warning("Every version source failed, using cached client version %q from %s.", cached.ClientVersion, cached.CheckedAt.Format(time.RFC3339))
+    return cached.ClientVersion, nil
+  }
+  if len(errs) == 0 {
+    return "", errors.New("no version source configured")
+  }
+  return "", errors.Join(errs...)
+}
+
+// tryVersionSource turns the panics of a source into an error.
+func tryVersionSource(ctx context.Context, source VersionSource) (version string, err error) {
+  defer func() {
+    if r := recover(); r != nil {
+      err = fmt.Errorf("%v", r)
+    }
+  }()
+  version, err = source.ClientVersion(ctx)
+  return strings.TrimSpace(version), err
+}
+
+func readVersionCache(path string) *versionCache {
+  if path == "" {
+    return nil
+  }
+  raw, err := os.ReadFile(path)
+  if err != nil {
+    return nil
+  }
+  cached := &versionCache{}
+  if err := json.Unmarshal(raw, cached); err != nil || cached.ClientVersion == "" {
+    return nil
+  }
+  return cached
+}
+
+func writeVersionCache(path string, cached *versionCache) {
+  if path == "" {
+    return
+  }
+  raw, err := json.Marshal(cached)
+  if err != nil {
+    panic(err)
+  }
+  if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+    rich.Warning("Failed to cache client version: %v", err)
+    return
+  }
+  if err := os.WriteFile(path, raw, 0644); err != nil {
+    rich.Warning("Failed to cache client version: %v", err)
+  }
+}
@@ -0,0 +1,252 @@
+package rich
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// progress is reported at most this often, except when a phase finishes
+	progressInterval = 250 * time.Millisecond
+	// the rate is measured over this window
+	rateWindow = 5 * time.Second
+	barWidth   = 24
+)
+
+// Progress is a snapshot of a long running phase like downloading.
+type Progress struct {
+	Phase      string `json:"phase"`
+	Done       int    `json:"done"`
+	Total      int    `json:"total"`
+	BytesDone  uint64 `json:"bytesDone"`
+	BytesTotal uint64 `json:"bytesTotal"`
+	// Bytes per second over the last few seconds.
+	Rate float64 `json:"rate"`
+	// Estimated seconds left, -1 when unknown.
+	ETA      float64 `json:"eta"`
+	Finished bool    `json:"finished"`
+}
+
+type ProgressHookFunc func(p Progress)
+
+var (
+	progressHookMu sync.RWMutex
+	progressHookFn ProgressHookFunc
+)
+
+// SetProgressHook receives every reported Progress. While it is set the CLI
+// progress bar is not drawn.
+func SetProgressHook(h ProgressHookFunc) {
+	progressHookMu.Lock()
+	progressHookFn = h
+	progressHookMu.Unlock()
+}
+
+func emitProgress(p Progress) {
+	progressHookMu.RLock()
+	h := progressHookFn
+	progressHookMu.RUnlock()
+	if h != nil {
+		h(p)
+		return
+	}
+	drawBar(p)
+}
+
+type progressSample struct {
+	at    time.Time
+	bytes uint64
+}
+
+// Tracker computes the Progress of a phase and reports it. It is safe for
+// concurrent use, and a nil *Tracker does nothing.
+type Tracker struct {
+	mu       sync.Mutex
+	progress Progress
+	samples  []progressSample
+	lastEmit time.Time
+}
+
+func NewTracker(phase string, total int, bytesTotal uint64) *Tracker {
+	t := &Tracker{
+		progress: Progress{
+			Phase:      phase,
+			Total:      total,
+			BytesTotal: bytesTotal,
+			ETA:        -1,
+		},
+		samples: []progressSample{{time.Now(), 0}},
+	}
+	emitProgress(t.progress)
+	return t
+}
+
+// AddBytes records n transferred bytes.
+func (t *Tracker) AddBytes(n int) {
+	if t == nil || n <= 0 {
+		return
+	}
+	t.mu.Lock()
+	t.progress.BytesDone += uint64(n)
+	t.update(false)
+}
+
+// Skip records n bytes which are done without being transferred, like the
+// resumed part of a file. They do not count toward the rate.
+func (t *Tracker) Skip(n uint64) {
+	if t == nil || n == 0 {
+		return
+	}
+	t.mu.Lock()
+	t.progress.BytesDone += n
+	for i := range t.samples {
+		t.samples[i].bytes += n
+	}
+	t.update(false)
+}
+
+// Complete records one finished entry.
+func (t *Tracker) Complete() {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	t.progress.Done++
+	t.update(false)
+}
+
+// Finish reports the phase as finished, whether every entry is done or not.
+func (t *Tracker) Finish() {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	t.progress.Finished = true
+	t.update(true)
+}
+
+func (t *Tracker) Snapshot() Progress {
+	if t == nil {
+		return Progress{}
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.progress
+}
+
+// update must be called with t.mu held, which it releases.
+func (t *Tracker) update(force bool) {
+	now := time.Now()
+	if !force && now.Sub(t.lastEmit) < progressInterval {
+		t.mu.Unlock()
+		return
+	}
+	t.lastEmit = now
+
+	t.samples = append(t.samples, progressSample{now, t.progress.BytesDone})
+	start := 0
+	for start < len(t.samples)-2 && now.Sub(t.samples[start+1].at) >= rateWindow {
+		start++
+	}
+	t.samples = t.samples[start:]
+	first := t.samples[0]
+	if elapsed := now.Sub(first.at).Seconds(); elapsed > 0 {
+		t.progress.Rate = float64(t.progress.BytesDone-first.bytes) / elapsed
+	}
+	t.progress.ETA = -1
+	if t.progress.BytesTotal > t.progress.BytesDone && t.progress.Rate > 0 {
+		t.progress.ETA = float64(t.progress.BytesTotal-t.progress.BytesDone) / t.progress.Rate
+	} else if t.progress.BytesTotal > 0 && t.progress.BytesDone >= t.progress.BytesTotal {
+		t.progress.ETA = 0
+	}
+	p := t.progress
+	t.mu.Unlock()
+	emitProgress(p)
+}
+
+var (
+	barMu    sync.Mutex
+	barShown string
+	barTTY   = isTerminal(os.Stdout)
+)
+
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// drawBar replaces the progress bar at the bottom of the terminal.
+func drawBar(p Progress) {
+	if !barTTY {
+		return
+	}
+	barMu.Lock()
+	defer barMu.Unlock()
+	if p.Finished {
+		clearBarLocked()
+		barShown = ""
+		return
+	}
+	barShown = formatBar(p)
+	fmt.Print("\r\033[K" + barShown)
+}
+
+func formatBar(p Progress) string {
+	ratio := 0.0
+	if p.BytesTotal > 0 {
+		ratio = float64(p.BytesDone) / float64(p.BytesTotal)
+	} else if p.Total > 0 {
+		ratio = float64(p.Done) / float64(p.Total)
+	}
+	ratio = min(ratio, 1)
+	filled := int(ratio * barWidth)
+	eta := "--:--"
+	if p.ETA >= 0 {
+		eta = (time.Duration(p.ETA) * time.Second).String()
+	}
+	return fmt.Sprintf("%s [%s%s] %3.0f%% %d/%d %s/%s %s/s ETA %s",
+		p.Phase,
+		strings.Repeat("#", filled),
+		strings.Repeat(".", barWidth-filled),
+		ratio*100,
+		p.Done, p.Total,
+		FormatBytes(p.BytesDone), FormatBytes(p.BytesTotal), FormatBytes(uint64(p.Rate)),
+		eta,
+	)
+}
+
+func clearBarLocked() {
+	if barShown != "" {
+		fmt.Print("\r\033[K")
+	}
+}
+
+// withBar prints a log line above the progress bar.
+func withBar(print func()) {
+	barMu.Lock()
+	defer barMu.Unlock()
+	clearBarLocked()
+	print()
+	if barShown != "" {
+		fmt.Print(barShown)
+	}
+}
+
+// FormatBytes formats n with a binary unit, like "1.5 MiB".
+func FormatBytes(n uint64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	value := float64(n)
+	units := []string{"KiB", "MiB", "GiB", "TiB"}
+	idx := -1
+	for value >= unit && idx < len(units)-1 {
+		value /= unit
+		idx++
+	}
+	return fmt.Sprintf("%.1f %s", value, units[idx])
+}
@@ -9,19 +9,19 @@ import (
 func Info(text string, a ...any) {
 	msg := fmt.Sprintf(text, a...)
 	emit("info", msg)
-	fmt.Println(color.BlueString(">>> [Info]"), msg)
+	withBar(func() { fmt.Println(color.BlueString(">>> [Info]"), msg) })
 }
 
 func Error(text string, a ...any) {
 	msg := fmt.Sprintf(text, a...)
 	emit("error", msg)
-	fmt.Println(color.RedString(">>> [Error]"), msg)
+	withBar(func() { fmt.Println(color.RedString(">>> [Error]"), msg) })
 }
 
 func Warning(text string, a ...any) {
 	msg := fmt.Sprintf(text, a...)
 	emit("warning", msg)
-	fmt.Println(color.YellowString(">>> [Warning]"), msg)
+	withBar(func() { fmt.Println(color.YellowString(">>> [Warning]"), msg) })
 }
 
 func Panic(text string, a ...any) {
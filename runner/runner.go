@@ -1,12 +1,15 @@
 package runner
 
 import (
+	"context"
+	"encoding/json"
 	"flag"
 	"fmt"
 	"os"
 	"reflect"
 	"regexp"
 	"strings"
+	"time"
 
 	"vertesan/hailstorm/analyser"
 	"vertesan/hailstorm/manifest"
@@ -23,10 +26,19 @@ const (
 	DecryptedAssetsSaveDir = "cache/plain"
 	DbSaveDir              = "masterdata"
 
-	CatalogVersionFile  = "cache/currentVersion.txt"
+	CatalogVersionFile = "cache/currentVersion.txt"
+	// CatalogResInfoFile is the resInfo of the current catalog, which is ahead
+	// of CatalogVersionFile until its assets were processed.
+	CatalogResInfoFile  = "cache/catalog_version.txt"
+	CatalogFile         = "cache/catalog.bin"
+	CatalogFilePrev     = "cache/catalog_prev.bin"
 	CatalogJsonFile     = "cache/catalog.json"
 	CatalogJsonFilePrev = "cache/catalog_prev.json"
 	CatalogJsonDiffFile = "cache/catalog_diff.json"
+	DecryptFailureFile  = "cache/decrypt_failures.json"
+	AssetStateFile      = "cache/asset_state.json"
+	ClientVersionCache  = "cache/client_version.json"
+	VerifyReportFile    = "cache/download_verify.json"
 	UpdatedFlagFile     = "cache/updated"
 )
 
@@ -39,18 +51,52 @@ type Options struct {
 	Convert       bool
 	Master        bool
 	KeepPath      bool
+	Stream        bool
+	WithDeps      bool
+	KeepManifest  bool
 	ClientVersion string
 	ResInfo       string
 	FilterRegex   string
+	Origin        string
+	Mirrors       []string
+	LoginURL      string
+	PlayStoreURL  string
+
+	// Number of decrypt workers, runtime.NumCPU() when <= 0.
+	DecryptWorkers int
+	// Download limits, see network.DownloadOptions. RateLimit is parsed by
+	// network.ParseRate, eg. "2M".
+	Concurrency int
+	RateLimit   string
+	Timeout     time.Duration
+	// One of network.DownloadOrders.
+	DownloadOrder string
+	// Proxy URL for every request, see network.ClientConfig.
+	Proxy string
+	// Order of network.VersionSource names used to find the client version.
+	VersionSources []string
+	// Local encrypted manifest to parse instead of downloading one, needs
+	// ClientVersion and ResInfo.
+	ImportCatalog string
+	// resInfo to decode and print instead of running anything.
+	InspectRes string
+	// Decode the textures of the asset bundles in cache/plain into PNG files.
+	ExtractTextures bool
 }
 
-func Run(opts Options) (err error) {
+// Run executes a task described by opts. Cancelling ctx stops it between
+// files, in which case ctx.Err() is returned.
+func Run(ctx context.Context, opts Options) (err error) {
 	defer func() {
 		if r := recover(); r != nil {
+			if ctxErr := ctx.Err(); ctxErr != nil {
+				err = ctxErr
+				return
+			}
 			err = fmt.Errorf("%v", r)
 		}
 	}()
-	runUnsafe(opts)
+	runUnsafe(ctx, opts)
 	return nil
 }
 
@@ -63,9 +109,26 @@ func ParseFlags() Options {
 	fConvert := flag.Bool("convert", false, "Only generate cache/plain from existing cache/assets without downloading.")
 	fMaster := flag.Bool("master", false, "Only generate masterdata from existing cache/plain without downloading.")
 	fKeepPath := flag.Bool("keep-path", false, "Imitate url download path on file system for assets.")
+	fStream := flag.Bool("stream", false, "Decrypt assets while downloading, raw files are only written with -keepraw.")
+	fWithDeps := flag.Bool("with-deps", false, "Also download every recursive dependency of the selected assets, whether updated or not.")
+	fKeepManifest := flag.Bool("keep-manifest", false, "Keep the encrypted manifest in the version history, so that it can be parsed again with -import-catalog.")
+	fInspectRes := flag.String("inspect-res", "", "Decode a resInfo like \"R2402010@B/FicABV0d3BUb8PQHvXSsDwHw==\" into JSON with the manifest URLs and exit. Takes -client-version and -origin into account.")
+	fExtractTextures := flag.Bool("extract-textures", false, "Only decode the textures of the asset bundles in cache/plain into PNG files under cache/img/<label>, without downloading. Takes -filter-regex into account.")
+	fImportCatalog := flag.String("import-catalog", "", "Parse a local encrypted manifest instead of downloading one, needs -client-version and -res-info. Writes the catalog and its version snapshot only.")
+	fDecryptWorkers := flag.Int("decrypt-workers", 0, "Number of assets decrypted in parallel, defaults to the number of CPUs.")
+	fConcurrency := flag.Int("concurrency", 0, fmt.Sprintf("Maximum number of parallel downloads, defaults to %d.", network.MAX_CONCURRENCY))
+	fRateLimit := flag.String("rate-limit", "", "Total download bandwidth, eg. --rate-limit=2M for 2 MiB/s. Unlimited by default.")
+	fTimeout := flag.Duration("timeout", 0, "Time limit for downloading a single file, eg. --timeout=30m. Defaults to 20m.")
+	fDownloadOrder := flag.String("download-order", "", fmt.Sprintf("Order of downloads, one of %s. Databases come first unless it is %q.", strings.Join(network.DownloadOrders, ", "), network.ORDER_CATALOG))
+	fProxy := flag.String("proxy", "", "Proxy for every request, eg. --proxy=\"socks5://127.0.0.1:1080\". HTTP_PROXY and HTTPS_PROXY are used by default.")
+	fVersionSources := flag.String("version-sources", "", fmt.Sprintf("Comma separated sources of the client version, tried in order. Defaults to %q.", strings.Join(network.DefaultVersionSources, ",")))
 	fClientVersion := flag.String("client-version", "", "Specify client version manually.")
 	fResInfo := flag.String("res-info", "", "Specify resource info manually.")
 	fFilterRegex := flag.String("filter-regex", "", "Only download assets that match the regex pattern. eg. --filter-regex=\"bgm_.*\"")
+	fOrigin := flag.String("origin", "", "Override the asset origin, eg. --origin=\"http://127.0.0.1:8080\"")
+	fMirrors := flag.String("mirrors", "", "Comma separated asset mirrors to fall back to when the origin keeps failing.")
+	fLoginURL := flag.String("login-url", "", "Override the login endpoint used to fetch resource info.")
+	fPlayStoreURL := flag.String("play-url", "", "Override the Google Play page used to fetch client version.")
 	flag.Parse()
 
 	return Options{
@@ -77,30 +140,71 @@ func ParseFlags() Options {
 		Convert:       *fConvert,
 		Master:        *fMaster,
 		KeepPath:      *fKeepPath,
+		Stream:        *fStream,
+		WithDeps:      *fWithDeps,
+		KeepManifest:  *fKeepManifest,
 		ClientVersion: *fClientVersion,
 		ResInfo:       *fResInfo,
 		FilterRegex:   *fFilterRegex,
+		Origin:        *fOrigin,
+		Mirrors:       runtimecfg.SplitList(*fMirrors),
+		LoginURL:      *fLoginURL,
+		PlayStoreURL:  *fPlayStoreURL,
+
+		DecryptWorkers: *fDecryptWorkers,
+		Concurrency:    *fConcurrency,
+		RateLimit:      *fRateLimit,
+		Timeout:        *fTimeout,
+		DownloadOrder:  *fDownloadOrder,
+		Proxy:          *fProxy,
+		VersionSources: runtimecfg.SplitList(*fVersionSources),
+		ImportCatalog:  *fImportCatalog,
+		InspectRes:     *fInspectRes,
+
+		ExtractTextures: *fExtractTextures,
 	}
 }
 
-func runUnsafe(opts Options) {
+func runUnsafe(ctx context.Context, opts Options) {
 	if opts.Analyze {
 		doAnalyze()
 		return
 	}
 
+	cfg := loadRuntimeConfig()
+	if opts.InspectRes != "" {
+		runInspectRes(opts, cfg)
+		return
+	}
+	configureEndpoints(opts, cfg)
+	opts = resolveDownloadLimits(opts, cfg)
+	configureClient(opts, cfg)
+	if cfg != nil && cfg.KeepManifest {
+		opts.KeepManifest = true
+	}
+
+	if opts.ImportCatalog != "" {
+		runImportCatalog(opts)
+		return
+	}
+
 	if opts.CatalogOnly {
-		runCatalogOnly(opts)
+		runCatalogOnly(ctx, opts, cfg)
 		return
 	}
 
 	if opts.Convert {
-		runConvert()
+		runConvert(ctx, opts)
 		return
 	}
 
 	if opts.Master {
-		runMaster()
+		runMaster(ctx)
+		return
+	}
+
+	if opts.ExtractTextures {
+		runExtractTextures(ctx, opts)
 		return
 	}
 
@@ -117,12 +221,10 @@ func runUnsafe(opts Options) {
 		rich.Info("Using runtime config client/res values.")
 	}
 	if clientVersion == "" {
-		if clientVersion, err = network.GetPlayVersion(); err != nil {
-			panic(err)
-		}
+		clientVersion = resolveClientVersion(ctx, opts, cfg)
 	}
 	if resInfo == "" {
-		resInfo = network.Login(clientVersion)
+		resInfo = network.Login(ctx, clientVersion)
 	}
 
 	currentVer, err := os.ReadFile(CatalogVersionFile)
@@ -143,51 +245,29 @@ func runUnsafe(opts Options) {
 	mani := new(manifest.Manifest)
 	mani.Init(resInfo, clientVersion)
 
-	network.DownloadManifestSync(mani.RealName, ManifestSaveDir)
-	catalogFile, err := os.Open(fmt.Sprintf("%v/%v", ManifestSaveDir, mani.RealName))
-	if err != nil {
-		panic(err)
-	}
-
-	catalog := new(manifest.Catalog)
-	catalog.Init(mani, catalogFile)
-
-	if err = catalogFile.Close(); err != nil {
-		panic(err)
-	}
-	if err = os.Remove(fmt.Sprintf("%v/%v", ManifestSaveDir, mani.RealName)); err != nil {
-		panic(err)
-	}
-
-	if err := os.Rename(CatalogJsonFile, CatalogJsonFilePrev); err != nil {
-		if !os.IsNotExist(err) {
-			panic(err)
-		}
-	}
-	rich.Info("Outdated catalog was renamed to '%s'.", CatalogJsonFilePrev)
-	if err := snapshotCatalogForVersion(currentVersion, CatalogJsonFilePrev); err != nil {
-		rich.Warning("Failed to snapshot previous catalog version %q: %v", currentVersion, err)
+	catalog := &manifest.Catalog{
+		Entries: fetchCatalogEntries(ctx, mani, resInfo, opts.KeepManifest),
 	}
 
-	utils.WriteToJsonFile(catalog.Entries, CatalogJsonFile)
-	if err := snapshotCatalogForVersion(resInfo, CatalogJsonFile); err != nil {
-		rich.Warning("Failed to snapshot current catalog version %q: %v", resInfo, err)
-	}
+	oldEntries := installCatalog(catalog.Entries, resInfo, currentVersion)
 
-	oldEntries := []manifest.Entry{}
-	if err := utils.ReadFromJsonFile(CatalogJsonFilePrev, &oldEntries); err != nil {
-		if !os.IsNotExist(err) {
-			panic(err)
-		}
+	// the full catalog, dependencies are looked up here after diffing and filtering
+	fullCatalog := &manifest.Catalog{
+		Entries: catalog.Entries,
 	}
 
 	oldCatalog := &manifest.Catalog{
 		Entries: oldEntries,
 	}
 
-	if !opts.Force {
-		diff(catalog, oldCatalog)
-	}
+	// the previous catalog is ahead of the plain files when its run stopped
+	// early, only the last completed version describes them
+	state := loadAssetState(&manifest.Catalog{
+		Entries: loadVersionSnapshot(currentVersion),
+	})
+	defer saveAssetState(state)
+
+	diff(catalog, oldCatalog)
 
 	if opts.DbOnly {
 		filterDb(catalog)
@@ -197,24 +277,69 @@ func runUnsafe(opts Options) {
 		filterByRegex(catalog, opts.FilterRegex)
 	}
 
+	if opts.WithDeps {
+		expandDeps(catalog, fullCatalog)
+	}
+
+	if !opts.Force {
+		dropFresh(catalog, state)
+	}
+
 	if len(catalog.Entries) == 0 {
 		rich.Info("Nothing is updated, will be stopping process.")
 		return
 	}
 
-	keepPath := opts.KeepPath
-	network.DownloadAssetsAsync(catalog, AssetsSaveDir, &keepPath)
+	rateLimit, err := network.ParseRate(opts.RateLimit)
+	if err != nil {
+		panic(err)
+	}
+	downloadOpts := network.DownloadOptions{
+		KeepPath:    opts.KeepPath,
+		KeepRaw:     opts.KeepRaw,
+		Concurrency: opts.Concurrency,
+		RateLimit:   rateLimit,
+		Order:       opts.DownloadOrder,
+		State:       state,
+	}
+	if opts.Stream {
+		downloadOpts.PlainDir = DecryptedAssetsSaveDir
+	}
+	verifyResults, failures := network.DownloadAssetsAsync(ctx, catalog, AssetsSaveDir, downloadOpts)
+	reportVerification(verifyResults)
 
-	manifest.DecryptAllAssets(catalog, DecryptedAssetsSaveDir, AssetsSaveDir)
+	// streamed entries are decoded along with the download
+	if !opts.Stream {
+		failures = manifest.DecryptAllAssets(ctx, catalog, DecryptedAssetsSaveDir, AssetsSaveDir, opts.DecryptWorkers, state)
+	}
+	reportDecryptFailures(failures)
+	failed := make(map[string]struct{})
+	for _, failure := range failures {
+		failed[failure.Label] = struct{}{}
+	}
 
 	if err := os.MkdirAll(DbSaveDir, 0755); err != nil {
 		panic(err)
 	}
-	errCount := 0
+	selected := make(map[string]struct{}, len(catalog.Entries))
 	for _, entry := range catalog.Entries {
+		selected[entry.StrLabelCrc] = struct{}{}
+	}
+	errCount := 0
+	// databases decrypted by an interrupted run are parsed as well
+	for _, entry := range fullCatalog.Entries {
 		if entry.StrTypeCrc != "tsv" {
 			continue
 		}
+		checkCancelled(ctx)
+		if _, ok := selected[entry.StrLabelCrc]; !ok && !masterdataOutdated(&entry) {
+			continue
+		}
+		if _, ok := failed[entry.StrLabelCrc]; ok {
+			rich.Warning("Database %q failed to be decrypted, skipping.", entry.StrLabelCrc)
+			errCount++
+			continue
+		}
 		dbFile, err := os.Open(DecryptedAssetsSaveDir + "/" + entry.StrLabelCrc)
 		if err != nil {
 			panic(err)
@@ -250,19 +375,192 @@ func runUnsafe(opts Options) {
 	}
 
 	if !opts.KeepRaw {
+		if len(failed) > 0 {
+			rich.Warning("Raw assets are kept in %q, retry the failed ones with -convert.", AssetsSaveDir)
+			return
+		}
 		if err := os.RemoveAll(AssetsSaveDir); err != nil {
 			panic(err)
 		}
 	}
 }
 
+// resolveDownloadLimits fills the download limits left unset by flags from the
+// runtime config.
+func resolveDownloadLimits(opts Options, cfg *runtimecfg.Config) Options {
+	if cfg != nil {
+		if opts.Concurrency <= 0 {
+			opts.Concurrency = cfg.DownloadConcurrency
+		}
+		if strings.TrimSpace(opts.RateLimit) == "" {
+			opts.RateLimit = cfg.DownloadRateLimit
+		}
+		if opts.Timeout <= 0 && cfg.DownloadTimeout != "" {
+			timeout, err := time.ParseDuration(cfg.DownloadTimeout)
+			if err != nil {
+				panic(fmt.Errorf("invalid downloadTimeout %q: %v", cfg.DownloadTimeout, err))
+			}
+			opts.Timeout = timeout
+		}
+		if strings.TrimSpace(opts.DownloadOrder) == "" {
+			opts.DownloadOrder = cfg.DownloadOrder
+		}
+	}
+	// fail before anything is downloaded
+	if _, err := network.OrderEntries(nil, opts.DownloadOrder); err != nil {
+		panic(err)
+	}
+	return opts
+}
+
+// resolveClientVersion asks the version sources configured by opts and the
+// runtime config for the current client version.
+func resolveClientVersion(ctx context.Context, opts Options, cfg *runtimecfg.Config) string {
+	order := opts.VersionSources
+	sourceCfg := network.VersionSourceConfig{}
+	var ttl time.Duration
+	if cfg != nil {
+		if len(order) == 0 {
+			order = cfg.VersionSources
+		}
+		sourceCfg.StaticVersion = cfg.ClientVersion
+		sourceCfg.File = cfg.VersionFile
+		for _, pair := range cfg.VersionHistory {
+			sourceCfg.History = append(sourceCfg.History, pair.ClientVersion)
+		}
+		if cfg.VersionCacheTTL != "" {
+			var err error
+			if ttl, err = time.ParseDuration(cfg.VersionCacheTTL); err != nil {
+				panic(fmt.Errorf("invalid versionCacheTTL %q: %v", cfg.VersionCacheTTL, err))
+			}
+		}
+	}
+	sources, err := network.ParseVersionSources(order, sourceCfg)
+	if err != nil {
+		panic(err)
+	}
+	clientVersion, err := network.ResolveClientVersion(ctx, sources, ClientVersionCache, ttl)
+	if err != nil {
+		panic(err)
+	}
+	return clientVersion
+}
+
+// configureClient sets up the HTTP client of every request from opts and the
+// runtime config, flags take precedence over the config.
+func configureClient(opts Options, cfg *runtimecfg.Config) {
+	clientCfg := network.DefaultClientConfig()
+	if cfg != nil {
+		clientCfg.Proxy = cfg.HTTPProxy
+		clientCfg.CAFiles = cfg.CAFiles
+		clientCfg.KeepAlive = cfg.KeepAlive
+		clientCfg.UserAgent = cfg.UserAgent
+		if cfg.RequestTimeout != "" {
+			timeout, err := time.ParseDuration(cfg.RequestTimeout)
+			if err != nil {
+				panic(fmt.Errorf("invalid requestTimeout %q: %v", cfg.RequestTimeout, err))
+			}
+			clientCfg.RequestTimeout = timeout
+		}
+	}
+	if proxy := strings.TrimSpace(opts.Proxy); proxy != "" {
+		clientCfg.Proxy = proxy
+	}
+	if opts.Timeout > 0 {
+		clientCfg.DownloadTimeout = opts.Timeout
+	}
+	if err := network.ConfigureClient(clientCfg); err != nil {
+		panic(err)
+	}
+}
+
+// reportDecryptFailures writes the failures of the last decryption, or removes
+// the report of an earlier one when everything succeeded.
+func reportDecryptFailures(failures []manifest.DecryptFailure) {
+	if len(failures) == 0 {
+		if err := os.Remove(DecryptFailureFile); err != nil && !os.IsNotExist(err) {
+			panic(err)
+		}
+		return
+	}
+	utils.WriteToJsonFile(failures, DecryptFailureFile)
+}
+
+// loadRuntimeConfig returns nil when there is no usable runtime config.
+func loadRuntimeConfig() *runtimecfg.Config {
+	cfg, err := runtimecfg.Load()
+	if err != nil {
+		if !os.IsNotExist(err) {
+			rich.Warning("Failed to load runtime config: %v", err)
+		}
+		return nil
+	}
+	return cfg
+}
+
+// configureEndpoints applies endpoint overrides, flags take precedence over the
+// runtime config.
+func configureEndpoints(opts Options, cfg *runtimecfg.Config) {
+	network.SetEndpoints(resolveEndpoints(opts, cfg))
+}
+
+func resolveEndpoints(opts Options, cfg *runtimecfg.Config) network.Endpoints {
+	endpoints := network.Endpoints{
+		LoginUrl:     opts.LoginURL,
+		PlayStoreUrl: opts.PlayStoreURL,
+	}
+	origin := strings.TrimSpace(opts.Origin)
+	mirrors := opts.Mirrors
+	if cfg != nil {
+		if origin == "" {
+			origin = cfg.AssetOrigin
+		}
+		if len(mirrors) == 0 {
+			mirrors = cfg.AssetMirrors
+		}
+		if strings.TrimSpace(endpoints.LoginUrl) == "" {
+			endpoints.LoginUrl = cfg.LoginURL
+		}
+		if strings.TrimSpace(endpoints.PlayStoreUrl) == "" {
+			endpoints.PlayStoreUrl = cfg.PlayStoreURL
+		}
+	}
+	if origin == "" {
+		origin = network.ORIGIN
+	}
+	endpoints.Origins = append([]string{origin}, mirrors...)
+	return endpoints
+}
+
+// checkCancelled panics with ctx.Err() once ctx is cancelled, Run turns it
+// back into the returned error.
+func checkCancelled(ctx context.Context) {
+	if err := ctx.Err(); err != nil {
+		rich.Warning("Task was cancelled.")
+		panic(err)
+	}
+}
+
+func reportVerification(results []manifest.VerifyResult) {
+	counts := make(map[manifest.VerifyStatus]int)
+	for _, result := range results {
+		counts[result.Status]++
+	}
+	utils.WriteToJsonFile(results, VerifyReportFile)
+	rich.Info(
+		"Download verification: %d checksum verified, %d size verified only.",
+		counts[manifest.VerifyOk],
+		counts[manifest.VerifySizeOnly],
+	)
+}
+
 func doAnalyze() {
 	rich.Info("Start analyzing code...")
 	analyser.Analyze()
 	rich.Info("Analysis completed.")
 }
 
-func runCatalogOnly(opts Options) {
+func runCatalogOnly(ctx context.Context, opts Options, cfg *runtimecfg.Config) {
 	explicitClient := strings.TrimSpace(opts.ClientVersion)
 	explicitRes := strings.TrimSpace(opts.ResInfo)
 
@@ -290,12 +588,10 @@ func runCatalogOnly(opts Options) {
 			rich.Info("Catalog-only mode: using runtime config client/res values.")
 		}
 		if clientVersion == "" {
-			if clientVersion, err = network.GetPlayVersion(); err != nil {
-				panic(err)
-			}
+			clientVersion = resolveClientVersion(ctx, opts, cfg)
 		}
 		if resInfo == "" {
-			resInfo = network.Login(clientVersion)
+			resInfo = network.Login(ctx, clientVersion)
 		}
 		pairs = append(pairs, runtimecfg.VersionPair{
 			ClientVersion: clientVersion,
@@ -324,7 +620,11 @@ func runCatalogOnly(opts Options) {
 			continue
 		}
 
-		entries := fetchCatalogEntries(clientVersion, resInfo)
+		checkCancelled(ctx)
+		rich.Info("Catalog-only mode: fetching manifest for %q.", resInfo)
+		mani := new(manifest.Manifest)
+		mani.Init(resInfo, clientVersion)
+		entries := fetchCatalogEntries(ctx, mani, resInfo, opts.KeepManifest)
 		if err := writeCatalogSnapshotForVersion(resInfo, entries); err != nil {
 			panic(err)
 		}
@@ -334,30 +634,100 @@ func runCatalogOnly(opts Options) {
 	rich.Info("Catalog-only mode completed. processed=%d skipped=%d.", processed, skipped)
 }
 
-func fetchCatalogEntries(clientVersion string, resInfo string) []manifest.Entry {
-	rich.Info("Catalog-only mode: fetching manifest for %q.", resInfo)
-	mani := new(manifest.Manifest)
-	mani.Init(resInfo, clientVersion)
-
-	network.DownloadManifestSync(mani.RealName, ManifestSaveDir)
+// fetchCatalogEntries downloads and parses the manifest of resInfo described
+// by mani. It is deleted afterwards, keep copies it into the version history
+// first.
+func fetchCatalogEntries(ctx context.Context, mani *manifest.Manifest, resInfo string, keep bool) []manifest.Entry {
+	network.DownloadManifestSync(ctx, mani.RealName, mani.Size, ManifestSaveDir)
 	manifestPath := fmt.Sprintf("%v/%v", ManifestSaveDir, mani.RealName)
-	catalogFile, err := os.Open(manifestPath)
+	entries := parseManifestFile(mani, manifestPath)
+
+	if keep {
+		if err := keepManifestForVersion(resInfo, mani.ClientVersion, manifestPath); err != nil {
+			rich.Warning("Failed to keep manifest of version %q: %v", resInfo, err)
+		}
+	}
+	if err := os.Remove(manifestPath); err != nil {
+		panic(err)
+	}
+	return entries
+}
+
+// parseManifestFile decrypts and parses the encrypted manifest at path.
+func parseManifestFile(mani *manifest.Manifest, path string) []manifest.Entry {
+	catalogFile, err := os.Open(path)
 	if err != nil {
 		panic(err)
 	}
+	defer catalogFile.Close()
 
 	catalog := new(manifest.Catalog)
 	catalog.Init(mani, catalogFile)
+	return catalog.Entries
+}
 
-	if err = catalogFile.Close(); err != nil {
+// InspectResInfo decodes resInfo with the manifest URLs on the asset origins
+// of the runtime config.
+func InspectResInfo(resInfo string, clientVersion string) (*network.ResInfoInspection, error) {
+	endpoints := resolveEndpoints(Options{}, loadRuntimeConfig())
+	return network.InspectResInfo(resInfo, clientVersion, endpoints.Origins)
+}
+
+// runInspectRes prints what opts.InspectRes tells about its manifest.
+func runInspectRes(opts Options, cfg *runtimecfg.Config) {
+	endpoints := resolveEndpoints(opts, cfg)
+	inspection, err := network.InspectResInfo(opts.InspectRes, opts.ClientVersion, endpoints.Origins)
+	if err != nil {
 		panic(err)
 	}
-	if err = os.Remove(manifestPath); err != nil {
+	raw, err := json.MarshalIndent(inspection, "", "  ")
+	if err != nil {
 		panic(err)
 	}
-	return catalog.Entries
+	fmt.Println(string(raw))
+}
+
+// runImportCatalog parses a local encrypted manifest into the current catalog
+// and its version snapshot, nothing is downloaded. Like after a run stopped
+// before the assets, the current version is left alone, so that the next run
+// still fetches them.
+func runImportCatalog(opts Options) {
+	clientVersion := strings.TrimSpace(opts.ClientVersion)
+	resInfo := strings.TrimSpace(opts.ResInfo)
+	if clientVersion == "" || resInfo == "" {
+		rich.Panic("Import mode needs the -client-version and -res-info the manifest was published with.")
+	}
+	rich.Info("Import mode: parsing local manifest %q for %q.", opts.ImportCatalog, resInfo)
+
+	mani := new(manifest.Manifest)
+	mani.Init(resInfo, clientVersion)
+	info, err := os.Stat(opts.ImportCatalog)
+	if err != nil {
+		panic(err)
+	}
+	if uint64(info.Size()) != mani.Size {
+		rich.Panic("%q has %d bytes, but the manifest of %q has %d, check -res-info.", opts.ImportCatalog, info.Size(), resInfo, mani.Size)
+	}
+
+	entries := parseManifestFile(mani, opts.ImportCatalog)
+	if err := os.MkdirAll(ManifestSaveDir, 0755); err != nil {
+		panic(err)
+	}
+	currentVer, err := os.ReadFile(CatalogVersionFile)
+	if err != nil && !os.IsNotExist(err) {
+		panic(err)
+	}
+	installCatalog(entries, resInfo, strings.TrimSpace(string(currentVer)))
+	if opts.KeepManifest {
+		if err := keepManifestForVersion(resInfo, clientVersion, opts.ImportCatalog); err != nil {
+			panic(err)
+		}
+	}
+	rich.Info("Import mode completed: %d entries of %q.", len(entries), resInfo)
 }
 
+// diff reports the entries which are new or updated since outDatedCatalog,
+// which entries to fetch is decided by dropFresh.
 func diff(catalog *manifest.Catalog, outDatedCatalog *manifest.Catalog) {
 	rich.Info("Start doing diff.")
 	oldMap := make(map[uint64]manifest.Entry)
@@ -376,9 +746,72 @@ func diff(catalog *manifest.Catalog, outDatedCatalog *manifest.Catalog) {
 		entries = append(entries, entry)
 	}
 	utils.WriteToJsonFile(entries, CatalogJsonDiffFile)
+}
+
+// loadAssetState reads the asset state. When there is none yet, it is seeded
+// from completedCatalog, the catalog of the last completed run, with the plain
+// files already present.
+func loadAssetState(completedCatalog *manifest.Catalog) *manifest.State {
+	state, err := manifest.LoadState(AssetStateFile)
+	if err != nil {
+		panic(err)
+	}
+	if state.Len() > 0 || completedCatalog == nil {
+		return state
+	}
+	for i := range completedCatalog.Entries {
+		entry := &completedCatalog.Entries[i]
+		if _, err := os.Stat(DecryptedAssetsSaveDir + "/" + manifest.PlainName(entry)); err == nil {
+			if err := state.Record(entry); err != nil {
+				panic(err)
+			}
+		}
+	}
+	if state.Len() > 0 {
+		rich.Info("Asset state was seeded with %d entries of the last completed catalog.", state.Len())
+	}
+	return state
+}
+
+func saveAssetState(state *manifest.State) {
+	if err := state.Save(); err != nil {
+		rich.Error("Failed to save asset state: %v", err)
+	}
+}
+
+// dropFresh removes the entries whose plain file is already produced from the
+// same checksum.
+func dropFresh(catalog *manifest.Catalog, state *manifest.State) {
+	entries := []manifest.Entry{}
+	for i := range catalog.Entries {
+		if !state.Fresh(&catalog.Entries[i], DecryptedAssetsSaveDir) {
+			entries = append(entries, catalog.Entries[i])
+		}
+	}
+	if skipped := len(catalog.Entries) - len(entries); skipped > 0 {
+		rich.Info("%d entries are up to date, %d to fetch.", skipped, len(entries))
+	}
 	catalog.Entries = entries
 }
 
+// masterdataOutdated tells whether the plain file of a database is newer than
+// the masterdata parsed from it.
+func masterdataOutdated(entry *manifest.Entry) bool {
+	ins, ok := master.MasterMap[entry.StrLabelCrc]
+	if !ok {
+		return false
+	}
+	plain, err := os.Stat(DecryptedAssetsSaveDir + "/" + entry.StrLabelCrc)
+	if err != nil {
+		return false
+	}
+	yaml, err := os.Stat(DbSaveDir + "/" + reflect.TypeOf(ins).Name() + ".yaml")
+	if err != nil {
+		return true
+	}
+	return yaml.ModTime().Before(plain.ModTime())
+}
+
 func filterDb(catalog *manifest.Catalog) {
 	s := []manifest.Entry{}
 	for _, entry := range catalog.Entries {
@@ -405,15 +838,23 @@ func filterByRegex(catalog *manifest.Catalog, pattern string) {
 	catalog.Entries = s
 }
 
-func runConvert() {
+// expandDeps adds the recursive dependencies of the entries of catalog, taken
+// from fullCatalog.
+func expandDeps(catalog *manifest.Catalog, fullCatalog *manifest.Catalog) {
+	selected := len(catalog.Entries)
+	catalog.Entries = fullCatalog.DepClosure(catalog.Entries)
+	rich.Info("%d dependencies added to %d selected entries.", len(catalog.Entries)-selected, selected)
+}
+
+func runConvert(ctx context.Context, opts Options) {
 	rich.Info("Convert mode: generating cache/plain from existing cache/assets...")
 
-	if _, err := os.Stat(CatalogJsonFile); os.IsNotExist(err) {
+	if !fileExists(CurrentCatalogFile()) {
 		rich.Panic("No existing catalog found. Run without -convert first to download assets.")
 	}
 
-	entries := []manifest.Entry{}
-	if err := utils.ReadFromJsonFile(CatalogJsonFile, &entries); err != nil {
+	entries, err := manifest.LoadCatalogEntries(CurrentCatalogFile())
+	if err != nil {
 		panic(err)
 	}
 
@@ -421,20 +862,27 @@ func runConvert() {
 		Entries: entries,
 	}
 
-	manifest.DecryptAllAssets(catalog, DecryptedAssetsSaveDir, AssetsSaveDir)
+	state := loadAssetState(nil)
+	defer saveAssetState(state)
+	if !opts.Force {
+		dropFresh(catalog, state)
+	}
+
+	failures := manifest.DecryptAllAssets(ctx, catalog, DecryptedAssetsSaveDir, AssetsSaveDir, opts.DecryptWorkers, state)
+	reportDecryptFailures(failures)
 
 	rich.Info("Conversion completed.")
 }
 
-func runMaster() {
+func runMaster(ctx context.Context) {
 	rich.Info("Master mode: generating masterdata from existing cache/plain...")
 
-	if _, err := os.Stat(CatalogJsonFile); os.IsNotExist(err) {
+	if !fileExists(CurrentCatalogFile()) {
 		rich.Panic("No existing catalog found. Run without -master first to download assets.")
 	}
 
-	entries := []manifest.Entry{}
-	if err := utils.ReadFromJsonFile(CatalogJsonFile, &entries); err != nil {
+	entries, err := manifest.LoadCatalogEntries(CurrentCatalogFile())
+	if err != nil {
 		panic(err)
 	}
 
@@ -453,6 +901,7 @@ func runMaster() {
 		if entry.StrTypeCrc != "tsv" {
 			continue
 		}
+		checkCancelled(ctx)
 		dbFile, err := os.Open(DecryptedAssetsSaveDir + "/" + entry.StrLabelCrc)
 		if err != nil {
 			rich.Warning("Database file %q not found in cache/plain, skipping.", entry.StrLabelCrc)
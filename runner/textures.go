@@ -0,0 +1,123 @@
+package runner
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync"
+
+	"vertesan/hailstorm/manifest"
+	"vertesan/hailstorm/rich"
+	"vertesan/hailstorm/unity"
+)
+
+const TextureSaveDir = "cache/img"
+
+type textureResult struct {
+	entry   *manifest.Entry
+	written []string
+	err     error
+}
+
+// runExtractTextures decodes the textures of the asset bundles in cache/plain
+// into PNG files under cache/img/<label>, the native replacement of unpack.py.
+// Every bundle has its own directory, so textures of the same name in
+// different bundles neither overwrite each other nor race between workers.
+func runExtractTextures(ctx context.Context, opts Options) {
+	rich.Info("Texture mode: extracting textures from existing cache/plain...")
+
+	if !fileExists(CurrentCatalogFile()) {
+		rich.Panic("No existing catalog found. Run without -extract-textures first to download assets.")
+	}
+	entries, err := manifest.LoadCatalogEntries(CurrentCatalogFile())
+	if err != nil {
+		panic(err)
+	}
+	catalog := &manifest.Catalog{
+		Entries: entries,
+	}
+	if opts.FilterRegex != "" {
+		filterByRegex(catalog, opts.FilterRegex)
+	}
+
+	bundles := []*manifest.Entry{}
+	for i := range catalog.Entries {
+		entry := &catalog.Entries[i]
+		if entry.ResourceType == 1 && fileExists(filepath.Join(DecryptedAssetsSaveDir, manifest.PlainName(entry))) {
+			bundles = append(bundles, entry)
+		}
+	}
+	if len(bundles) == 0 {
+		rich.Warning("No asset bundle found in cache/plain.")
+		return
+	}
+	if err := os.MkdirAll(TextureSaveDir, 0755); err != nil {
+		panic(err)
+	}
+
+	jobs := make(chan *manifest.Entry)
+	results := make(chan textureResult)
+	var wg sync.WaitGroup
+	for range min(runtime.NumCPU(), len(bundles)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for entry := range jobs {
+				written, err := extractBundleTextures(entry)
+				results <- textureResult{entry, written, err}
+			}
+		}()
+	}
+	go func() {
+		defer close(jobs)
+		for _, entry := range bundles {
+			select {
+			case <-ctx.Done():
+				return
+			case jobs <- entry:
+			}
+		}
+	}()
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	textures, failures := 0, 0
+	for result := range results {
+		textures += len(result.written)
+		for _, path := range result.written {
+			rich.Info("Saved %q.", path)
+		}
+		if result.err != nil {
+			failures++
+			rich.Error("Failed to extract textures of %q: %v", result.entry.StrLabelCrc, result.err)
+		}
+	}
+	checkCancelled(ctx)
+
+	if failures > 0 {
+		rich.Error("%d textures written to %s, %d of %d asset bundles had failures.", textures, TextureSaveDir, failures, len(bundles))
+	} else {
+		rich.Info("%d textures of %d asset bundles written to %s.", textures, len(bundles), TextureSaveDir)
+	}
+}
+
+// extractBundleTextures writes the textures of the plain file of entry into
+// the directory of its label. The file may not be a Unity bundle at all.
+func extractBundleTextures(entry *manifest.Entry) ([]string, error) {
+	path := filepath.Join(DecryptedAssetsSaveDir, manifest.PlainName(entry))
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	head := make([]byte, len(unity.BUNDLE_SIGNATURE)+1)
+	_, err = io.ReadFull(file, head)
+	file.Close()
+	if err != nil || !unity.IsBundle(head) {
+		return nil, nil
+	}
+	return unity.ExtractTextures(path, filepath.Join(TextureSaveDir, entry.StrLabelCrc))
+}
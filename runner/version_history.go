@@ -7,33 +7,141 @@ import (
 	"strings"
 
 	"vertesan/hailstorm/manifest"
+	"vertesan/hailstorm/rich"
 	"vertesan/hailstorm/utils"
 )
 
 const (
 	CatalogVersionHistoryDir = "cache/version-history"
-	versionCatalogFileName   = "catalog.json"
-	versionMarkerFileName    = "version.txt"
+	versionCatalogFileName   = "catalog.bin"
+	// the JSON export of the snapshot, the only file earlier versions wrote
+	versionCatalogJsonFileName = "catalog.json"
+	versionMarkerFileName      = "version.txt"
+	// the encrypted manifest and the client version it is parsed with
+	versionManifestFileName = "manifest.enc"
+	versionClientFileName   = "client_version.txt"
 )
 
-func snapshotCatalogForVersion(version string, sourcePath string) error {
-	version = strings.TrimSpace(version)
-	if version == "" || !fileExists(sourcePath) {
-		return nil
+// CurrentCatalogFile gives the file the current catalog is read from, the JSON
+// export when an earlier version wrote nothing else.
+func CurrentCatalogFile() string {
+	return preferCatalogFile(CatalogFile, CatalogJsonFile)
+}
+
+// VersionSnapshotCatalogFile gives the catalog of the snapshot in dir, or ""
+// when there is none.
+func VersionSnapshotCatalogFile(dir string) string {
+	path := preferCatalogFile(
+		filepath.Join(dir, versionCatalogFileName),
+		filepath.Join(dir, versionCatalogJsonFileName),
+	)
+	if !fileExists(path) {
+		return ""
 	}
+	return path
+}
 
-	dir := filepath.Join(CatalogVersionHistoryDir, sanitizeVersionForPath(version))
+func preferCatalogFile(path string, legacyPath string) string {
+	if fileExists(path) || !fileExists(legacyPath) {
+		return path
+	}
+	return legacyPath
+}
+
+// saveCatalog writes the current catalog of resInfo, and its JSON export for
+// the tools reading it.
+func saveCatalog(entries []manifest.Entry, resInfo string) {
+	if err := manifest.WriteCatalogFile(entries, CatalogFile); err != nil {
+		panic(err)
+	}
+	rich.Info("Writing catalog file '%s' done.", CatalogFile)
+	utils.WriteToJsonFile(entries, CatalogJsonFile)
+	if err := os.WriteFile(CatalogResInfoFile, []byte(resInfo), 0o644); err != nil {
+		panic(err)
+	}
+}
+
+// catalogResInfo gives the resInfo of the current catalog, fallback when it
+// was written before that was recorded.
+func catalogResInfo(fallback string) string {
+	data, err := os.ReadFile(CatalogResInfoFile)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			panic(err)
+		}
+		return fallback
+	}
+	return strings.TrimSpace(string(data))
+}
+
+// rotateCatalog renames the current catalog to the previous one and returns
+// its entries, none on the first run.
+func rotateCatalog() []manifest.Entry {
+	for _, pair := range [][2]string{
+		{CatalogFile, CatalogFilePrev},
+		{CatalogJsonFile, CatalogJsonFilePrev},
+	} {
+		// a stale previous catalog must not outlive a legacy current one
+		if err := os.Remove(pair[1]); err != nil && !os.IsNotExist(err) {
+			panic(err)
+		}
+		if err := os.Rename(pair[0], pair[1]); err != nil && !os.IsNotExist(err) {
+			panic(err)
+		}
+	}
+	prevPath := preferCatalogFile(CatalogFilePrev, CatalogJsonFilePrev)
+	rich.Info("Outdated catalog was renamed to '%s'.", prevPath)
+
+	entries, err := manifest.LoadCatalogEntries(prevPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		panic(err)
+	}
+	return entries
+}
+
+// installCatalog makes entries of resInfo the current catalog and returns the
+// previous one, both are snapshotted into the version history. The previous
+// catalog may be ahead of currentVersion when it was imported or its run
+// stopped early, so it is snapshotted under its own resInfo.
+func installCatalog(entries []manifest.Entry, resInfo string, currentVersion string) []manifest.Entry {
+	oldVersion := catalogResInfo(currentVersion)
+	oldEntries := rotateCatalog()
+	if len(oldEntries) > 0 {
+		if err := writeCatalogSnapshotForVersion(oldVersion, oldEntries); err != nil {
+			rich.Warning("Failed to snapshot previous catalog version %q: %v", oldVersion, err)
+		}
+	}
+
+	saveCatalog(entries, resInfo)
+	if err := writeCatalogSnapshotForVersion(resInfo, entries); err != nil {
+		rich.Warning("Failed to snapshot current catalog version %q: %v", resInfo, err)
+	}
+	return oldEntries
+}
+
+// keepManifestForVersion copies the encrypted manifest at path into the
+// version history of resInfo, with the client version needed to parse it
+// again.
+func keepManifestForVersion(resInfo string, clientVersion string, path string) error {
+	dir := filepath.Join(CatalogVersionHistoryDir, sanitizeVersionForPath(resInfo))
 	if err := os.MkdirAll(dir, 0o755); err != nil {
 		return err
 	}
-
-	if err := copyFile(sourcePath, filepath.Join(dir, versionCatalogFileName)); err != nil {
+	if err := copyFile(path, filepath.Join(dir, versionManifestFileName)); err != nil {
 		return err
 	}
-
-	return os.WriteFile(filepath.Join(dir, versionMarkerFileName), []byte(version), 0o644)
+	if err := os.WriteFile(filepath.Join(dir, versionClientFileName), []byte(clientVersion), 0o644); err != nil {
+		return err
+	}
+	rich.Info("Manifest of %q was kept in '%s'.", resInfo, dir)
+	return nil
 }
 
+// writeCatalogSnapshotForVersion snapshots entries into the version history of
+// version, as a catalog file together with its JSON export.
 func writeCatalogSnapshotForVersion(version string, entries []manifest.Entry) error {
 	version = strings.TrimSpace(version)
 	if version == "" {
@@ -44,7 +152,10 @@ func writeCatalogSnapshotForVersion(version string, entries []manifest.Entry) er
 		return err
 	}
 
-	utils.WriteToJsonFile(entries, filepath.Join(dir, versionCatalogFileName))
+	if err := manifest.WriteCatalogFile(entries, filepath.Join(dir, versionCatalogFileName)); err != nil {
+		return err
+	}
+	utils.WriteToJsonFile(entries, filepath.Join(dir, versionCatalogJsonFileName))
 	return os.WriteFile(filepath.Join(dir, versionMarkerFileName), []byte(version), 0o644)
 }
 
@@ -53,12 +164,26 @@ func versionSnapshotExists(version string) bool {
 	if version == "" {
 		return false
 	}
-	path := filepath.Join(
-		CatalogVersionHistoryDir,
-		sanitizeVersionForPath(version),
-		versionCatalogFileName,
-	)
-	return fileExists(path)
+	return VersionSnapshotCatalogFile(filepath.Join(CatalogVersionHistoryDir, sanitizeVersionForPath(version))) != ""
+}
+
+// loadVersionSnapshot reads the catalog snapshotted for version, nil when
+// there is none.
+func loadVersionSnapshot(version string) []manifest.Entry {
+	version = strings.TrimSpace(version)
+	if version == "" {
+		return nil
+	}
+	path := VersionSnapshotCatalogFile(filepath.Join(CatalogVersionHistoryDir, sanitizeVersionForPath(version)))
+	if path == "" {
+		return nil
+	}
+	entries, err := manifest.LoadCatalogEntries(path)
+	if err != nil {
+		rich.Warning("Failed to load catalog snapshot of version %q: %v", version, err)
+		return nil
+	}
+	return entries
 }
 
 func sanitizeVersionForPath(version string) string {
@@ -22,6 +22,41 @@ type Config struct {
 	ResInfo        string        `json:"resInfo"`
 	AssetRipperDir string        `json:"assetRipperDir"`
 	VersionHistory []VersionPair `json:"versionHistory"`
+	// AssetOrigin replaces the official asset origin when set.
+	AssetOrigin string `json:"assetOrigin"`
+	// AssetMirrors are tried in order after AssetOrigin keeps failing.
+	AssetMirrors []string `json:"assetMirrors"`
+	LoginURL     string   `json:"loginUrl"`
+	PlayStoreURL string   `json:"playStoreUrl"`
+	// Download limits used when the matching flags are not given.
+	// DownloadRateLimit is like "2M", DownloadTimeout like "30m".
+	DownloadConcurrency int    `json:"downloadConcurrency"`
+	DownloadRateLimit   string `json:"downloadRateLimit"`
+	DownloadTimeout     string `json:"downloadTimeout"`
+	// DownloadOrder is one of "catalog", "priority", "size" or "deps".
+	DownloadOrder string `json:"downloadOrder"`
+	// Outbound HTTP settings. HTTPProxy falls back to the HTTP_PROXY family of
+	// environment variables, CAFiles are PEM files trusted on top of the
+	// system roots and RequestTimeout (like "30s") applies to everything but
+	// file downloads.
+	HTTPProxy      string   `json:"httpProxy"`
+	CAFiles        []string `json:"caFiles"`
+	KeepAlive      bool     `json:"keepAlive"`
+	RequestTimeout string   `json:"requestTimeout"`
+	UserAgent      string   `json:"userAgent"`
+	// Client version discovery. VersionSources is the order of "playstore",
+	// "file" (VersionFile, a path or an URL), "static" (ClientVersion) and
+	// "history" (the highest of VersionHistory). The version found is reused
+	// for VersionCacheTTL (like "1h") and whenever every source fails.
+	VersionSources  []string `json:"versionSources"`
+	VersionFile     string   `json:"versionFile"`
+	VersionCacheTTL string   `json:"versionCacheTTL"`
+	// KeepManifest keeps every encrypted manifest in the version history, so
+	// that it can be parsed again offline.
+	KeepManifest bool `json:"keepManifest"`
+	// HcaKey deciphers HCA audio of cipher type 56, as a decimal or 0x
+	// prefixed number.
+	HcaKey string `json:"hcaKey"`
 }
 
 func Path() string {
@@ -49,6 +84,21 @@ func normalizeConfig(cfg *Config) {
 	cfg.ClientVersion = strings.TrimSpace(cfg.ClientVersion)
 	cfg.ResInfo = strings.TrimSpace(cfg.ResInfo)
 	cfg.AssetRipperDir = strings.TrimSpace(cfg.AssetRipperDir)
+	cfg.AssetOrigin = strings.TrimSpace(cfg.AssetOrigin)
+	cfg.AssetMirrors = normalizeList(cfg.AssetMirrors)
+	cfg.LoginURL = strings.TrimSpace(cfg.LoginURL)
+	cfg.PlayStoreURL = strings.TrimSpace(cfg.PlayStoreURL)
+	cfg.DownloadRateLimit = strings.TrimSpace(cfg.DownloadRateLimit)
+	cfg.DownloadTimeout = strings.TrimSpace(cfg.DownloadTimeout)
+	cfg.DownloadOrder = strings.TrimSpace(cfg.DownloadOrder)
+	cfg.HTTPProxy = strings.TrimSpace(cfg.HTTPProxy)
+	cfg.CAFiles = normalizeList(cfg.CAFiles)
+	cfg.RequestTimeout = strings.TrimSpace(cfg.RequestTimeout)
+	cfg.UserAgent = strings.TrimSpace(cfg.UserAgent)
+	cfg.VersionSources = normalizeList(cfg.VersionSources)
+	cfg.VersionFile = strings.TrimSpace(cfg.VersionFile)
+	cfg.VersionCacheTTL = strings.TrimSpace(cfg.VersionCacheTTL)
+	cfg.HcaKey = strings.TrimSpace(cfg.HcaKey)
 
 	filtered := make([]VersionPair, 0, len(cfg.VersionHistory))
 	for _, item := range cfg.VersionHistory {
@@ -65,6 +115,21 @@ func normalizeConfig(cfg *Config) {
 	cfg.VersionHistory = filtered
 }
 
+// SplitList splits a comma separated flag value into its non-empty items.
+func SplitList(value string) []string {
+	return normalizeList(strings.Split(value, ","))
+}
+
+func normalizeList(items []string) []string {
+	filtered := make([]string, 0, len(items))
+	for _, item := range items {
+		if item = strings.TrimSpace(item); item != "" {
+			filtered = append(filtered, item)
+		}
+	}
+	return filtered
+}
+
 func ResolvePair(clientVersion string, resInfo string) (string, string, bool, error) {
 	clientVersion = strings.TrimSpace(clientVersion)
 	resInfo = strings.TrimSpace(resInfo)
@@ -0,0 +1,725 @@
+package unity
+
+import (
+  "encoding/binary"
+  "math/bits"
+)
+
+// ASTC blocks are decoded following the Khronos specification for LDR
+// profiles. Blocks that use reserved or HDR encodings decode to the error
+// color, magenta.
+
+// iseRange describes an integer sequence encoding: values below
+// (3 or 5 or 1) << bits, as trits or quints followed by plain bits.
+type iseRange struct {
+  trits, quints, bits int
+}
+
+func (q iseRange) levels() int {
+  switch {
+  case q.trits > 0:
+    return 3 << q.bits
+  case q.quints > 0:
+    return 5 << q.bits
+  }
+  return 1 << q.bits
+}
+
+// size is the number of bits taken by count values.
+func (q iseRange) size(count int) int {
+  size := count * q.bits
+  if q.trits > 0 {
+    size += (count*8 + 4) / 5
+  }
+  if q.quints > 0 {
+    size += (count*7 + 2) / 3
+  }
+  return size
+}
+
+// iseRanges lists the ranges in increasing order, from 2 to 256 levels.
+var iseRanges = []iseRange{
+  {0, 0, 1}, {1, 0, 0}, {0, 0, 2}, {0, 1, 0}, {1, 0, 1}, {0, 0, 3}, {0, 1, 1},
+  {1, 0, 2}, {0, 0, 4}, {0, 1, 2}, {1, 0, 3}, {0, 0, 5}, {0, 1, 3}, {1, 0, 4},
+  {0, 0, 6}, {0, 1, 4}, {1, 0, 5}, {0, 0, 7}, {0, 1, 5}, {1, 0, 6}, {0, 0, 8},
+}
+
+// astcBits is a 128 bit block read from its least significant bit.
+type astcBits [2]uint64
+
+func (b astcBits) get(pos int, count int) int {
+  if count == 0 || pos >= 128 {
+    return 0
+  }
+  var v uint64
+  if pos >= 64 {
+    v = b[1] >> (pos - 64)
+  } else {
+    v = b[0] >> pos
+    if pos > 0 {
+      v |= b[1] << (64 - pos)
+    }
+  }
+  if pos+count > 128 {
+    count = 128 - pos
+  }
+  return int(v & (1<<count - 1))
+}
+
+func (b astcBits) reversed() astcBits {
+  return astcBits{bits.Reverse64(b[1]), bits.Reverse64(b[0])}
+}
+
+// decodeISE reads count values encoded with q from b, starting at pos.
+// Missing bits past the end of the block read as zero.
+func decodeISE(b astcBits, pos int, count int, q iseRange) []int {
+  values := make([]int, 0, count+4)
+  read := func(n int) int {
+    v := b.get(pos, n)
+    pos += n
+    return v
+  }
+  switch {
+  case q.trits > 0:
+    for len(values) < count {
+      var m [5]int
+      var t int
+      m[0] = read(q.bits)
+      t = read(2)
+      m[1] = read(q.bits)
+      t |= read(2) << 2
+      m[2] = read(q.bits)
+      t |= read(1) << 4
+      m[3] = read(q.bits)
+      t |= read(2) << 5
+      m[4] = read(q.bits)
+      t |= read(1) << 7
+      trits := decodeTrits(t)
+      for i := range m {
+        values = append(values, trits[i]<<q.bits|m[i])
+      }
+    }
+  case q.quints > 0:
+    for len(values) < count {
+      var m [3]int
+      var t int
+      m[0] = read(q.bits)
+      t = read(3)
+      m[1] = read(q.bits)
+      t |= read(2) << 3
+      m[2] = read(q.bits)
+      t |= read(2) << 5
+      quints := decodeQuints(t)
+      for i := range m {
+        values = append(values, quints[i]<<q.bits|m[i])
+      }
+    }
+  default:
+    for len(values) < count {
+      values = append(values, read(q.bits))
+    }
+  }
+  return values[:count]
+}
+
+func bit(v int, n int) int {
+  return v >> n & 1
+}
+
+func decodeTrits(t int) [5]int {
+  var c, t4, t3, t2, t1, t0 int
+  if t>>2&7 == 7 {
+    c = (t>>5&7)<<2 | t&3
+    t4, t3 = 2, 2
+  } else {
+    c = t & 0x1F
+    if t>>5&3 == 3 {
+      t4, t3 = 2, bit(t, 7)
+    } else {
+      t4, t3 = bit(t, 7), t>>5&3
+    }
+  }
+  switch {
+  case c&3 == 3:
+    t2, t1 = 2, bit(c, 4)
+    t0 = bit(c, 3)<<1 | (bit(c, 2) &^ bit(c, 3))
+  case c>>2&3 == 3:
+    t2, t1, t0 = 2, 2, c&3
+  default:
+    t2, t1 = bit(c, 4), c>>2&3
+    t0 = bit(c, 1)<<1 | (bit(c, 0) &^ bit(c, 1))
+  }
+  return [5]int{t0, t1, t2, t3, t4}
+}
+
+func decodeQuints(q int) [3]int {
+  var q2, q1, q0 int
+  if q>>1&3 == 3 && q>>5&3 == 0 {
+    q2 = bit(q, 0)<<2 | (bit(q, 4)&^bit(q, 0))<<1 | (bit(q, 3) &^ bit(q, 0))
+    q1, q0 = 4, 4
+  } else {
+    var c int
+    if q>>1&3 == 3 {
+      q2 = 4
+      c = (q>>3&3)<<3 | (^q>>5&3)<<1 | bit(q, 0)
+    } else {
+      q2 = q >> 5 & 3
+      c = q & 0x1F
+    }
+    if c&7 == 5 {
+      q1, q0 = 4, c>>3&3
+    } else {
+      q1, q0 = c>>3&3, c&7
+    }
+  }
+  return [3]int{q0, q1, q2}
+}
+
+// unquantizeColor maps an endpoint value of range q to 0-255.
+func unquantizeColor(v int, q iseRange) int {
+  if q.trits == 0 && q.quints == 0 {
+    return replicateBits(v, q.bits, 8)
+  }
+  a := 0
+  if v&1 != 0 {
+    a = 0x1FF
+  }
+  m := v & (1<<q.bits - 1)
+  var b, c, d int
+  if q.trits > 0 {
+    d = v >> q.bits
+    switch q.bits {
+    case 1:
+      c = 204
+    case 2:
+      x := bit(m, 1)
+      b = x<<8 | x<<4 | x<<2 | x<<1
+      c = 93
+    case 3:
+      cb := m >> 1 & 3
+      b = cb<<7 | cb<<2 | cb
+      c = 44
+    case 4:
+      dcb := m >> 1 & 7
+      b = dcb<<6 | dcb
+      c = 22
+    case 5:
+      edcb := m >> 1 & 0xF
+      b = edcb<<5 | edcb>>2
+      c = 11
+    case 6:
+      fedcb := m >> 1 & 0x1F
+      b = fedcb<<4 | fedcb>>4
+      c = 5
+    }
+  } else {
+    d = v >> q.bits
+    switch q.bits {
+    case 1:
+      c = 113
+    case 2:
+      x := bit(m, 1)
+      b = x<<8 | x<<3 | x<<2
+      c = 54
+    case 3:
+      cb := m >> 1 & 3
+      b = cb<<7 | cb<<1 | cb>>1
+      c = 26
+    case 4:
+      dcb := m >> 1 & 7
+      b = dcb<<6 | dcb>>1
+      c = 13
+    case 5:
+      edcb := m >> 1 & 0xF
+      b = edcb<<5 | edcb>>3
+      c = 6
+    }
+  }
+  t := d*c + b
+  t ^= a
+  return a&0x80 | t>>2
+}
+
+// unquantizeWeight maps a weight of range q to 0-64.
+func unquantizeWeight(v int, q iseRange) int {
+  var w int
+  switch {
+  case q.trits == 0 && q.quints == 0:
+    w = replicateBits(v, q.bits, 6)
+  case q.bits == 0 && q.trits > 0:
+    w = [3]int{0, 32, 63}[v]
+  case q.bits == 0:
+    w = [5]int{0, 16, 32, 47, 63}[v]
+  default:
+    a := 0
+    if v&1 != 0 {
+      a = 0x7F
+    }
+    m := v & (1<<q.bits - 1)
+    d := v >> q.bits
+    var b, c int
+    if q.trits > 0 {
+      switch q.bits {
+      case 1:
+        c = 50
+      case 2:
+        x := bit(m, 1)
+        b = x<<6 | x<<2 | x
+        c = 23
+      case 3:
+        cb := m >> 1 & 3
+        b = cb<<5 | cb
+        c = 11
+      }
+    } else {
+      switch q.bits {
+      case 1:
+        c = 28
+      case 2:
+        x := bit(m, 1)
+        b = x<<6 | x<<1
+        c = 13
+      }
+    }
+    t := d*c + b
+    t ^= a
+    w = a&0x20 | t>>2
+  }
+  if w > 32 {
+    w++
+  }
+  return w
+}
+
+func replicateBits(v int, from int, to int) int {
+  if from == 0 {
+    return 0
+  }
+  v &= 1<<from - 1
+  result := 0
+  shift := to
+  for shift > 0 {
+    shift -= from
+    if shift >= 0 {
+      result |= v << shift
+    } else {
+      result |= v >> -shift
+    }
+  }
+  return result
+}
+
+var astcErrorColor = [4]uint8{0xFF, 0x00, 0xFF, 0xFF}
+
+func fillBlock(out []byte, color [4]uint8) {
+  for i := 0; i+4 <= len(out); i += 4 {
+    copy(out[i:i+4], color[:])
+  }
+}
+
+// astcBlockDecoder returns a decoder of blocks of bw x bh texels.
+func astcBlockDecoder(bw int, bh int) func(block []byte, out []byte) {
+  return func(block []byte, out []byte) {
+    if !decodeASTC(block, out, bw, bh) {
+      fillBlock(out, astcErrorColor)
+    }
+  }
+}
+
+// decodeASTC decodes a block of bw x bh texels into out, and reports false
+// for the encodings that must produce the error color.
+func decodeASTC(block []byte, out []byte, bw int, bh int) bool {
+  b := astcBits{binary.LittleEndian.Uint64(block), binary.LittleEndian.Uint64(block[8:])}
+
+  if b.get(0, 9) == 0x1FC {
+    // void extent, a constant color
+    if b.get(9, 1) != 0 {
+      return false
+    }
+    var color [4]uint8
+    for i := range color {
+      color[i] = uint8(b.get(64+16*i, 16) >> 8)
+    }
+    fillBlock(out, color)
+    return true
+  }
+
+  gridW, gridH, weightRange, dualPlane, ok := decodeBlockMode(b.get(0, 11))
+  if !ok || gridW > bw || gridH > bh {
+    return false
+  }
+  planes := 1
+  if dualPlane {
+    planes = 2
+  }
+  weightCount := gridW * gridH * planes
+  weightBits := weightRange.size(weightCount)
+  if weightCount > 64 || weightBits < 24 || weightBits > 96 {
+    return false
+  }
+
+  partitions := b.get(11, 2) + 1
+  if partitions == 4 && dualPlane {
+    return false
+  }
+
+  var modes [4]int
+  configEnd := 128 - weightBits
+  colorStart := 17
+  partitionSeed := 0
+  if partitions == 1 {
+    modes[0] = b.get(13, 4)
+  } else {
+    colorStart = 29
+    partitionSeed = b.get(13, 10)
+    encoded := b.get(23, 6)
+    if encoded&3 == 0 {
+      for i := range partitions {
+        modes[i] = encoded >> 2
+      }
+    } else {
+      extraBits := 3*partitions - 4
+      configEnd -= extraBits
+      encoded |= b.get(configEnd, extraBits) << 6
+      baseClass := encoded&3 - 1
+      pos := 2
+      classes := [4]int{}
+      for i := range partitions {
+        classes[i] = encoded >> pos & 1
+        pos++
+      }
+      for i := range partitions {
+        modes[i] = (baseClass+classes[i])<<2 | encoded>>pos&3
+        pos += 2
+      }
+    }
+  }
+  planeComponent := -1
+  if dualPlane {
+    configEnd -= 2
+    planeComponent = b.get(configEnd, 2)
+  }
+
+  valueCount := 0
+  for i := range partitions {
+    valueCount += (modes[i]>>2 + 1) * 2
+  }
+  colorBits := configEnd - colorStart
+  if valueCount > 18 || colorBits < (13*valueCount+4)/5 {
+    return false
+  }
+  var colorRange iseRange
+  found := false
+  for _, q := range iseRanges {
+    if q.levels() >= 6 && q.size(valueCount) <= colorBits {
+      colorRange, found = q, true
+    }
+  }
+  if !found {
+    return false
+  }
+  values := decodeISE(b, colorStart, valueCount, colorRange)
+  for i := range values {
+    values[i] = unquantizeColor(values[i], colorRange)
+  }
+
+  var endpoints [4][2][4]int
+  offset := 0
+  for i := range partitions {
+    count := (modes[i]>>2 + 1) * 2
+    e0, e1, ok := decodeEndpoints(modes[i], values[offset:offset+count])
+    if !ok {
+      return false
+    }
+    endpoints[i] = [2][4]int{e0, e1}
+    offset += count
+  }
+
+  // weights are stored from the end of the block with their bits reversed
+  rawWeights := decodeISE(b.reversed(), 0, weightCount, weightRange)
+  for i := range rawWeights {
+    rawWeights[i] = unquantizeWeight(rawWeights[i], weightRange)
+  }
+  weights := infillWeights(rawWeights, gridW, gridH, bw, bh, planes)
+
+  smallBlock := bw*bh < 31
+  for y := 0; y < bh; y++ {
+    for x := 0; x < bw; x++ {
+      i := y*bw + x
+      part := 0
+      if partitions > 1 {
+        part = selectPartition(partitionSeed, x, y, partitions, smallBlock)
+      }
+      e := endpoints[part]
+      for ch := 0; ch < 4; ch++ {
+        w := weights[0][i]
+        if ch == planeComponent {
+          w = weights[1][i]
+        }
+        c0, c1 := e[0][ch]*257, e[1][ch]*257
+        c := (c0*(64-w) + c1*w + 32) >> 6
+        out[i*4+ch] = uint8(c >> 8)
+      }
+    }
+  }
+  return true
+}
+
+// decodeBlockMode reads the weight grid size, the weight range and whether
+// there are two planes of weights from the 11 bit block mode.
+func decodeBlockMode(mode int) (int, int, iseRange, bool, bool) {
+  var w, h, r int
+  high := bit(mode, 9)
+  dual := bit(mode, 10) != 0
+  a := mode >> 5 & 3
+  if mode&3 != 0 {
+    r = bit(mode, 4) | (mode&3)<<1
+    b := mode >> 7 & 3
+    switch mode >> 2 & 3 {
+    case 0:
+      w, h = b+4, a+2
+    case 1:
+      w, h = b+8, a+2
+    case 2:
+      w, h = a+2, b+8
+    case 3:
+      if bit(mode, 8) == 0 {
+        w, h = a+2, bit(mode, 7)+6
+      } else {
+        w, h = bit(mode, 7)+2, a+2
+      }
+    }
+  } else {
+    r = bit(mode, 4) | (mode>>2&3)<<1
+    if mode&0xF == 0 {
+      return 0, 0, iseRange{}, false, false
+    }
+    switch mode >> 7 & 3 {
+    case 0:
+      w, h = 12, a+2
+    case 1:
+      w, h = a+2, 12
+    case 2:
+      w, h = a+6, mode>>9&3+6
+      high, dual = 0, false
+    case 3:
+      switch a {
+      case 0:
+        w, h = 6, 10
+      case 1:
+        w, h = 10, 6
+      default:
+        return 0, 0, iseRange{}, false, false
+      }
+    }
+  }
+  if r < 2 {
+    return 0, 0, iseRange{}, false, false
+  }
+  // r 2-7 selects 2, 3, 4, 5, 6 or 8 levels, high range 10 to 32
+  index := r - 2
+  if high != 0 {
+    index += 6
+  }
+  return w, h, iseRanges[index], dual, true
+}
+
+func infillWeights(raw []int, gridW int, gridH int, bw int, bh int, planes int) [2][]int {
+  var weights [2][]int
+  for p := 0; p < planes; p++ {
+    weights[p] = make([]int, bw*bh)
+  }
+  if planes == 1 {
+    weights[1] = weights[0]
+  }
+  if gridW == bw && gridH == bh {
+    for i := 0; i < bw*bh; i++ {
+      for p := 0; p < planes; p++ {
+        weights[p][i] = raw[i*planes+p]
+      }
+    }
+    return weights
+  }
+  ds := (1024 + bw/2) / (bw - 1)
+  dt := (1024 + bh/2) / (bh - 1)
+  at := func(x int, y int, p int) int {
+    if x >= gridW || y >= gridH {
+      return 0
+    }
+    return raw[(y*gridW+x)*planes+p]
+  }
+  for t := 0; t < bh; t++ {
+    for s := 0; s < bw; s++ {
+      gs := (ds*s*(gridW-1) + 32) >> 6
+      gt := (dt*t*(gridH-1) + 32) >> 6
+      js, fs := gs>>4, gs&0xF
+      jt, ft := gt>>4, gt&0xF
+      w11 := (fs*ft + 8) >> 4
+      w10 := ft - w11
+      w01 := fs - w11
+      w00 := 16 - fs - ft + w11
+      for p := 0; p < planes; p++ {
+        weights[p][t*bw+s] = (at(js, jt, p)*w00 + at(js+1, jt, p)*w01 +
+          at(js, jt+1, p)*w10 + at(js+1, jt+1, p)*w11 + 8) >> 4
+      }
+    }
+  }
+  return weights
+}
+
+func bitTransferSigned(a int, b int) (int, int) {
+  b = b>>1 | a&0x80
+  a = a >> 1 & 0x3F
+  if a&0x20 != 0 {
+    a -= 0x40
+  }
+  return a, b
+}
+
+func blueContract(r int, g int, b int, a int) [4]int {
+  return [4]int{(r + b) >> 1, (g + b) >> 1, b, a}
+}
+
+func clampColor(c [4]int) [4]int {
+  for i := range c {
+    c[i] = int(clamp255(c[i]))
+  }
+  return c
+}
+
+// decodeEndpoints decodes the two endpoints of a partition from its color
+// values, for the LDR endpoint modes.
+func decodeEndpoints(mode int, v []int) ([4]int, [4]int, bool) {
+  switch mode {
+  case 0:
+    return [4]int{v[0], v[0], v[0], 255}, [4]int{v[1], v[1], v[1], 255}, true
+  case 1:
+    l0 := v[0]>>2 | v[1]&0xC0
+    l1 := min(l0+v[1]&0x3F, 255)
+    return [4]int{l0, l0, l0, 255}, [4]int{l1, l1, l1, 255}, true
+  case 4:
+    return [4]int{v[0], v[0], v[0], v[2]}, [4]int{v[1], v[1], v[1], v[3]}, true
+  case 5:
+    d0, b0 := bitTransferSigned(v[1], v[0])
+    d2, b2 := bitTransferSigned(v[3], v[2])
+    return clampColor([4]int{b0, b0, b0, b2}), clampColor([4]int{b0 + d0, b0 + d0, b0 + d0, b2 + d2}), true
+  case 6:
+    return [4]int{v[0] * v[3] >> 8, v[1] * v[3] >> 8, v[2] * v[3] >> 8, 255}, [4]int{v[0], v[1], v[2], 255}, true
+  case 8:
+    if v[1]+v[3]+v[5] >= v[0]+v[2]+v[4] {
+      return [4]int{v[0], v[2], v[4], 255}, [4]int{v[1], v[3], v[5], 255}, true
+    }
+    return blueContract(v[1], v[3], v[5], 255), blueContract(v[0], v[2], v[4], 255), true
+  case 9:
+    d0, b0 := bitTransferSigned(v[1], v[0])
+    d2, b2 := bitTransferSigned(v[3], v[2])
+    d4, b4 := bitTransferSigned(v[5], v[4])
+    if d0+d2+d4 >= 0 {
+      return clampColor([4]int{b0, b2, b4, 255}), clampColor([4]int{b0 + d0, b2 + d2, b4 + d4, 255}), true
+    }
+    return clampColor(blueContract(b0+d0, b2+d2, b4+d4, 255)), clampColor(blueContract(b0, b2, b4, 255)), true
+  case 10:
+    return [4]int{v[0] * v[3] >> 8, v[1] * v[3] >> 8, v[2] * v[3] >> 8, v[4]}, [4]int{v[0], v[1], v[2], v[5]}, true
+  case 12:
+    if v[1]+v[3]+v[5] >= v[0]+v[2]+v[4] {
+      return [4]int{v[0], v[2], v[4], v[6]}, [4]int{v[1], v[3], v[5], v[7]}, true
+    }
+    return blueContract(v[1], v[3], v[5], v[7]), blueContract(v[0], v[2], v[4], v[6]), true
+  case 13:
+    d0, b0 := bitTransferSigned(v[1], v[0])
+    d2, b2 := bitTransferSigned(v[3], v[2])
+    d4, b4 := bitTransferSigned(v[5], v[4])
+    d6, b6 := bitTransferSigned(v[7], v[6])
+    if d0+d2+d4 >= 0 {
+      return clampColor([4]int{b0, b2, b4, b6}), clampColor([4]int{b0 + d0, b2 + d2, b4 + d4, b6 + d6}), true
+    }
+    return clampColor(blueContract(b0+d0, b2+d2, b4+d4, b6+d6)), clampColor(blueContract(b0, b2, b4, b6)), true
+  }
+  // HDR endpoint modes
+  return [4]int{}, [4]int{}, false
+}
+
+func hash52(v uint32) uint32 {
+  v ^= v >> 15
+  v *= 0xEEDE0891
+  v ^= v >> 5
+  v += v << 16
+  v ^= v >> 7
+  v ^= v >> 3
+  v ^= v << 6
+  v ^= v >> 17
+  return v
+}
+
+// selectPartition is the partition of texel x, y for the partition pattern
+// seed, with the hash of the specification.
+func selectPartition(seed int, x int, y int, partitions int, smallBlock bool) int {
+  if smallBlock {
+    x <<= 1
+    y <<= 1
+  }
+  seed += (partitions - 1) * 1024
+  rnum := hash52(uint32(seed))
+  var s [12]int
+  for i := 0; i < 8; i++ {
+    s[i] = int(rnum >> (4 * i) & 0xF)
+  }
+  s[8] = int(rnum >> 18 & 0xF)
+  s[9] = int(rnum >> 22 & 0xF)
+  s[10] = int(rnum >> 26 & 0xF)
+  s[11] = int((rnum>>30 | rnum<<2) & 0xF)
+  for i := range s {
+    s[i] *= s[i]
+  }
+  var sh1, sh2 int
+  if seed&1 != 0 {
+    sh1 = 5
+    if seed&2 != 0 {
+      sh1 = 4
+    }
+    sh2 = 5
+    if partitions == 3 {
+      sh2 = 6
+    }
+  } else {
+    sh1 = 5
+    if partitions == 3 {
+      sh1 = 6
+    }
+    sh2 = 5
+    if seed&2 != 0 {
+      sh2 = 4
+    }
+  }
+  sh3 := sh2
+  if seed&0x10 != 0 {
+    sh3 = sh1
+  }
+  for i := 0; i < 8; i += 2 {
+    s[i] >>= sh1
+    s[i+1] >>= sh2
+  }
+  for i := 8; i < 12; i++ {
+    s[i] >>= sh3
+  }
+  // z is 0 for 2D textures
+  a := (s[0]*x + s[1]*y + int(rnum>>14)) & 0x3F
+  b := (s[2]*x + s[3]*y + int(rnum>>10)) & 0x3F
+  c := (s[4]*x + s[5]*y + int(rnum>>6)) & 0x3F
+  d := (s[6]*x + s[7]*y + int(rnum>>2)) & 0x3F
+  if partitions < 4 {
+    d = 0
+  }
+  if partitions < 3 {
+    c = 0
+  }
+  switch {
+  case a >= b && a >= c && a >= d:
+    return 0
+  case b >= c && b >= d:
+    return 1
+  case c >= d:
+    return 2
+  }
+  return 3
+}
@@ -0,0 +1,316 @@
+package unity
+
+import (
+  "bytes"
+  "encoding/binary"
+  "errors"
+  "fmt"
+  "io"
+  "os"
+  "strings"
+
+  "github.com/pierrec/lz4/v4"
+  "github.com/ulikunitz/xz/lzma"
+)
+
+const BUNDLE_SIGNATURE = "UnityFS"
+
+// Compression types of blocks and of the block info.
+const (
+  COMPRESSION_NONE  = 0
+  COMPRESSION_LZMA  = 1
+  COMPRESSION_LZ4   = 2
+  COMPRESSION_LZ4HC = 3
+)
+
+// MAX_UNCOMPRESSED_SIZE bounds the uncompressed data of a bundle, sizes read
+// from the file are checked against it before anything is allocated.
+const MAX_UNCOMPRESSED_SIZE = 1 << 30
+
+// LZ4 cannot expand a block more than about 255 times.
+const LZ4_MAX_RATIO = 255
+
+// Flags of the bundle header.
+const (
+  FLAG_COMPRESSION_MASK       = 0x3F
+  FLAG_DIRECTORY_INFO         = 0x40
+  FLAG_BLOCKS_INFO_AT_END     = 0x80
+  FLAG_BLOCKS_INFO_PADDED     = 0x200
+  NODE_FLAG_SERIALIZED_FILE   = 0x04
+  BLOCK_FLAG_COMPRESSION_MASK = 0x3F
+)
+
+// Bundle is a decompressed UnityFS asset bundle.
+type Bundle struct {
+  Signature     string
+  FormatVersion uint32
+  UnityVersion  string
+  UnityRevision string
+  Size          int64
+  Flags         uint32
+  Blocks        []BlockInfo
+  Nodes         []Node
+  // the concatenated uncompressed blocks, nodes are slices of it
+  data []byte
+}
+
+type BlockInfo struct {
+  UncompressedSize uint32
+  CompressedSize   uint32
+  Flags            uint16
+}
+
+// Node is a file inside a bundle.
+type Node struct {
+  Offset int64
+  Size   int64
+  Flags  uint32
+  Path   string
+}
+
+func CompressionName(compression int) string {
+  switch compression {
+  case COMPRESSION_NONE:
+    return "none"
+  case COMPRESSION_LZMA:
+    return "lzma"
+  case COMPRESSION_LZ4:
+    return "lz4"
+  case COMPRESSION_LZ4HC:
+    return "lz4hc"
+  }
+  return fmt.Sprintf("unknown(%d)", compression)
+}
+
+// IsBundle tells whether data starts like a UnityFS bundle.
+func IsBundle(data []byte) bool {
+  return bytes.HasPrefix(data, []byte(BUNDLE_SIGNATURE+"\x00"))
+}
+
+// OpenBundle reads the bundle at path.
+func OpenBundle(path string) (*Bundle, error) {
+  data, err := os.ReadFile(path)
+  if err != nil {
+    return nil, err
+  }
+  bundle, err := ParseBundle(data)
+  if err != nil {
+    return nil, fmt.Errorf("%s: %w", path, err)
+  }
+  return bundle, nil
+}
+
+// ParseBundle reads the header, the block info and the directory of data, and
+// decompresses every block.
+func ParseBundle(data []byte) (*Bundle, error) {
+  if !IsBundle(data) {
+    return nil, errors.New("not a UnityFS bundle")
+  }
+  r := newReader(data, binary.BigEndian)
+  b := &Bundle{
+    Signature:     r.cstring(),
+    FormatVersion: r.u32(),
+    UnityVersion:  r.cstring(),
+    UnityRevision: r.cstring(),
+    Size:          r.i64(),
+  }
+  compressedInfoSize := int(r.u32())
+  uncompressedInfoSize := int(r.u32())
+  b.Flags = r.u32()
+  if r.err != nil {
+    return nil, fmt.Errorf("bundle header: %w", r.err)
+  }
+  if b.FormatVersion < 6 {
+    return nil, fmt.Errorf("UnityFS format version %d is not supported", b.FormatVersion)
+  }
+  if b.FormatVersion >= 7 {
+    r.align(16)
+  }
+
+  var compressedInfo []byte
+  if b.Flags&FLAG_BLOCKS_INFO_AT_END != 0 {
+    if compressedInfoSize > len(data) {
+      return nil, fmt.Errorf("block info: %w", errTruncated)
+    }
+    compressedInfo = data[len(data)-compressedInfoSize:]
+  } else {
+    compressedInfo = r.bytes(compressedInfoSize)
+  }
+  if r.err != nil {
+    return nil, fmt.Errorf("block info: %w", r.err)
+  }
+  info, err := decompress(int(b.Flags&FLAG_COMPRESSION_MASK), compressedInfo, uncompressedInfoSize)
+  if err != nil {
+    return nil, fmt.Errorf("block info: %w", err)
+  }
+  if err := b.readBlocksInfo(info); err != nil {
+    return nil, err
+  }
+  if b.Flags&FLAG_BLOCKS_INFO_PADDED != 0 {
+    r.align(16)
+  }
+
+  total := 0
+  for i, block := range b.Blocks {
+    compression := int(block.Flags & BLOCK_FLAG_COMPRESSION_MASK)
+    if err := checkUncompressedSize(compression, int(block.CompressedSize), int(block.UncompressedSize)); err != nil {
+      return nil, fmt.Errorf("block %d: %w", i, err)
+    }
+    total += int(block.UncompressedSize)
+    if total > MAX_UNCOMPRESSED_SIZE {
+      return nil, fmt.Errorf("blocks have more than %d bytes", MAX_UNCOMPRESSED_SIZE)
+    }
+  }
+  b.data = make([]byte, 0, total)
+  for i, block := range b.Blocks {
+    compressed := r.bytes(int(block.CompressedSize))
+    if r.err != nil {
+      return nil, fmt.Errorf("block %d: %w", i, r.err)
+    }
+    plain, err := decompress(int(block.Flags&BLOCK_FLAG_COMPRESSION_MASK), compressed, int(block.UncompressedSize))
+    if err != nil {
+      return nil, fmt.Errorf("block %d: %w", i, err)
+    }
+    b.data = append(b.data, plain...)
+  }
+
+  for _, node := range b.Nodes {
+    if node.Offset < 0 || node.Size < 0 || node.Offset > int64(len(b.data))-node.Size {
+      return nil, fmt.Errorf("node %q lies outside of the blocks", node.Path)
+    }
+  }
+  return b, nil
+}
+
+func (b *Bundle) readBlocksInfo(info []byte) error {
+  r := newReader(info, binary.BigEndian)
+  r.skip(16) // hash of the uncompressed data
+  b.Blocks = make([]BlockInfo, r.count(10))
+  for i := range b.Blocks {
+    b.Blocks[i] = BlockInfo{
+      UncompressedSize: r.u32(),
+      CompressedSize:   r.u32(),
+      Flags:            r.u16(),
+    }
+  }
+  b.Nodes = make([]Node, r.count(21))
+  for i := range b.Nodes {
+    b.Nodes[i] = Node{
+      Offset: r.i64(),
+      Size:   r.i64(),
+      Flags:  r.u32(),
+      Path:   r.cstring(),
+    }
+  }
+  if r.err != nil {
+    return fmt.Errorf("block info: %w", r.err)
+  }
+  return nil
+}
+
+// Compression of the blocks, of the first one when they differ.
+func (b *Bundle) Compression() int {
+  if len(b.Blocks) == 0 {
+    return COMPRESSION_NONE
+  }
+  return int(b.Blocks[0].Flags & BLOCK_FLAG_COMPRESSION_MASK)
+}
+
+// File returns the content of node.
+func (b *Bundle) File(node Node) []byte {
+  return b.data[node.Offset : node.Offset+node.Size]
+}
+
+// IsSerializedFile tells whether node holds objects, as opposed to resources
+// like the .resS textures or .resource audio they point to.
+func (node Node) IsSerializedFile() bool {
+  if node.Flags&NODE_FLAG_SERIALIZED_FILE != 0 {
+    return true
+  }
+  return !strings.HasSuffix(node.Path, ".resS") && !strings.HasSuffix(node.Path, ".resource")
+}
+
+// SerializedFiles parses every serialized file of the bundle.
+func (b *Bundle) SerializedFiles() ([]*SerializedFile, error) {
+  files := []*SerializedFile{}
+  for _, node := range b.Nodes {
+    if !node.IsSerializedFile() {
+      continue
+    }
+    file, err := ParseSerializedFile(b.File(node))
+    if err != nil {
+      return nil, fmt.Errorf("%s: %w", node.Path, err)
+    }
+    file.Path = node.Path
+    files = append(files, file)
+  }
+  return files, nil
+}
+
+// Resource returns the content of the node at path, which is how objects
+// refer to their streamed data, like "archive:/CAB-xxx/CAB-xxx.resS".
+func (b *Bundle) Resource(path string) ([]byte, bool) {
+  name := path[strings.LastIndex(path, "/")+1:]
+  for _, node := range b.Nodes {
+    if node.Path == path || node.Path == name {
+      return b.File(node), true
+    }
+  }
+  return nil, false
+}
+
+// checkUncompressedSize rejects a size that compressedSize bytes cannot
+// decompress to, or that is too large to be allocated.
+func checkUncompressedSize(compression int, compressedSize int, size int) error {
+  if size < 0 || size > MAX_UNCOMPRESSED_SIZE {
+    return fmt.Errorf("uncompressed size %d is out of range", size)
+  }
+  switch compression {
+  case COMPRESSION_LZ4, COMPRESSION_LZ4HC:
+    if size > compressedSize*LZ4_MAX_RATIO+16 {
+      return fmt.Errorf("%d bytes cannot decompress to %d bytes", compressedSize, size)
+    }
+  }
+  return nil
+}
+
+func decompress(compression int, src []byte, size int) ([]byte, error) {
+  if err := checkUncompressedSize(compression, len(src), size); err != nil {
+    return nil, err
+  }
+  switch compression {
+  case COMPRESSION_NONE:
+    if len(src) != size {
+      return nil, fmt.Errorf("stored block has %d bytes, expect %d", len(src), size)
+    }
+    return src, nil
+  case COMPRESSION_LZMA:
+    // Unity leaves out the uncompressed size of the .lzma header
+    if len(src) < 5 {
+      return nil, errTruncated
+    }
+    header := make([]byte, 13)
+    copy(header, src[:5])
+    binary.LittleEndian.PutUint64(header[5:], uint64(size))
+    lzmaReader, err := lzma.NewReader(io.MultiReader(bytes.NewReader(header), bytes.NewReader(src[5:])))
+    if err != nil {
+      return nil, err
+    }
+    dst := make([]byte, size)
+    if _, err := io.ReadFull(lzmaReader, dst); err != nil {
+      return nil, fmt.Errorf("lzma: %w", err)
+    }
+    return dst, nil
+  case COMPRESSION_LZ4, COMPRESSION_LZ4HC:
+    dst := make([]byte, size)
+    n, err := lz4.UncompressBlock(src, dst)
+    if err != nil {
+      return nil, fmt.Errorf("lz4: %w", err)
+    }
+    if n != size {
+      return nil, fmt.Errorf("lz4 block has %d bytes, expect %d", n, size)
+    }
+    return dst, nil
+  }
+  return nil, fmt.Errorf("unsupported compression %s", CompressionName(compression))
+}
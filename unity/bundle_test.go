@@ -0,0 +1,214 @@
+package unity
+
+import (
+  "bytes"
+  "encoding/binary"
+  "testing"
+
+  "github.com/pierrec/lz4/v4"
+  "github.com/ulikunitz/xz/lzma"
+)
+
+// testBlockHash marks the start of the block info of a test bundle.
+var testBlockHash = bytes.Repeat([]byte{0xCD}, 16)
+
+type testBundleNode struct {
+  path  string
+  flags uint32
+  data  []byte
+}
+
+// compressTest compresses src the way Unity stores it in a bundle.
+func compressTest(compression int, src []byte) []byte {
+  switch compression {
+  case COMPRESSION_LZ4:
+    dst := make([]byte, lz4.CompressBlockBound(len(src)))
+    n, err := lz4.CompressBlock(src, dst, nil)
+    if err != nil || n == 0 {
+      panic("incompressible lz4 test data")
+    }
+    return dst[:n]
+  case COMPRESSION_LZMA:
+    buf := &bytes.Buffer{}
+    w, err := lzma.WriterConfig{Size: int64(len(src))}.NewWriter(buf)
+    if err != nil {
+      panic(err)
+    }
+    w.Write(src)
+    w.Close()
+    // Unity leaves out the uncompressed size of the header
+    return append(buf.Bytes()[:5:5], buf.Bytes()[13:]...)
+  }
+  return src
+}
+
+// encodeTestBundle encodes a bundle of nodes, their data split into two blocks
+// of compression, and its block info compressed with infoCompression.
+func encodeTestBundle(compression int, infoCompression int, flags uint32, nodes ...testBundleNode) []byte {
+  content := []byte{}
+  info := newTestWriter(binary.BigEndian)
+  info.Write(testBlockHash)
+  nodeInfo := newTestWriter(binary.BigEndian)
+  nodeInfo.u32(uint32(len(nodes)))
+  for _, node := range nodes {
+    nodeInfo.u64(uint64(len(content)))
+    nodeInfo.u64(uint64(len(node.data)))
+    nodeInfo.u32(node.flags)
+    nodeInfo.cstring(node.path)
+    content = append(content, node.data...)
+  }
+  blocks := [][]byte{content[:len(content)/2], content[len(content)/2:]}
+  info.u32(uint32(len(blocks)))
+  compressedBlocks := []byte{}
+  for _, block := range blocks {
+    compressed := compressTest(compression, block)
+    info.u32(uint32(len(block)))
+    info.u32(uint32(len(compressed)))
+    info.u16(uint16(compression))
+    compressedBlocks = append(compressedBlocks, compressed...)
+  }
+  info.Write(nodeInfo.Bytes())
+  compressedInfo := compressTest(infoCompression, info.Bytes())
+
+  w := newTestWriter(binary.BigEndian)
+  w.cstring(BUNDLE_SIGNATURE)
+  w.u32(7)
+  w.cstring("5.x.x")
+  w.cstring("2022.3.21f1")
+  sizeAt := w.Len()
+  w.u64(0)
+  w.u32(uint32(len(compressedInfo)))
+  w.u32(uint32(info.Len()))
+  w.u32(flags | uint32(infoCompression))
+  w.align(16)
+  if flags&FLAG_BLOCKS_INFO_AT_END == 0 {
+    w.Write(compressedInfo)
+  }
+  if flags&FLAG_BLOCKS_INFO_PADDED != 0 {
+    w.align(16)
+  }
+  w.Write(compressedBlocks)
+  if flags&FLAG_BLOCKS_INFO_AT_END != 0 {
+    w.Write(compressedInfo)
+  }
+  data := w.Bytes()
+  binary.BigEndian.PutUint64(data[sizeAt:], uint64(len(data)))
+  return data
+}
+
+// encodeTestBundleNodes returns a serialized file holding a TextAsset and
+// the resource it streams from.
+func encodeTestBundleNodes() []testBundleNode {
+  file := encodeTestSerializedFile(22, false, "2022.3.21f1",
+    []testType{{49, testTextAssetTree()}},
+    []testObject{{1, 0, encodeTestTextAsset(binary.LittleEndian, "asset", "body")}},
+  )
+  return []testBundleNode{
+    {"CAB-test", NODE_FLAG_SERIALIZED_FILE, file},
+    {"CAB-test.resS", 0, bytes.Repeat([]byte("resource data "), 64)},
+  }
+}
+
+func TestParseBundle(t *testing.T) {
+  nodes := encodeTestBundleNodes()
+  for _, c := range []struct {
+    compression     int
+    infoCompression int
+    flags           uint32
+  }{
+    {COMPRESSION_NONE, COMPRESSION_NONE, 0},
+    {COMPRESSION_LZ4, COMPRESSION_LZ4, FLAG_DIRECTORY_INFO},
+    {COMPRESSION_LZ4, COMPRESSION_LZ4, FLAG_DIRECTORY_INFO | FLAG_BLOCKS_INFO_PADDED},
+    {COMPRESSION_LZ4, COMPRESSION_LZMA, FLAG_DIRECTORY_INFO | FLAG_BLOCKS_INFO_AT_END},
+    {COMPRESSION_LZMA, COMPRESSION_NONE, FLAG_BLOCKS_INFO_AT_END | FLAG_BLOCKS_INFO_PADDED},
+    {COMPRESSION_LZMA, COMPRESSION_LZ4, 0},
+  } {
+    data := encodeTestBundle(c.compression, c.infoCompression, c.flags, nodes...)
+    b, err := ParseBundle(data)
+    if err != nil {
+      t.Fatalf("%+v: %v", c, err)
+    }
+    if b.FormatVersion != 7 || b.UnityRevision != "2022.3.21f1" || b.Size != int64(len(data)) ||
+      b.Compression() != c.compression || len(b.Blocks) != 2 || len(b.Nodes) != 2 {
+      t.Fatalf("%+v: parsed %+v", c, b)
+    }
+    for i, node := range b.Nodes {
+      if node.Path != nodes[i].path || !bytes.Equal(b.File(node), nodes[i].data) {
+        t.Errorf("%+v: node %d is %q of %d bytes", c, i, node.Path, node.Size)
+      }
+    }
+    if resource, ok := b.Resource("archive:/CAB-test/CAB-test.resS"); !ok || !bytes.Equal(resource, nodes[1].data) {
+      t.Errorf("%+v: resource of %d bytes was not found", c, len(resource))
+    }
+    files, err := b.SerializedFiles()
+    if err != nil {
+      t.Fatalf("%+v: %v", c, err)
+    }
+    if len(files) != 1 || files[0].Path != "CAB-test" || files[0].Name(files[0].Objects[0]) != "asset" {
+      t.Errorf("%+v: serialized files are %+v", c, files)
+    }
+  }
+}
+
+func TestParseBundleCorrupted(t *testing.T) {
+  data := encodeTestBundle(COMPRESSION_NONE, COMPRESSION_NONE, 0, encodeTestBundleNodes()...)
+  patched := func(offset int, value []byte) []byte {
+    corrupted := bytes.Clone(data)
+    copy(corrupted[offset:], value)
+    return corrupted
+  }
+  // the sizes of the block info follow the signature, the version, both
+  // Unity versions and the size of the bundle
+  sizes := 8 + 4 + 6 + 12 + 8
+  info := bytes.Index(data, testBlockHash)
+  firstBlock := info + 16 + 4
+  firstNode := firstBlock + 2*10 + 4
+  for name, corrupted := range map[string][]byte{
+    "signature":        append([]byte("UnityWeb"), data[8:]...),
+    "header":           data[:20],
+    "format version":   patched(8, []byte{0, 0, 0, 5}),
+    "info size":        patched(sizes, []byte{0x7F, 0xFF, 0xFF, 0xFF}),
+    "info compression": patched(sizes+8, []byte{0, 0, 0, 9}),
+    "block count":      patched(info+16, []byte{0x7F, 0xFF, 0xFF, 0xFF}),
+    "oversized block":  patched(firstBlock, []byte{0x7F, 0xFF, 0xFF, 0xFF}),
+    "stored block":     patched(firstBlock+4, []byte{0, 0, 0, 1}),
+    "negative node":    patched(firstNode, []byte{0x80, 0, 0, 0, 0, 0, 0, 0}),
+    "outside node":     patched(firstNode+8, []byte{0x7F, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF}),
+    "truncated":        data[:len(data)-1],
+  } {
+    if _, err := ParseBundle(corrupted); err == nil {
+      t.Errorf("corrupted %s was parsed", name)
+    }
+  }
+
+  // an LZ4 block that expands beyond what LZ4 can is rejected before
+  // anything is allocated
+  lz4Data := encodeTestBundle(COMPRESSION_LZ4, COMPRESSION_NONE, 0, encodeTestBundleNodes()...)
+  lz4Block := bytes.Index(lz4Data, testBlockHash) + 16 + 4
+  oversized := bytes.Clone(lz4Data)
+  binary.BigEndian.PutUint32(oversized[lz4Block:], binary.BigEndian.Uint32(oversized[lz4Block+4:])*LZ4_MAX_RATIO+17)
+  if _, err := ParseBundle(oversized); err == nil {
+    t.Error("oversized LZ4 block was parsed")
+  }
+
+  // no corruption of a single byte may panic, neither may reading what still
+  // parses
+  for _, data := range [][]byte{data, lz4Data} {
+    for i := range data {
+      for _, value := range []byte{0x00, 0x80, 0xFF} {
+        corrupted := bytes.Clone(data)
+        corrupted[i] = value
+        b, err := ParseBundle(corrupted)
+        if err != nil {
+          continue
+        }
+        files, _ := b.SerializedFiles()
+        for _, f := range files {
+          for _, object := range f.Objects {
+            f.Read(object)
+          }
+        }
+      }
+    }
+  }
+}
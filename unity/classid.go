@@ -0,0 +1,74 @@
+package unity
+
+import "fmt"
+
+// Class IDs the package looks for.
+const (
+  CLASS_GAME_OBJECT    = 1
+  CLASS_TEXTURE_2D     = 28
+  CLASS_MONO_BEHAVIOUR = 114
+  CLASS_ASSET_BUNDLE   = 142
+  CLASS_SPRITE         = 213
+)
+
+// classNames names the class IDs found in the bundles of the game, the type
+// tree gives the name of the others when there is one.
+var classNames = map[int32]string{
+  1:          "GameObject",
+  4:          "Transform",
+  21:         "Material",
+  23:         "MeshRenderer",
+  28:         "Texture2D",
+  33:         "MeshFilter",
+  43:         "Mesh",
+  48:         "Shader",
+  49:         "TextAsset",
+  54:         "Rigidbody",
+  65:         "BoxCollider",
+  74:         "AnimationClip",
+  83:         "AudioClip",
+  89:         "Cubemap",
+  90:         "Avatar",
+  91:         "AnimatorController",
+  95:         "Animator",
+  108:        "Light",
+  111:        "Animation",
+  114:        "MonoBehaviour",
+  115:        "MonoScript",
+  117:        "Texture3D",
+  128:        "Font",
+  135:        "SphereCollider",
+  136:        "CapsuleCollider",
+  137:        "SkinnedMeshRenderer",
+  142:        "AssetBundle",
+  150:        "PreloadData",
+  187:        "Texture2DArray",
+  198:        "ParticleSystem",
+  199:        "ParticleSystemRenderer",
+  212:        "SpriteRenderer",
+  213:        "Sprite",
+  221:        "AnimatorOverrideController",
+  222:        "CanvasRenderer",
+  223:        "Canvas",
+  224:        "RectTransform",
+  225:        "CanvasGroup",
+  320:        "PlayableDirector",
+  329:        "VideoClip",
+  1953259897: "TerrainLayer",
+  687078895:  "SpriteAtlas",
+}
+
+// namedClasses are the classes whose data starts with m_Name.
+var namedClasses = map[int32]bool{
+  21: true, 28: true, 43: true, 48: true, 49: true, 74: true, 83: true,
+  89: true, 90: true, 91: true, 115: true, 117: true, 128: true, 142: true,
+  187: true, 213: true, 221: true, 329: true, 687078895: true,
+}
+
+// ClassName names classID, like "Texture2D".
+func ClassName(classID int32) string {
+  if name, ok := classNames[classID]; ok {
+    return name
+  }
+  return fmt.Sprintf("Class%d", classID)
+}
@@ -0,0 +1,224 @@
+package unity
+
+import "encoding/binary"
+
+var etc1Modifiers = [8][4]int{
+  {2, 8, -2, -8},
+  {5, 17, -5, -17},
+  {9, 29, -9, -29},
+  {13, 42, -13, -42},
+  {18, 60, -18, -60},
+  {24, 80, -24, -80},
+  {33, 106, -33, -106},
+  {47, 183, -47, -183},
+}
+
+var etc2Distances = [8]int{3, 6, 11, 16, 23, 32, 41, 64}
+
+var eacModifiers = [16][8]int{
+  {-3, -6, -9, -15, 2, 5, 8, 14},
+  {-3, -7, -10, -13, 2, 6, 9, 12},
+  {-2, -5, -8, -13, 1, 4, 7, 12},
+  {-2, -4, -6, -13, 1, 3, 5, 12},
+  {-3, -6, -8, -12, 2, 5, 7, 11},
+  {-3, -7, -9, -11, 2, 6, 8, 10},
+  {-4, -7, -8, -11, 3, 6, 7, 10},
+  {-3, -5, -8, -11, 2, 4, 7, 10},
+  {-2, -6, -8, -10, 1, 5, 7, 9},
+  {-2, -5, -8, -10, 1, 4, 7, 9},
+  {-2, -4, -8, -10, 1, 3, 7, 9},
+  {-2, -5, -7, -10, 1, 4, 6, 9},
+  {-3, -4, -7, -10, 2, 3, 6, 9},
+  {-1, -2, -3, -10, 0, 1, 2, 9},
+  {-4, -6, -8, -9, 3, 5, 7, 8},
+  {-3, -5, -7, -9, 2, 4, 6, 8},
+}
+
+func decodeETC1Block(block []byte, out []byte) {
+  decodeETCBlock(block, out, false, false)
+}
+
+func decodeETC2RGBBlock(block []byte, out []byte) {
+  decodeETCBlock(block, out, true, false)
+}
+
+func decodeETC2RGBA1Block(block []byte, out []byte) {
+  decodeETCBlock(block, out, true, true)
+}
+
+// decodeETC2RGBA8Block decodes an EAC alpha block followed by an ETC2 color
+// block.
+func decodeETC2RGBA8Block(block []byte, out []byte) {
+  decodeETCBlock(block[8:], out, true, false)
+  base := int(block[0])
+  multiplier := int(block[1] >> 4)
+  modifiers := eacModifiers[block[1]&0xF]
+  indices := binary.BigEndian.Uint64(block) & 0xFFFFFFFFFFFF
+  for i := 0; i < 16; i++ {
+    // pixels are listed column by column
+    x, y := i/4, i%4
+    out[(y*4+x)*4+3] = clamp255(base + modifiers[indices>>(45-3*i)&7]*multiplier)
+  }
+}
+
+// decodeETCBlock decodes an ETC1 block, or an ETC2 one when etc2 is set whose
+// invalid differential colors select the T, H and planar modes. With
+// punchThrough the differential bit tells instead whether the block is
+// opaque.
+func decodeETCBlock(block []byte, out []byte, etc2 bool, punchThrough bool) {
+  b := block
+  diff := b[3]&2 != 0
+  opaque := true
+  if punchThrough {
+    opaque = diff
+    diff = true
+  }
+  indices := binary.BigEndian.Uint32(b[4:])
+  pixelIndex := func(i int) int {
+    return int(indices>>(16+i)&1)<<1 | int(indices>>i&1)
+  }
+  setPixel := func(i int, r int, g int, bl int, a uint8) {
+    x, y := i/4, i%4
+    p := out[(y*4+x)*4:]
+    p[0], p[1], p[2], p[3] = clamp255(r), clamp255(g), clamp255(bl), a
+  }
+
+  if etc2 && diff {
+    r := int(b[0]>>3) + signExtend3(int(b[0]))
+    g := int(b[1]>>3) + signExtend3(int(b[1]))
+    bl := int(b[2]>>3) + signExtend3(int(b[2]))
+    switch {
+    case r < 0 || r > 31:
+      decodeETC2TBlock(b, setPixel, pixelIndex, opaque)
+      return
+    case g < 0 || g > 31:
+      decodeETC2HBlock(b, setPixel, pixelIndex, opaque)
+      return
+    case bl < 0 || bl > 31:
+      decodeETC2PlanarBlock(b, setPixel)
+      return
+    }
+  }
+
+  var base [2][3]int
+  if diff {
+    for ch := 0; ch < 3; ch++ {
+      c := int(b[ch] >> 3)
+      base[0][ch] = int(expand5(c))
+      base[1][ch] = int(expand5(c + signExtend3(int(b[ch]))))
+    }
+  } else {
+    for ch := 0; ch < 3; ch++ {
+      base[0][ch] = int(expand4(int(b[ch] >> 4)))
+      base[1][ch] = int(expand4(int(b[ch])))
+    }
+  }
+  tables := [2]int{int(b[3] >> 5), int(b[3] >> 2 & 7)}
+  flip := b[3]&1 != 0
+  for i := 0; i < 16; i++ {
+    x, y := i/4, i%4
+    sub := 0
+    if (!flip && x >= 2) || (flip && y >= 2) {
+      sub = 1
+    }
+    index := pixelIndex(i)
+    modifier := etc1Modifiers[tables[sub]][index]
+    if !opaque {
+      if index == 2 {
+        setPixel(i, 0, 0, 0, 0)
+        continue
+      }
+      if index == 0 {
+        modifier = 0
+      }
+    }
+    c := base[sub]
+    setPixel(i, c[0]+modifier, c[1]+modifier, c[2]+modifier, 0xFF)
+  }
+}
+
+func signExtend3(v int) int {
+  v &= 7
+  if v >= 4 {
+    v -= 8
+  }
+  return v
+}
+
+func decodeETC2TBlock(b []byte, setPixel func(int, int, int, int, uint8), pixelIndex func(int) int, opaque bool) {
+  c1 := [3]int{
+    int(expand4(int(b[0]>>3&3)<<2 | int(b[0]&3))),
+    int(expand4(int(b[1] >> 4))),
+    int(expand4(int(b[1]))),
+  }
+  c2 := [3]int{int(expand4(int(b[2] >> 4))), int(expand4(int(b[2]))), int(expand4(int(b[3] >> 4)))}
+  d := etc2Distances[int(b[3]>>1&6)|int(b[3]&1)]
+  paints := [4][3]int{
+    c1,
+    {c2[0] + d, c2[1] + d, c2[2] + d},
+    c2,
+    {c2[0] - d, c2[1] - d, c2[2] - d},
+  }
+  for i := 0; i < 16; i++ {
+    index := pixelIndex(i)
+    if !opaque && index == 2 {
+      setPixel(i, 0, 0, 0, 0)
+      continue
+    }
+    p := paints[index]
+    setPixel(i, p[0], p[1], p[2], 0xFF)
+  }
+}
+
+func decodeETC2HBlock(b []byte, setPixel func(int, int, int, int, uint8), pixelIndex func(int) int, opaque bool) {
+  r1 := int(b[0] >> 3 & 0xF)
+  g1 := int(b[0]&7)<<1 | int(b[1]>>4&1)
+  b1 := int(b[1]&8) | int(b[1]&3)<<1 | int(b[2]>>7)
+  r2 := int(b[2] >> 3 & 0xF)
+  g2 := int(b[2]&7)<<1 | int(b[3]>>7)
+  b2 := int(b[3] >> 3 & 0xF)
+  dIndex := int(b[3]&4) | int(b[3]&1)<<1
+  if r1<<8|g1<<4|b1 >= r2<<8|g2<<4|b2 {
+    dIndex |= 1
+  }
+  d := etc2Distances[dIndex]
+  c1 := [3]int{int(expand4(r1)), int(expand4(g1)), int(expand4(b1))}
+  c2 := [3]int{int(expand4(r2)), int(expand4(g2)), int(expand4(b2))}
+  paints := [4][3]int{
+    {c1[0] + d, c1[1] + d, c1[2] + d},
+    {c1[0] - d, c1[1] - d, c1[2] - d},
+    {c2[0] + d, c2[1] + d, c2[2] + d},
+    {c2[0] - d, c2[1] - d, c2[2] - d},
+  }
+  for i := 0; i < 16; i++ {
+    index := pixelIndex(i)
+    if !opaque && index == 2 {
+      setPixel(i, 0, 0, 0, 0)
+      continue
+    }
+    p := paints[index]
+    setPixel(i, p[0], p[1], p[2], 0xFF)
+  }
+}
+
+func decodeETC2PlanarBlock(b []byte, setPixel func(int, int, int, int, uint8)) {
+  ro := int(expand6(int(b[0] >> 1)))
+  gOrigin := int(b[0]&1)<<6 | int(b[1]>>1&0x3F)
+  bo := int(expand6(int(b[1]&1)<<5 | int(b[2]&0x18) | int(b[2]&3)<<1 | int(b[3]>>7)))
+  rh := int(expand6(int(b[3]>>2&0x1F)<<1 | int(b[3]&1)))
+  gh := int(b[4] >> 1)
+  bh := int(expand6(int(b[4]&1)<<5 | int(b[5]>>3)))
+  rv := int(expand6(int(b[5]&7)<<3 | int(b[6]>>5)))
+  gv := int(b[6]&0x1F)<<2 | int(b[7]>>6)
+  bv := int(expand6(int(b[7] & 0x3F)))
+  expand7 := func(v int) int { return v<<1 | v>>6 }
+  gOrigin, gh, gv = expand7(gOrigin), expand7(gh), expand7(gv)
+  for i := 0; i < 16; i++ {
+    x, y := i/4, i%4
+    setPixel(i,
+      (x*(rh-ro)+y*(rv-ro)+4*ro+2)>>2,
+      (x*(gh-gOrigin)+y*(gv-gOrigin)+4*gOrigin+2)>>2,
+      (x*(bh-bo)+y*(bv-bo)+4*bo+2)>>2,
+      0xFF)
+  }
+}
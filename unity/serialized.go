@@ -0,0 +1,270 @@
+package unity
+
+import (
+  "encoding/binary"
+  "encoding/hex"
+  "fmt"
+)
+
+// SerializedFile is the object table of a serialized file, the kind named
+// CAB-xxx inside bundles.
+type SerializedFile struct {
+  Path         string
+  Version      uint32
+  UnityVersion string
+  Platform     int32
+  BigEndian    bool
+  TypeTree     bool
+  Types        []SerializedType
+  Objects      []ObjectInfo
+  Externals    []External
+  data         []byte
+  order        binary.ByteOrder
+}
+
+type SerializedType struct {
+  ClassID     int32
+  Stripped    bool
+  ScriptIndex int16
+  Tree        *TypeTreeNode
+}
+
+// ObjectInfo locates an object in the data of its file.
+type ObjectInfo struct {
+  PathID    int64
+  ByteStart int64
+  ByteSize  uint32
+  TypeID    int32
+  ClassID   int32
+}
+
+// External is another serialized file the objects refer to, by the file ID
+// one more than its index.
+type External struct {
+  GUID     string
+  Type     int32
+  PathName string
+}
+
+// ParseSerializedFile reads the header and the metadata of data, the objects
+// themselves are decoded on demand.
+func ParseSerializedFile(data []byte) (*SerializedFile, error) {
+  r := newReader(data, binary.BigEndian)
+  r.u32() // metadata size
+  fileSize := int64(r.u32())
+  f := &SerializedFile{Version: r.u32(), data: data}
+  dataOffset := int64(r.u32())
+  if f.Version < 13 {
+    return nil, fmt.Errorf("serialized file version %d is not supported", f.Version)
+  }
+  f.BigEndian = r.u8() != 0
+  r.skip(3)
+  if f.Version >= 22 {
+    r.u32() // metadata size
+    fileSize = r.i64()
+    dataOffset = r.i64()
+    r.i64()
+  }
+  if r.err != nil {
+    return nil, fmt.Errorf("serialized file header: %w", r.err)
+  }
+  if f.Version > 50 || fileSize != int64(len(data)) || dataOffset < 0 || dataOffset > fileSize {
+    return nil, fmt.Errorf("not a serialized file")
+  }
+  f.order = binary.LittleEndian
+  if f.BigEndian {
+    f.order = binary.BigEndian
+  }
+  r.order = f.order
+
+  f.UnityVersion = r.cstring()
+  f.Platform = r.i32()
+  f.TypeTree = r.bool()
+  f.Types = make([]SerializedType, r.count(4))
+  for i := range f.Types {
+    f.Types[i] = f.readType(r)
+  }
+  bigID := false
+  if f.Version < 14 {
+    bigID = r.i32() != 0
+  }
+
+  f.Objects = make([]ObjectInfo, r.count(12))
+  for i := range f.Objects {
+    object := &f.Objects[i]
+    switch {
+    case bigID:
+      object.PathID = r.i64()
+    case f.Version < 14:
+      object.PathID = int64(r.i32())
+    default:
+      r.align(4)
+      object.PathID = r.i64()
+    }
+    if f.Version >= 22 {
+      object.ByteStart = r.i64()
+    } else {
+      object.ByteStart = int64(r.u32())
+    }
+    object.ByteStart += dataOffset
+    object.ByteSize = r.u32()
+    object.TypeID = r.i32()
+    if f.Version < 16 {
+      object.ClassID = int32(r.u16())
+    } else if object.TypeID >= 0 && int(object.TypeID) < len(f.Types) {
+      object.ClassID = f.Types[object.TypeID].ClassID
+    } else if r.err == nil {
+      return nil, fmt.Errorf("object %d has type %d of %d", object.PathID, object.TypeID, len(f.Types))
+    }
+    if f.Version < 17 {
+      r.i16() // script type index
+    }
+    if f.Version == 15 || f.Version == 16 {
+      r.u8() // stripped
+    }
+    if r.err == nil && (object.ByteStart < 0 || object.ByteStart > int64(len(data))-int64(object.ByteSize)) {
+      return nil, fmt.Errorf("object %d lies outside of the file", object.PathID)
+    }
+  }
+
+  scripts := r.count(8)
+  for range scripts {
+    r.i32() // file index
+    if f.Version < 14 {
+      r.i32()
+    } else {
+      r.align(4)
+      r.i64()
+    }
+  }
+
+  f.Externals = make([]External, r.count(21))
+  for i := range f.Externals {
+    r.cstring()
+    guid := r.bytes(16)
+    f.Externals[i] = External{
+      GUID:     hex.EncodeToString(guid),
+      Type:     r.i32(),
+      PathName: r.cstring(),
+    }
+  }
+  if r.err != nil {
+    return nil, fmt.Errorf("serialized file metadata: %w", r.err)
+  }
+  return f, nil
+}
+
+// readType reads an entry of the type table.
+func (f *SerializedFile) readType(r *reader) SerializedType {
+  t := SerializedType{ClassID: r.i32(), ScriptIndex: -1}
+  if f.Version >= 16 {
+    t.Stripped = r.bool()
+  }
+  if f.Version >= 17 {
+    t.ScriptIndex = r.i16()
+  }
+  if (f.Version < 16 && t.ClassID < 0) || (f.Version >= 16 && t.ClassID == CLASS_MONO_BEHAVIOUR) {
+    r.skip(16) // script ID
+  }
+  r.skip(16) // hash of the type
+  if f.TypeTree {
+    t.Tree = readTypeTreeBlob(r, f.Version)
+    if f.Version >= 21 {
+      r.skip(r.count(4) * 4) // type dependencies
+    }
+  }
+  return t
+}
+
+// Type names the class of object, from its type tree when there is one.
+func (f *SerializedFile) Type(object ObjectInfo) string {
+  if f.Version >= 16 && object.TypeID >= 0 && int(object.TypeID) < len(f.Types) {
+    if tree := f.Types[object.TypeID].Tree; tree != nil && tree.Type != "" {
+      return tree.Type
+    }
+  }
+  return ClassName(object.ClassID)
+}
+
+// Data returns the serialized bytes of object.
+func (f *SerializedFile) Data(object ObjectInfo) []byte {
+  return f.data[object.ByteStart : object.ByteStart+int64(object.ByteSize)]
+}
+
+// objectReader reads the data of object in the byte order of the file,
+// aligned relative to the start of the object.
+func (f *SerializedFile) objectReader(object ObjectInfo) *reader {
+  return newReader(f.Data(object), f.order)
+}
+
+// Tree returns the type tree of object, or nil when the file was built
+// without them.
+func (f *SerializedFile) Tree(object ObjectInfo) *TypeTreeNode {
+  if f.Version >= 16 && object.TypeID >= 0 && int(object.TypeID) < len(f.Types) {
+    return f.Types[object.TypeID].Tree
+  }
+  for _, t := range f.Types {
+    if t.ClassID == object.ClassID {
+      return t.Tree
+    }
+  }
+  return nil
+}
+
+// Read decodes every field of object with its type tree.
+func (f *SerializedFile) Read(object ObjectInfo) (map[string]any, error) {
+  tree := f.Tree(object)
+  if tree == nil {
+    return nil, fmt.Errorf("object %d of %s has no type tree", object.PathID, f.Type(object))
+  }
+  r := f.objectReader(object)
+  fields, _ := tree.read(r).(map[string]any)
+  if r.err != nil {
+    return nil, fmt.Errorf("object %d of %s: %w", object.PathID, f.Type(object), r.err)
+  }
+  return fields, nil
+}
+
+// Name returns the m_Name of object, or "" when it has none or it cannot be
+// told without a type tree.
+func (f *SerializedFile) Name(object ObjectInfo) string {
+  r := f.objectReader(object)
+  if tree := f.Tree(object); tree != nil {
+    if tree.Child("m_Name") == nil {
+      return ""
+    }
+    if name, ok := tree.readUntil(r, "m_Name"); ok {
+      s, _ := name.(string)
+      return s
+    }
+    return ""
+  }
+
+  switch {
+  case namedClasses[object.ClassID]:
+  case object.ClassID == CLASS_GAME_OBJECT:
+    r.skip(r.count(12) * 12) // components
+    r.u32()                  // layer
+  case object.ClassID == CLASS_MONO_BEHAVIOUR:
+    r.skip(12) // game object
+    r.u8()     // enabled
+    r.align(4)
+    r.skip(12) // script
+  default:
+    return ""
+  }
+  name := r.alignedString()
+  if r.err != nil {
+    return ""
+  }
+  return name
+}
+
+// ExternalPath returns the path of the file fileID refers to, "" for the file
+// itself.
+func (f *SerializedFile) ExternalPath(fileID int32) string {
+  if fileID <= 0 || int(fileID) > len(f.Externals) {
+    return ""
+  }
+  return f.Externals[fileID-1].PathName
+}
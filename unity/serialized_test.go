@@ -0,0 +1,404 @@
+package unity
+
+import (
+  "bytes"
+  "encoding/binary"
+  "math"
+  "slices"
+  "testing"
+)
+
+// testWriter writes the fields read by reader, aligned relative to its start.
+type testWriter struct {
+  bytes.Buffer
+  order binary.ByteOrder
+}
+
+func newTestWriter(order binary.ByteOrder) *testWriter {
+  return &testWriter{order: order}
+}
+
+func (w *testWriter) u8(v uint8) {
+  w.WriteByte(v)
+}
+
+func (w *testWriter) u16(v uint16) {
+  binary.Write(w, w.order, v)
+}
+
+func (w *testWriter) u32(v uint32) {
+  binary.Write(w, w.order, v)
+}
+
+func (w *testWriter) u64(v uint64) {
+  binary.Write(w, w.order, v)
+}
+
+func (w *testWriter) cstring(s string) {
+  w.WriteString(s)
+  w.WriteByte(0)
+}
+
+func (w *testWriter) align(n int) {
+  for w.Len()%n != 0 {
+    w.WriteByte(0)
+  }
+}
+
+func (w *testWriter) alignedString(s string) {
+  w.u32(uint32(len(s)))
+  w.WriteString(s)
+  w.align(4)
+}
+
+// testTypeNode is a node of a type tree written by encodeTypeTree.
+type testTypeNode struct {
+  typ      string
+  name     string
+  size     int32
+  align    bool
+  children []*testTypeNode
+}
+
+func testField(typ string, name string, size int32, children ...*testTypeNode) *testTypeNode {
+  return &testTypeNode{typ: typ, name: name, size: size, children: children}
+}
+
+// testString is a string field, padded like Unity does.
+func testString(name string) *testTypeNode {
+  array := testField("Array", "Array", -1, testField("int", "size", 4), testField("char", "data", 1))
+  array.align = true
+  return testField("string", name, -1, array)
+}
+
+// testVector is a vector field of elem, padded after its elements.
+func testVector(name string, elem *testTypeNode) *testTypeNode {
+  array := testField("Array", "Array", -1, testField("int", "size", 4), elem)
+  array.align = true
+  return testField("vector", name, -1, array)
+}
+
+// encodeTypeTree writes the tree rooted at root as a node table followed by
+// its string buffer, with the common strings referenced by their offset.
+func encodeTypeTree(w *testWriter, root *testTypeNode, version uint32) {
+  common := map[string]uint32{}
+  for offset, s := range commonStringOffsets {
+    common[s] = offset
+  }
+  local := &bytes.Buffer{}
+  offsetOf := func(s string) uint32 {
+    if offset, ok := common[s]; ok {
+      return offset | 0x80000000
+    }
+    offset := uint32(local.Len())
+    local.WriteString(s)
+    local.WriteByte(0)
+    return offset
+  }
+  type flatNode struct {
+    node  *testTypeNode
+    level uint8
+  }
+  nodes := []flatNode{}
+  var walk func(node *testTypeNode, level uint8)
+  walk = func(node *testTypeNode, level uint8) {
+    nodes = append(nodes, flatNode{node, level})
+    for _, child := range node.children {
+      walk(child, level+1)
+    }
+  }
+  walk(root, 0)
+
+  table := newTestWriter(w.order)
+  for i, flat := range nodes {
+    table.u16(1)
+    table.u8(flat.level)
+    table.u8(0)
+    table.u32(offsetOf(flat.node.typ))
+    table.u32(offsetOf(flat.node.name))
+    table.u32(uint32(flat.node.size))
+    table.u32(uint32(i))
+    var flags uint32
+    if flat.node.align {
+      flags = META_FLAG_ALIGN
+    }
+    table.u32(flags)
+    if version >= 19 {
+      table.u64(0)
+    }
+  }
+  w.u32(uint32(len(nodes)))
+  w.u32(uint32(local.Len()))
+  w.Write(table.Bytes())
+  w.Write(local.Bytes())
+}
+
+type testType struct {
+  classID int32
+  tree    *testTypeNode
+}
+
+type testObject struct {
+  pathID int64
+  typeID int32
+  data   []byte
+}
+
+// encodeTestSerializedFile writes a serialized file of version 17 or later
+// holding objects, with type trees when the types have them.
+func encodeTestSerializedFile(version uint32, bigEndian bool, unityVersion string, types []testType, objects []testObject) []byte {
+  headerSize := 20
+  if version >= 22 {
+    headerSize = 48
+  }
+  var order binary.ByteOrder = binary.LittleEndian
+  if bigEndian {
+    order = binary.BigEndian
+  }
+  meta := newTestWriter(order)
+  // the metadata is aligned relative to the start of the file
+  meta.Write(make([]byte, headerSize))
+  meta.cstring(unityVersion)
+  meta.u32(13) // platform
+  typeTree := len(types) > 0 && types[0].tree != nil
+  if typeTree {
+    meta.u8(1)
+  } else {
+    meta.u8(0)
+  }
+  meta.u32(uint32(len(types)))
+  for _, t := range types {
+    meta.u32(uint32(t.classID))
+    meta.u8(0)       // stripped
+    meta.u16(0xFFFF) // script index
+    if t.classID == CLASS_MONO_BEHAVIOUR {
+      meta.Write(make([]byte, 16))
+    }
+    meta.Write(bytes.Repeat([]byte{0xAB}, 16))
+    if typeTree {
+      encodeTypeTree(meta, t.tree, version)
+      if version >= 21 {
+        meta.u32(0)
+      }
+    }
+  }
+
+  data := newTestWriter(order)
+  meta.u32(uint32(len(objects)))
+  for _, object := range objects {
+    data.align(8)
+    meta.align(4)
+    meta.u64(uint64(object.pathID))
+    if version >= 22 {
+      meta.u64(uint64(data.Len()))
+    } else {
+      meta.u32(uint32(data.Len()))
+    }
+    meta.u32(uint32(len(object.data)))
+    meta.u32(uint32(object.typeID))
+    data.Write(object.data)
+  }
+  meta.u32(0) // scripts
+  meta.u32(1) // externals
+  meta.cstring("")
+  meta.Write(bytes.Repeat([]byte{0x11}, 16))
+  meta.u32(0)
+  meta.cstring("archive:/CAB-other/CAB-other")
+  meta.align(16)
+
+  dataOffset := meta.Len()
+  fileSize := dataOffset + data.Len()
+  file := append(meta.Bytes(), data.Bytes()...)
+  header := newTestWriter(binary.BigEndian)
+  header.u32(uint32(dataOffset - headerSize))
+  if version >= 22 {
+    header.u32(0)
+    header.u32(version)
+    header.u32(0)
+  } else {
+    header.u32(uint32(fileSize))
+    header.u32(version)
+    header.u32(uint32(dataOffset))
+  }
+  if bigEndian {
+    header.u8(1)
+  } else {
+    header.u8(0)
+  }
+  header.Write([]byte{0, 0, 0})
+  if version >= 22 {
+    header.u32(uint32(dataOffset - headerSize))
+    header.u64(uint64(fileSize))
+    header.u64(uint64(dataOffset))
+    header.u64(0)
+  }
+  copy(file, header.Bytes())
+  return file
+}
+
+// testTextAssetTree is a TextAsset with a field of every kind.
+func testTextAssetTree() *testTypeNode {
+  pptr := testField("PPtr<Object>", "m_Ref", 12, testField("int", "m_FileID", 4), testField("SInt64", "m_PathID", 8))
+  flag := testField("bool", "m_Flag", 1)
+  flag.align = true
+  return testField("TextAsset", "Base", -1,
+    testString("m_Name"),
+    testField("int", "m_Value", 4),
+    flag,
+    testVector("m_Bytes", testField("UInt8", "data", 1)),
+    testVector("m_Floats", testField("float", "data", 4)),
+    pptr,
+    testString("m_Script"),
+  )
+}
+
+func encodeTestTextAsset(order binary.ByteOrder, name string, script string) []byte {
+  w := newTestWriter(order)
+  w.alignedString(name)
+  w.u32(uint32(0xFFFFFFF9)) // -7
+  w.u8(1)
+  w.align(4)
+  w.u32(3)
+  w.Write([]byte{1, 2, 3})
+  w.align(4)
+  w.u32(2)
+  w.u32(math.Float32bits(0.5))
+  w.u32(math.Float32bits(2))
+  w.u32(1)
+  w.u64(42)
+  w.alignedString(script)
+  return w.Bytes()
+}
+
+func TestParseSerializedFile(t *testing.T) {
+  for _, c := range []struct {
+    version   uint32
+    bigEndian bool
+  }{
+    {17, false},
+    {17, true},
+    {19, false},
+    {21, false},
+    {22, false},
+    {22, true},
+  } {
+    var order binary.ByteOrder = binary.LittleEndian
+    if c.bigEndian {
+      order = binary.BigEndian
+    }
+    data := encodeTestSerializedFile(c.version, c.bigEndian, "2022.3.21f1",
+      []testType{{49, testTextAssetTree()}},
+      []testObject{
+        {1, 0, encodeTestTextAsset(order, "first", "body")},
+        {-5, 0, encodeTestTextAsset(order, "second", "another body")},
+      },
+    )
+    f, err := ParseSerializedFile(data)
+    if err != nil {
+      t.Fatalf("version %d: %v", c.version, err)
+    }
+    if f.Version != c.version || f.BigEndian != c.bigEndian || f.UnityVersion != "2022.3.21f1" || !f.TypeTree {
+      t.Fatalf("version %d: parsed %+v", c.version, f)
+    }
+    if len(f.Objects) != 2 || f.Objects[1].PathID != -5 || f.Objects[1].ClassID != 49 {
+      t.Fatalf("version %d: objects are %+v", c.version, f.Objects)
+    }
+    if f.ExternalPath(1) != "archive:/CAB-other/CAB-other" || f.ExternalPath(0) != "" || f.ExternalPath(2) != "" {
+      t.Errorf("version %d: externals are %+v", c.version, f.Externals)
+    }
+    object := f.Objects[1]
+    if f.Type(object) != "TextAsset" || f.Name(object) != "second" {
+      t.Errorf("version %d: object is a %s named %q", c.version, f.Type(object), f.Name(object))
+    }
+    fields, err := f.Read(object)
+    if err != nil {
+      t.Fatalf("version %d: %v", c.version, err)
+    }
+    ref, _ := fields["m_Ref"].(map[string]any)
+    if fields["m_Name"] != "second" || fields["m_Value"] != int32(-7) || fields["m_Flag"] != true ||
+      !bytes.Equal(fields["m_Bytes"].([]byte), []byte{1, 2, 3}) ||
+      !slices.Equal(fields["m_Floats"].([]any), []any{float32(0.5), float32(2)}) ||
+      ref["m_FileID"] != int32(1) || ref["m_PathID"] != int64(42) ||
+      fields["m_Script"] != "another body" {
+      t.Errorf("version %d: fields are %+v", c.version, fields)
+    }
+  }
+}
+
+func TestParseSerializedFileWithoutTypeTree(t *testing.T) {
+  data := encodeTestSerializedFile(21, false, "2021.3.16f1",
+    []testType{{49, nil}, {CLASS_GAME_OBJECT, nil}},
+    []testObject{
+      {1, 0, encodeTestTextAsset(binary.LittleEndian, "named", "body")},
+      {2, 1, []byte{0, 0, 0, 0, 0, 0, 0, 0, 3, 0, 0, 0, 'g', 'o', 0, 0}},
+    },
+  )
+  f, err := ParseSerializedFile(data)
+  if err != nil {
+    t.Fatal(err)
+  }
+  if f.TypeTree || f.Tree(f.Objects[0]) != nil {
+    t.Fatal("file has type trees")
+  }
+  if name := f.Name(f.Objects[0]); name != "named" {
+    t.Errorf("TextAsset is named %q", name)
+  }
+  if f.Type(f.Objects[1]) != "GameObject" {
+    t.Errorf("object 2 is a %s", f.Type(f.Objects[1]))
+  }
+  if _, err := f.Read(f.Objects[0]); err == nil {
+    t.Error("object without type tree was read")
+  }
+}
+
+func TestParseSerializedFileCorrupted(t *testing.T) {
+  for _, version := range []uint32{17, 22} {
+    data := encodeTestSerializedFile(version, false, "2022.3.21f1",
+      []testType{{49, testTextAssetTree()}},
+      []testObject{{0x0102030405060708, 0, encodeTestTextAsset(binary.LittleEndian, "first", "body")}},
+    )
+    patched := func(offset int, value []byte) []byte {
+      corrupted := bytes.Clone(data)
+      copy(corrupted[offset:], value)
+      return corrupted
+    }
+    object := bytes.Index(data, binary.LittleEndian.AppendUint64(nil, 0x0102030405060708))
+    cases := map[string][]byte{
+      "truncated": data[:len(data)-1],
+      "header":    data[:12],
+      "version":   patched(8, []byte{0, 0, 0, 9}),
+      "future":    patched(8, []byte{0, 0, 0, 99}),
+      "type":      patched(object+16+4*int(version/22), []byte{5, 0, 0, 0}),
+    }
+    if version >= 22 {
+      cases["negative data offset"] = patched(32, binary.BigEndian.AppendUint64(nil, math.MaxUint64-4))
+      cases["negative object"] = patched(object+8, binary.LittleEndian.AppendUint64(nil, 1<<63))
+      cases["overflowing object"] = patched(object+8, binary.LittleEndian.AppendUint64(nil, math.MaxInt64-2))
+    } else {
+      cases["file size"] = patched(4, []byte{0, 0, 0, 1})
+      cases["object"] = patched(object+8, []byte{0xFF, 0xFF, 0, 0})
+    }
+    for name, corrupted := range cases {
+      if _, err := ParseSerializedFile(corrupted); err == nil {
+        t.Errorf("version %d: corrupted %s was parsed", version, name)
+      }
+    }
+
+    // no corruption of a single byte may panic, neither may reading the
+    // objects of what still parses
+    for i := range data {
+      for _, value := range []byte{0x00, 0x80, 0xFF} {
+        corrupted := bytes.Clone(data)
+        corrupted[i] = value
+        f, err := ParseSerializedFile(corrupted)
+        if err != nil {
+          continue
+        }
+        for _, object := range f.Objects {
+          f.Read(object)
+          f.Name(object)
+        }
+      }
+    }
+  }
+}
@@ -0,0 +1,280 @@
+package unity
+
+import (
+  "encoding/binary"
+  "fmt"
+  "image"
+)
+
+// TextureFormat values of Texture2D.m_TextureFormat.
+const (
+  TEX_ALPHA8              = 1
+  TEX_ARGB4444            = 2
+  TEX_RGB24               = 3
+  TEX_RGBA32              = 4
+  TEX_ARGB32              = 5
+  TEX_RGB565              = 7
+  TEX_R16                 = 9
+  TEX_DXT1                = 10
+  TEX_DXT5                = 12
+  TEX_RGBA4444            = 13
+  TEX_BGRA32              = 14
+  TEX_DXT1_CRUNCHED       = 28
+  TEX_DXT5_CRUNCHED       = 29
+  TEX_ETC_RGB4            = 34
+  TEX_ETC2_RGB            = 45
+  TEX_ETC2_RGBA1          = 46
+  TEX_ETC2_RGBA8          = 47
+  TEX_ASTC_4x4            = 48
+  TEX_ASTC_5x5            = 49
+  TEX_ASTC_6x6            = 50
+  TEX_ASTC_8x8            = 51
+  TEX_ASTC_10x10          = 52
+  TEX_ASTC_12x12          = 53
+  TEX_ASTC_RGBA_4x4       = 54
+  TEX_ASTC_RGBA_5x5       = 55
+  TEX_ASTC_RGBA_6x6       = 56
+  TEX_ASTC_RGBA_8x8       = 57
+  TEX_ASTC_RGBA_10x10     = 58
+  TEX_ASTC_RGBA_12x12     = 59
+  TEX_RG16                = 62
+  TEX_R8                  = 63
+  TEX_ETC_RGB4_CRUNCHED   = 64
+  TEX_ETC2_RGBA8_CRUNCHED = 65
+)
+
+type textureFormat struct {
+  name string
+  // size of a block of blockW x blockH pixels, or of a pixel when both are 1
+  blockW, blockH, blockBytes int
+  decode func(dst *image.NRGBA, src []byte)
+}
+
+var textureFormats = map[int]textureFormat{
+  TEX_ALPHA8:     {"Alpha8", 1, 1, 1, decodeAlpha8},
+  TEX_ARGB4444:   {"ARGB4444", 1, 1, 2, decodeARGB4444},
+  TEX_RGB24:      {"RGB24", 1, 1, 3, decodeRGB24},
+  TEX_RGBA32:     {"RGBA32", 1, 1, 4, decodeRGBA32},
+  TEX_ARGB32:     {"ARGB32", 1, 1, 4, decodeARGB32},
+  TEX_RGB565:     {"RGB565", 1, 1, 2, decodeRGB565},
+  TEX_R16:        {"R16", 1, 1, 2, decodeR16},
+  TEX_DXT1:       {"DXT1", 4, 4, 8, decodeBlocks(4, 4, 8, decodeDXT1Block)},
+  TEX_DXT5:       {"DXT5", 4, 4, 16, decodeBlocks(4, 4, 16, decodeDXT5Block)},
+  TEX_RGBA4444:   {"RGBA4444", 1, 1, 2, decodeRGBA4444},
+  TEX_BGRA32:     {"BGRA32", 1, 1, 4, decodeBGRA32},
+  TEX_ETC_RGB4:   {"ETC_RGB4", 4, 4, 8, decodeBlocks(4, 4, 8, decodeETC1Block)},
+  TEX_ETC2_RGB:   {"ETC2_RGB", 4, 4, 8, decodeBlocks(4, 4, 8, decodeETC2RGBBlock)},
+  TEX_ETC2_RGBA1: {"ETC2_RGBA1", 4, 4, 8, decodeBlocks(4, 4, 8, decodeETC2RGBA1Block)},
+  TEX_ETC2_RGBA8: {"ETC2_RGBA8", 4, 4, 16, decodeBlocks(4, 4, 16, decodeETC2RGBA8Block)},
+  TEX_RG16:       {"RG16", 1, 1, 2, decodeRG16},
+  TEX_R8:         {"R8", 1, 1, 1, decodeR8},
+
+  TEX_DXT1_CRUNCHED:       {name: "DXT1Crunched"},
+  TEX_DXT5_CRUNCHED:       {name: "DXT5Crunched"},
+  TEX_ETC_RGB4_CRUNCHED:   {name: "ETC_RGB4Crunched"},
+  TEX_ETC2_RGBA8_CRUNCHED: {name: "ETC2_RGBA8Crunched"},
+}
+
+func init() {
+  for i, size := range []int{4, 5, 6, 8, 10, 12} {
+    name := fmt.Sprintf("ASTC_%dx%d", size, size)
+    decode := decodeBlocks(size, size, 16, astcBlockDecoder(size, size))
+    textureFormats[TEX_ASTC_4x4+i] = textureFormat{name, size, size, 16, decode}
+    textureFormats[TEX_ASTC_RGBA_4x4+i] = textureFormat{"ASTC_RGBA_" + name[5:], size, size, 16, decode}
+  }
+}
+
+// TextureFormatName names format, like "ASTC_6x6".
+func TextureFormatName(format int) string {
+  if f, ok := textureFormats[format]; ok {
+    return f.name
+  }
+  return fmt.Sprintf("Format%d", format)
+}
+
+// imageSize is the number of bytes of the first image of a width x height
+// texture in format f.
+func (f textureFormat) imageSize(width int, height int) int {
+  return (width + f.blockW - 1) / f.blockW * ((height + f.blockH - 1) / f.blockH) * f.blockBytes
+}
+
+// decodeImage decodes the first width x height image of src, top row first.
+func decodeImage(format int, width int, height int, src []byte) (*image.NRGBA, error) {
+  f, ok := textureFormats[format]
+  if !ok || f.decode == nil {
+    return nil, fmt.Errorf("texture format %s is not supported", TextureFormatName(format))
+  }
+  if width <= 0 || height <= 0 {
+    return nil, fmt.Errorf("texture has no pixels (%dx%d)", width, height)
+  }
+  size := f.imageSize(width, height)
+  if len(src) < size {
+    return nil, fmt.Errorf("%s image of %dx%d needs %d bytes, got %d", f.name, width, height, size, len(src))
+  }
+  img := image.NewNRGBA(image.Rect(0, 0, width, height))
+  f.decode(img, src[:size])
+  flipVertical(img)
+  return img, nil
+}
+
+// flipVertical turns Unity's bottom-up rows into top-down ones.
+func flipVertical(img *image.NRGBA) {
+  height := img.Rect.Dy()
+  for y := 0; y < height/2; y++ {
+    top := img.Pix[y*img.Stride : y*img.Stride+img.Stride]
+    bottom := img.Pix[(height-1-y)*img.Stride : (height-y)*img.Stride]
+    for i := range top {
+      top[i], bottom[i] = bottom[i], top[i]
+    }
+  }
+}
+
+// decodeBlocks adapts a decoder of one block into blockW x blockH RGBA
+// pixels to a whole image, clipping the blocks at the right and bottom edges.
+func decodeBlocks(blockW int, blockH int, blockBytes int, decodeBlock func(block []byte, out []byte)) func(*image.NRGBA, []byte) {
+  return func(dst *image.NRGBA, src []byte) {
+    width, height := dst.Rect.Dx(), dst.Rect.Dy()
+    out := make([]byte, blockW*blockH*4)
+    offset := 0
+    for by := 0; by < height; by += blockH {
+      for bx := 0; bx < width; bx += blockW {
+        decodeBlock(src[offset:offset+blockBytes], out)
+        offset += blockBytes
+        for y := 0; y < blockH && by+y < height; y++ {
+          w := min(blockW, width-bx)
+          copy(dst.Pix[(by+y)*dst.Stride+bx*4:], out[y*blockW*4:(y*blockW+w)*4])
+        }
+      }
+    }
+  }
+}
+
+func decodePixels(size int, decodePixel func(p []byte, px []byte)) func(*image.NRGBA, []byte) {
+  return func(dst *image.NRGBA, src []byte) {
+    width, height := dst.Rect.Dx(), dst.Rect.Dy()
+    for y := 0; y < height; y++ {
+      for x := 0; x < width; x++ {
+        i := y*width + x
+        decodePixel(src[i*size:i*size+size], dst.Pix[y*dst.Stride+x*4:])
+      }
+    }
+  }
+}
+
+var (
+  decodeAlpha8 = decodePixels(1, func(p []byte, px []byte) {
+    px[0], px[1], px[2], px[3] = 0xFF, 0xFF, 0xFF, p[0]
+  })
+  decodeR8 = decodePixels(1, func(p []byte, px []byte) {
+    px[0], px[1], px[2], px[3] = p[0], 0, 0, 0xFF
+  })
+  decodeR16 = decodePixels(2, func(p []byte, px []byte) {
+    px[0], px[1], px[2], px[3] = p[1], 0, 0, 0xFF
+  })
+  decodeRG16 = decodePixels(2, func(p []byte, px []byte) {
+    px[0], px[1], px[2], px[3] = p[0], p[1], 0, 0xFF
+  })
+  decodeRGB24 = decodePixels(3, func(p []byte, px []byte) {
+    px[0], px[1], px[2], px[3] = p[0], p[1], p[2], 0xFF
+  })
+  decodeRGBA32 = decodePixels(4, func(p []byte, px []byte) {
+    copy(px[:4], p)
+  })
+  decodeARGB32 = decodePixels(4, func(p []byte, px []byte) {
+    px[0], px[1], px[2], px[3] = p[1], p[2], p[3], p[0]
+  })
+  decodeBGRA32 = decodePixels(4, func(p []byte, px []byte) {
+    px[0], px[1], px[2], px[3] = p[2], p[1], p[0], p[3]
+  })
+  decodeRGB565 = decodePixels(2, func(p []byte, px []byte) {
+    v := binary.LittleEndian.Uint16(p)
+    px[0], px[1], px[2], px[3] = expand5(int(v>>11)), expand6(int(v>>5&0x3F)), expand5(int(v&0x1F)), 0xFF
+  })
+  decodeARGB4444 = decodePixels(2, func(p []byte, px []byte) {
+    v := binary.LittleEndian.Uint16(p)
+    px[0], px[1], px[2], px[3] = expand4(int(v>>8)), expand4(int(v>>4)), expand4(int(v)), expand4(int(v>>12))
+  })
+  decodeRGBA4444 = decodePixels(2, func(p []byte, px []byte) {
+    v := binary.LittleEndian.Uint16(p)
+    px[0], px[1], px[2], px[3] = expand4(int(v>>12)), expand4(int(v>>8)), expand4(int(v>>4)), expand4(int(v))
+  })
+)
+
+func expand4(v int) uint8 {
+  v &= 0xF
+  return uint8(v<<4 | v)
+}
+
+func expand5(v int) uint8 {
+  v &= 0x1F
+  return uint8(v<<3 | v>>2)
+}
+
+func expand6(v int) uint8 {
+  v &= 0x3F
+  return uint8(v<<2 | v>>4)
+}
+
+func clamp255(v int) uint8 {
+  if v < 0 {
+    return 0
+  }
+  if v > 255 {
+    return 255
+  }
+  return uint8(v)
+}
+
+// decodeDXT1Block decodes a BC1 block, with 1 bit alpha when the first color
+// is not the greater one.
+func decodeDXT1Block(block []byte, out []byte) {
+  decodeDXTColors(block, out, true)
+}
+
+// decodeDXT5Block decodes a BC3 block, interpolated alpha then BC1 colors.
+func decodeDXT5Block(block []byte, out []byte) {
+  decodeDXTColors(block[8:], out, false)
+  a0, a1 := int(block[0]), int(block[1])
+  alphas := [8]int{a0, a1}
+  if a0 > a1 {
+    for i := 1; i < 7; i++ {
+      alphas[i+1] = ((7-i)*a0 + i*a1) / 7
+    }
+  } else {
+    for i := 1; i < 5; i++ {
+      alphas[i+1] = ((5-i)*a0 + i*a1) / 5
+    }
+    alphas[6], alphas[7] = 0, 255
+  }
+  indices := uint64(block[2]) | uint64(block[3])<<8 | uint64(block[4])<<16 |
+    uint64(block[5])<<24 | uint64(block[6])<<32 | uint64(block[7])<<40
+  for i := 0; i < 16; i++ {
+    out[i*4+3] = uint8(alphas[indices>>(3*i)&7])
+  }
+}
+
+func decodeDXTColors(block []byte, out []byte, punchThrough bool) {
+  c0 := binary.LittleEndian.Uint16(block)
+  c1 := binary.LittleEndian.Uint16(block[2:])
+  var colors [4][4]int
+  for i, c := range []uint16{c0, c1} {
+    colors[i] = [4]int{int(expand5(int(c >> 11))), int(expand6(int(c >> 5))), int(expand5(int(c))), 255}
+  }
+  for ch := 0; ch < 3; ch++ {
+    if c0 > c1 || !punchThrough {
+      colors[2][ch] = (2*colors[0][ch] + colors[1][ch]) / 3
+      colors[3][ch] = (colors[0][ch] + 2*colors[1][ch]) / 3
+    } else {
+      colors[2][ch] = (colors[0][ch] + colors[1][ch]) / 2
+    }
+  }
+  colors[2][3] = 255
+  if c0 > c1 || !punchThrough {
+    colors[3][3] = 255
+  }
+  indices := binary.LittleEndian.Uint32(block[4:])
+  for i := 0; i < 16; i++ {
+    c := colors[indices>>(2*i)&3]
+    out[i*4], out[i*4+1], out[i*4+2], out[i*4+3] = uint8(c[0]), uint8(c[1]), uint8(c[2]), uint8(c[3])
+  }
+}
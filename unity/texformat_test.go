@@ -0,0 +1,161 @@
+package unity
+
+import (
+  "bytes"
+  "fmt"
+  "testing"
+)
+
+// wantImage lists the pixels of a width x height image top row first, from
+// pixel which is given the coordinates of the data, bottom row first.
+func wantImage(width int, height int, pixel func(x int, y int) [4]uint8) []byte {
+  pix := []byte{}
+  for y := height - 1; y >= 0; y-- {
+    for x := range width {
+      p := pixel(x, y)
+      pix = append(pix, p[:]...)
+    }
+  }
+  return pix
+}
+
+// rows gives the pixels of a 1 pixel wide image, bottom row first.
+func rows(pixels ...[4]uint8) func(x int, y int) [4]uint8 {
+  return func(x int, y int) [4]uint8 {
+    return pixels[y]
+  }
+}
+
+// columns gives the pixels of every row of a block, by column.
+func columns(pixels ...[4]uint8) func(x int, y int) [4]uint8 {
+  return func(x int, y int) [4]uint8 {
+    return pixels[x%len(pixels)]
+  }
+}
+
+func TestDecodeImage(t *testing.T) {
+  astcBlock := []byte{0x42, 0x80, 0x01, 0xFE, 0x41, 0xC0, 0x81, 0x80, 0xFF, 0x01, 0x01, 0x00, 0x27, 0x27, 0x27, 0x27}
+  astcColumns := columns([4]uint8{0, 32, 64, 255}, [4]uint8{84, 95, 106, 214}, [4]uint8{171, 161, 150, 170}, [4]uint8{255, 224, 192, 128})
+  for _, c := range []struct {
+    format int
+    width  int
+    height int
+    src    []byte
+    want   func(x int, y int) [4]uint8
+  }{
+    {TEX_ALPHA8, 1, 2, []byte{0x80, 0x40}, rows([4]uint8{255, 255, 255, 0x80}, [4]uint8{255, 255, 255, 0x40})},
+    {TEX_ARGB4444, 1, 2, []byte{0x34, 0x12, 0xA5, 0xF0}, rows([4]uint8{0x22, 0x33, 0x44, 0x11}, [4]uint8{0, 0xAA, 0x55, 0xFF})},
+    {TEX_RGB24, 1, 2, []byte{1, 2, 3, 4, 5, 6}, rows([4]uint8{1, 2, 3, 255}, [4]uint8{4, 5, 6, 255})},
+    {TEX_RGBA32, 1, 2, []byte{1, 2, 3, 4, 5, 6, 7, 8}, rows([4]uint8{1, 2, 3, 4}, [4]uint8{5, 6, 7, 8})},
+    {TEX_ARGB32, 1, 2, []byte{1, 2, 3, 4, 5, 6, 7, 8}, rows([4]uint8{2, 3, 4, 1}, [4]uint8{6, 7, 8, 5})},
+    {TEX_RGB565, 1, 2, []byte{0x00, 0xF8, 0x10, 0x84}, rows([4]uint8{255, 0, 0, 255}, [4]uint8{132, 130, 132, 255})},
+    {TEX_R16, 1, 2, []byte{0x34, 0x12, 0xCD, 0xAB}, rows([4]uint8{0x12, 0, 0, 255}, [4]uint8{0xAB, 0, 0, 255})},
+    {TEX_RGBA4444, 1, 2, []byte{0x34, 0x12, 0xA5, 0xF0}, rows([4]uint8{0x11, 0x22, 0x33, 0x44}, [4]uint8{0xFF, 0, 0xAA, 0x55})},
+    {TEX_BGRA32, 1, 2, []byte{1, 2, 3, 4, 5, 6, 7, 8}, rows([4]uint8{3, 2, 1, 4}, [4]uint8{7, 6, 5, 8})},
+    {TEX_RG16, 1, 2, []byte{1, 2, 3, 4}, rows([4]uint8{1, 2, 0, 255}, [4]uint8{3, 4, 0, 255})},
+    {TEX_R8, 1, 2, []byte{7, 9}, rows([4]uint8{7, 0, 0, 255}, [4]uint8{9, 0, 0, 255})},
+
+    // red and blue, 4 colors, then green and white with 1 bit alpha and a
+    // transparent fourth color
+    {TEX_DXT1, 8, 4, []byte{0x00, 0xF8, 0x1F, 0x00, 0xE4, 0xE4, 0xE4, 0xE4, 0xE0, 0x07, 0xFF, 0xFF, 0xE4, 0xE4, 0xE4, 0xE4},
+      columns([4]uint8{255, 0, 0, 255}, [4]uint8{0, 0, 255, 255}, [4]uint8{170, 0, 85, 255}, [4]uint8{85, 0, 170, 255},
+        [4]uint8{0, 255, 0, 255}, [4]uint8{255, 255, 255, 255}, [4]uint8{127, 255, 127, 255}, [4]uint8{0, 0, 0, 0})},
+    // alpha from 255 to 0 in 8 steps, colors always interpolated in 4
+    {TEX_DXT5, 4, 4, []byte{0xFF, 0x00, 0x88, 0x8E, 0xE8, 0x88, 0x8E, 0xE8, 0xE0, 0x07, 0xFF, 0xFF, 0xE4, 0xE4, 0xE4, 0xE4},
+      columns([4]uint8{0, 255, 0, 255}, [4]uint8{255, 255, 255, 0}, [4]uint8{85, 255, 85, 218}, [4]uint8{170, 255, 170, 36})},
+    // individual colors, the right half clamped by the largest modifier
+    {TEX_ETC_RGB4, 4, 4, []byte{0x81, 0x43, 0x25, 0x1C, 0x00, 0x00, 0xFF, 0xFF},
+      columns([4]uint8{144, 76, 42, 255}, [4]uint8{144, 76, 42, 255}, [4]uint8{200, 234, 255, 255}, [4]uint8{200, 234, 255, 255})},
+    // differential colors flipped into top and bottom halves
+    {TEX_ETC2_RGB, 4, 4, []byte{0x81, 0x47, 0x00, 0x23, 0xFF, 0xFF, 0x00, 0x00},
+      func(x int, y int) [4]uint8 {
+        if y < 2 {
+          return [4]uint8{127, 61, 0, 255}
+        }
+        return [4]uint8{138, 55, 0, 255}
+      }},
+    // the first pixel is transparent, the others take the base colors
+    {TEX_ETC2_RGBA1, 4, 4, []byte{0x81, 0x47, 0x00, 0x21, 0x00, 0x01, 0x00, 0x00},
+      func(x int, y int) [4]uint8 {
+        switch {
+        case x == 0 && y == 0:
+          return [4]uint8{0, 0, 0, 0}
+        case y < 2:
+          return [4]uint8{132, 66, 0, 255}
+        }
+        return [4]uint8{140, 57, 0, 255}
+      }},
+    {TEX_ETC2_RGBA8, 4, 4, []byte{0x64, 0x20, 0x72, 0x49, 0x24, 0x92, 0x49, 0x24, 0x81, 0x47, 0x00, 0x23, 0xFF, 0xFF, 0x00, 0x00},
+      func(x int, y int) [4]uint8 {
+        alpha := uint8(104)
+        if x == 0 && y == 0 {
+          alpha = 70
+        }
+        if y < 2 {
+          return [4]uint8{127, 61, 0, alpha}
+        }
+        return [4]uint8{138, 55, 0, alpha}
+      }},
+    // RGBA endpoints with a weight for each texel of the columns
+    {TEX_ASTC_4x4, 4, 4, astcBlock, astcColumns},
+    {TEX_ASTC_RGBA_4x4, 4, 4, astcBlock, astcColumns},
+  } {
+    name := TextureFormatName(c.format)
+    img, err := decodeImage(c.format, c.width, c.height, c.src)
+    if err != nil {
+      t.Errorf("%s: %v", name, err)
+      continue
+    }
+    if want := wantImage(c.width, c.height, c.want); !bytes.Equal(img.Pix, want) {
+      t.Errorf("%s decodes to\n%v, want\n%v", name, img.Pix, want)
+    }
+  }
+}
+
+func TestDecodeASTCVoidExtent(t *testing.T) {
+  // a constant color, then a reserved block mode that decodes to magenta
+  voidExtent := []byte{0xFC, 0xFD, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0x34, 0x12, 0x78, 0x56, 0xBC, 0x9A, 0xF0, 0xDE}
+  reserved := make([]byte, 16)
+  for i, size := range []int{4, 5, 6, 8, 10, 12} {
+    for _, format := range []int{TEX_ASTC_4x4 + i, TEX_ASTC_RGBA_4x4 + i} {
+      // a block and a half wide, clipped at the right edge
+      width := size + size/2
+      img, err := decodeImage(format, width, size, append(bytes.Clone(voidExtent), reserved...))
+      if err != nil {
+        t.Fatalf("%s: %v", TextureFormatName(format), err)
+      }
+      want := wantImage(width, size, func(x int, y int) [4]uint8 {
+        if x < size {
+          return [4]uint8{0x12, 0x56, 0x9A, 0xDE}
+        }
+        return astcErrorColor
+      })
+      if !bytes.Equal(img.Pix, want) {
+        t.Errorf("%s decodes to %v", TextureFormatName(format), img.Pix)
+      }
+    }
+  }
+}
+
+func TestDecodeImageErrors(t *testing.T) {
+  for _, c := range []struct {
+    format int
+    width  int
+    height int
+    size   int
+  }{
+    {TEX_DXT5_CRUNCHED, 4, 4, 16},
+    {99, 4, 4, 16},
+    {TEX_RGBA32, 0, 4, 16},
+    {TEX_RGBA32, 4, 4, 63},
+    // 3 x 2 blocks
+    {TEX_ASTC_6x6, 13, 7, 6*16 - 1},
+  } {
+    if _, err := decodeImage(c.format, c.width, c.height, make([]byte, c.size)); err == nil {
+      t.Errorf("%s image of %dx%d from %d bytes was decoded", TextureFormatName(c.format), c.width, c.height, c.size)
+    }
+  }
+  if name := TextureFormatName(99); name != fmt.Sprintf("Format%d", 99) {
+    t.Errorf("format 99 is named %q", name)
+  }
+}
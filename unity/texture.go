@@ -0,0 +1,319 @@
+package unity
+
+import (
+  "errors"
+  "fmt"
+  "image"
+  "image/png"
+  "os"
+  "path/filepath"
+  "strconv"
+  "strings"
+)
+
+// Texture2D is the part of a Texture2D object needed to decode its first
+// image.
+type Texture2D struct {
+  PathID   int64
+  Name     string
+  Width    int
+  Height   int
+  Format   int
+  MipCount int
+  // image data, loaded from the streamed resource when it is not inline
+  Data []byte
+  // streamed resource of the image data, like "archive:/CAB-xxx/CAB-xxx.resS"
+  StreamPath   string
+  StreamOffset int64
+  StreamSize   int64
+}
+
+// FormatName names the texture format, like "ASTC_6x6".
+func (t *Texture2D) FormatName() string {
+  return TextureFormatName(t.Format)
+}
+
+// Image decodes the first mip of the texture.
+func (t *Texture2D) Image() (*image.NRGBA, error) {
+  img, err := decodeImage(t.Format, t.Width, t.Height, t.Data)
+  if err != nil {
+    return nil, fmt.Errorf("texture %q: %w", t.Name, err)
+  }
+  return img, nil
+}
+
+// WritePNG decodes the texture and writes it to path.
+func (t *Texture2D) WritePNG(path string) error {
+  img, err := t.Image()
+  if err != nil {
+    return err
+  }
+  file, err := os.Create(path)
+  if err != nil {
+    return err
+  }
+  if err := png.Encode(file, img); err != nil {
+    file.Close()
+    return err
+  }
+  return file.Close()
+}
+
+// ReadTexture2D reads the Texture2D object, with its type tree when the file
+// has one and with the field layout of its Unity version otherwise. Streamed
+// image data is left out, see Bundle.Textures.
+func (f *SerializedFile) ReadTexture2D(object ObjectInfo) (*Texture2D, error) {
+  if object.ClassID != CLASS_TEXTURE_2D {
+    return nil, fmt.Errorf("object %d is a %s, not a Texture2D", object.PathID, f.Type(object))
+  }
+  var t *Texture2D
+  var err error
+  if f.Tree(object) != nil {
+    t, err = f.readTexture2DFields(object)
+  } else {
+    t, err = f.readTexture2DLayout(object)
+  }
+  if err != nil {
+    return nil, err
+  }
+  t.PathID = object.PathID
+  return t, nil
+}
+
+func (f *SerializedFile) readTexture2DFields(object ObjectInfo) (*Texture2D, error) {
+  fields, err := f.Read(object)
+  if err != nil {
+    return nil, err
+  }
+  t := &Texture2D{
+    Name:     toString(fields["m_Name"]),
+    Width:    int(toInt64(fields["m_Width"])),
+    Height:   int(toInt64(fields["m_Height"])),
+    Format:   int(toInt64(fields["m_TextureFormat"])),
+    MipCount: int(toInt64(fields["m_MipCount"])),
+  }
+  t.Data, _ = fields["image data"].([]byte)
+  if stream, ok := fields["m_StreamData"].(map[string]any); ok {
+    t.StreamPath = toString(stream["path"])
+    t.StreamOffset = toInt64(stream["offset"])
+    t.StreamSize = toInt64(stream["size"])
+  }
+  return t, nil
+}
+
+// readTexture2DLayout reads the fields of Unity 2018.2 and later without a
+// type tree. Stripped version strings are taken for 2021.3, as unpack.py
+// does.
+func (f *SerializedFile) readTexture2DLayout(object ObjectInfo) (*Texture2D, error) {
+  major, minor := parseUnityVersion(f.UnityVersion)
+  if major == 0 {
+    major, minor = 2021, 3
+  }
+  atLeast := func(wantMajor int, wantMinor int) bool {
+    return major > wantMajor || (major == wantMajor && minor >= wantMinor)
+  }
+  if !atLeast(2018, 2) {
+    return nil, fmt.Errorf("Texture2D of Unity %s without type tree is not supported", f.UnityVersion)
+  }
+
+  r := f.objectReader(object)
+  t := &Texture2D{Name: r.alignedString()}
+  r.i32()  // forced fallback format
+  r.bool() // downscale fallback
+  if atLeast(2020, 2) {
+    r.bool() // alpha channel optional
+  }
+  r.align(4)
+  t.Width = int(r.i32())
+  t.Height = int(r.i32())
+  r.i32() // complete image size
+  if atLeast(2020, 1) {
+    r.i32() // mips stripped
+  }
+  t.Format = int(r.i32())
+  t.MipCount = int(r.i32())
+  r.bool() // readable
+  if atLeast(2020, 1) {
+    r.bool() // preprocessed
+  }
+  if atLeast(2019, 3) {
+    r.bool() // ignore master texture limit
+  }
+  if atLeast(2022, 2) {
+    r.align(4)
+    r.alignedString() // mipmap limit group name
+  }
+  r.bool() // streaming mipmaps
+  r.align(4)
+  r.i32()    // streaming mipmaps priority
+  r.i32()    // image count
+  r.i32()    // texture dimension
+  r.skip(24) // texture settings
+  r.i32()    // lightmap format
+  r.i32()    // color space
+  if atLeast(2020, 2) {
+    r.skip(r.count(1)) // platform blob
+    r.align(4)
+  }
+  t.Data = r.bytes(r.count(1))
+  r.align(4)
+  if atLeast(2020, 1) {
+    t.StreamOffset = r.i64()
+  } else {
+    t.StreamOffset = int64(r.u32())
+  }
+  t.StreamSize = int64(r.u32())
+  t.StreamPath = r.alignedString()
+  if r.err != nil {
+    return nil, fmt.Errorf("Texture2D %d: %w", object.PathID, r.err)
+  }
+  return t, nil
+}
+
+// parseUnityVersion parses the major and minor parts of a version like
+// "2021.3.16f1", 0 when it is stripped.
+func parseUnityVersion(version string) (int, int) {
+  parts := strings.SplitN(version, ".", 3)
+  if len(parts) < 2 {
+    return 0, 0
+  }
+  major, err := strconv.Atoi(parts[0])
+  if err != nil {
+    return 0, 0
+  }
+  minor, err := strconv.Atoi(parts[1])
+  if err != nil {
+    return 0, 0
+  }
+  return major, minor
+}
+
+// Textures reads every Texture2D of the bundle with its image data.
+func (b *Bundle) Textures() ([]*Texture2D, error) {
+  files, err := b.SerializedFiles()
+  if err != nil {
+    return nil, err
+  }
+  textures := []*Texture2D{}
+  for _, file := range files {
+    for _, object := range file.Objects {
+      if object.ClassID != CLASS_TEXTURE_2D {
+        continue
+      }
+      t, err := file.ReadTexture2D(object)
+      if err != nil {
+        return nil, fmt.Errorf("%s: %w", file.Path, err)
+      }
+      if len(t.Data) == 0 && t.StreamPath != "" {
+        resource, ok := b.Resource(t.StreamPath)
+        if !ok {
+          return nil, fmt.Errorf("texture %q: resource %q not found", t.Name, t.StreamPath)
+        }
+        if t.StreamOffset < 0 || t.StreamSize < 0 || t.StreamOffset > int64(len(resource))-t.StreamSize {
+          return nil, fmt.Errorf("texture %q: stream lies outside of %q", t.Name, t.StreamPath)
+        }
+        t.Data = resource[t.StreamOffset : t.StreamOffset+t.StreamSize]
+      }
+      textures = append(textures, t)
+    }
+  }
+  return textures, nil
+}
+
+// TextureOnly tells whether the bundle holds textures and nothing else than
+// the sprites cut from them, so that they are its whole content.
+func (b *Bundle) TextureOnly() bool {
+  files, err := b.SerializedFiles()
+  if err != nil {
+    return false
+  }
+  textures := 0
+  for _, file := range files {
+    for _, object := range file.Objects {
+      switch object.ClassID {
+      case CLASS_TEXTURE_2D:
+        textures++
+      case CLASS_ASSET_BUNDLE, CLASS_SPRITE:
+      default:
+        return false
+      }
+    }
+  }
+  return textures > 0
+}
+
+// ExtractTextures decodes every texture of the bundle at path into dir as
+// <name>.png and returns the files written. Textures sharing a name get their
+// PathID appended. A texture that fails does not stop the others, the errors
+// are joined.
+func ExtractTextures(path string, dir string) ([]string, error) {
+  bundle, err := OpenBundle(path)
+  if err != nil {
+    return nil, err
+  }
+  textures, err := bundle.Textures()
+  if err != nil {
+    return nil, err
+  }
+  if err := os.MkdirAll(dir, 0755); err != nil {
+    return nil, err
+  }
+  written := []string{}
+  errs := []error{}
+  taken := map[string]bool{}
+  for _, t := range textures {
+    name := t.FileName()
+    if taken[name] {
+      name = fmt.Sprintf("%s_%d.png", strings.TrimSuffix(name, ".png"), t.PathID)
+    }
+    taken[name] = true
+    dst := filepath.Join(dir, name)
+    if err := t.WritePNG(dst); err != nil {
+      errs = append(errs, err)
+      continue
+    }
+    written = append(written, dst)
+  }
+  return written, errors.Join(errs...)
+}
+
+// FileName is the name of the PNG of the texture, after its m_Name.
+func (t *Texture2D) FileName() string {
+  name := strings.Map(func(r rune) rune {
+    if strings.ContainsRune(`/\:*?"<>|`, r) || r < 0x20 {
+      return '_'
+    }
+    return r
+  }, t.Name)
+  if name == "" || name == "." || name == ".." {
+    name = fmt.Sprintf("Texture2D_%d", t.PathID)
+  }
+  return name + ".png"
+}
+
+func toInt64(value any) int64 {
+  switch v := value.(type) {
+  case int8:
+    return int64(v)
+  case uint8:
+    return int64(v)
+  case int16:
+    return int64(v)
+  case uint16:
+    return int64(v)
+  case int32:
+    return int64(v)
+  case uint32:
+    return int64(v)
+  case int64:
+    return v
+  case uint64:
+    return int64(v)
+  }
+  return 0
+}
+
+func toString(value any) string {
+  s, _ := value.(string)
+  return s
+}
@@ -0,0 +1,128 @@
+package unity
+
+import (
+  "bytes"
+  "encoding/binary"
+  "image"
+  "image/png"
+  "math"
+  "os"
+  "path/filepath"
+  "slices"
+  "testing"
+)
+
+type testTexture struct {
+  pathID int64
+  name   string
+  format int
+  data   []byte
+  // streamed from CAB-test.resS when data is nil
+  streamOffset uint64
+  streamSize   uint32
+}
+
+func testTexture2DTree() *testTypeNode {
+  imageData := testField("TypelessData", "image data", -1, testField("int", "size", 4), testField("UInt8", "data", 1))
+  imageData.align = true
+  return testField("Texture2D", "Base", -1,
+    testString("m_Name"),
+    testField("int", "m_Width", 4),
+    testField("int", "m_Height", 4),
+    testField("int", "m_TextureFormat", 4),
+    testField("int", "m_MipCount", 4),
+    imageData,
+    testField("StreamingInfo", "m_StreamData", -1,
+      testField("UInt64", "offset", 8),
+      testField("unsigned int", "size", 4),
+      testString("path"),
+    ),
+  )
+}
+
+// encodeTestTextureBundle encodes a bundle of 1x1 textures and the resource
+// they stream from.
+func encodeTestTextureBundle(resource []byte, textures ...testTexture) []byte {
+  objects := []testObject{}
+  for _, texture := range textures {
+    w := newTestWriter(binary.LittleEndian)
+    w.alignedString(texture.name)
+    w.u32(1)
+    w.u32(1)
+    w.u32(uint32(texture.format))
+    w.u32(1)
+    w.u32(uint32(len(texture.data)))
+    w.Write(texture.data)
+    w.align(4)
+    if texture.data == nil {
+      w.u64(texture.streamOffset)
+      w.u32(texture.streamSize)
+      w.alignedString("archive:/CAB-test/CAB-test.resS")
+    } else {
+      w.u64(0)
+      w.u32(0)
+      w.alignedString("")
+    }
+    objects = append(objects, testObject{texture.pathID, 0, w.Bytes()})
+  }
+  file := encodeTestSerializedFile(22, false, "2022.3.21f1", []testType{{CLASS_TEXTURE_2D, testTexture2DTree()}}, objects)
+  return encodeTestBundle(COMPRESSION_LZ4, COMPRESSION_LZ4, 0,
+    testBundleNode{"CAB-test", NODE_FLAG_SERIALIZED_FILE, file},
+    testBundleNode{"CAB-test.resS", 0, resource},
+  )
+}
+
+func TestExtractTextures(t *testing.T) {
+  resource := []byte{0, 0, 0, 0, 10, 20, 30, 40}
+  data := encodeTestTextureBundle(resource,
+    testTexture{pathID: 10, name: "icon", format: TEX_RGBA32, data: []byte{1, 2, 3, 4}},
+    testTexture{pathID: -20, name: "icon", format: TEX_RGBA32, streamOffset: 4, streamSize: 4},
+    testTexture{pathID: 30, name: "a/b", format: TEX_ALPHA8, data: []byte{5}},
+    testTexture{pathID: 40, name: "crunched", format: TEX_DXT1_CRUNCHED, data: []byte{1}},
+  )
+  path := filepath.Join(t.TempDir(), "textures.bundle")
+  if err := os.WriteFile(path, data, 0644); err != nil {
+    t.Fatal(err)
+  }
+  dir := t.TempDir()
+  written, err := ExtractTextures(path, dir)
+  if err == nil {
+    t.Error("crunched texture was extracted")
+  }
+  want := []string{filepath.Join(dir, "icon.png"), filepath.Join(dir, "icon_-20.png"), filepath.Join(dir, "a_b.png")}
+  if !slices.Equal(written, want) {
+    t.Fatalf("wrote %v, want %v", written, want)
+  }
+  for i, pixel := range [][]byte{{1, 2, 3, 4}, {10, 20, 30, 40}, {255, 255, 255, 5}} {
+    file, err := os.Open(written[i])
+    if err != nil {
+      t.Fatal(err)
+    }
+    img, err := png.Decode(file)
+    file.Close()
+    if err != nil {
+      t.Fatal(err)
+    }
+    nrgba, ok := img.(*image.NRGBA)
+    if !ok || !bytes.Equal(nrgba.Pix, pixel) {
+      t.Errorf("%s holds %v, want %v", written[i], img, pixel)
+    }
+  }
+}
+
+func TestBundleTexturesStreamOutside(t *testing.T) {
+  for _, stream := range []testTexture{
+    {streamOffset: 4, streamSize: 5},
+    {streamOffset: math.MaxInt64, streamSize: 4},
+    {streamOffset: math.MaxUint64, streamSize: 4},
+  } {
+    stream.pathID, stream.name, stream.format = 1, "streamed", TEX_RGBA32
+    b, err := ParseBundle(encodeTestTextureBundle(make([]byte, 8), stream))
+    if err != nil {
+      t.Fatal(err)
+    }
+    if _, err := b.Textures(); err == nil {
+      t.Errorf("stream of %d bytes at %d was read", stream.streamSize, stream.streamOffset)
+    }
+  }
+}
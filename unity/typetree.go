@@ -0,0 +1,254 @@
+package unity
+
+import (
+  "fmt"
+  "strings"
+)
+
+// META_FLAG_ALIGN marks fields which are followed by padding to 4 bytes.
+const META_FLAG_ALIGN = 0x4000
+
+// commonStrings is the string table shared by every type tree, referenced
+// with the high bit of an offset set. The offset of a string is the sum of
+// the lengths of the ones before it, null terminators included.
+var commonStrings = []string{
+  "AABB", "AnimationClip", "AnimationCurve", "AnimationState", "Array", "Base",
+  "BitField", "bitset", "bool", "char", "ColorRGBA", "Component", "data",
+  "deque", "double", "dynamic_array", "FastPropertyName", "first", "float",
+  "Font", "GameObject", "Generic Mono", "GradientNEW", "GUID", "GUIStyle",
+  "int", "list", "long long", "map", "Matrix4x4f", "MdFour", "MonoBehaviour",
+  "MonoScript", "m_ByteSize", "m_Curve", "m_EditorClassIdentifier",
+  "m_EditorHideFlags", "m_Enabled", "m_ExtensionPtr", "m_GameObject",
+  "m_Index", "m_IsArray", "m_IsStatic", "m_MetaFlag", "m_Name",
+  "m_ObjectHideFlags", "m_PrefabInternal", "m_PrefabParentObject",
+  "m_Script", "m_StaticEditorFlags", "m_Type", "m_Version", "Object", "pair",
+  "PPtr<Component>", "PPtr<GameObject>", "PPtr<Material>",
+  "PPtr<MonoBehaviour>", "PPtr<MonoScript>", "PPtr<Object>", "PPtr<Prefab>",
+  "PPtr<Sprite>", "PPtr<TextAsset>", "PPtr<Texture>", "PPtr<Texture2D>",
+  "PPtr<Transform>", "Prefab", "Quaternionf", "Rectf", "RectInt",
+  "RectOffset", "second", "set", "short", "size", "SInt16", "SInt32",
+  "SInt64", "SInt8", "staticvector", "string", "TextAsset", "TextMesh",
+  "Texture", "Texture2D", "Transform", "TypelessData", "UInt16", "UInt32",
+  "UInt64", "UInt8", "unsigned int", "unsigned long long", "unsigned short",
+  "vector", "Vector2f", "Vector3f", "Vector4f", "m_ScriptingClassIdentifier",
+  "Gradient", "Type*", "int2_storage", "int3_storage", "BoundsInt",
+  "m_CorrespondingSourceObject", "m_PrefabInstance", "m_PrefabAsset",
+  "FileSize", "Hash128", "RenderingLayerMask",
+}
+
+var commonStringOffsets = func() map[uint32]string {
+  offsets := make(map[uint32]string, len(commonStrings))
+  offset := uint32(0)
+  for _, s := range commonStrings {
+    offsets[offset] = s
+    offset += uint32(len(s)) + 1
+  }
+  return offsets
+}()
+
+// TypeTreeNode describes one field of a serialized type, the root node being
+// the type itself.
+type TypeTreeNode struct {
+  Type      string
+  Name      string
+  ByteSize  int32
+  Version   uint16
+  Level     uint8
+  TypeFlags uint8
+  MetaFlag  int32
+  Children  []*TypeTreeNode
+}
+
+// readTypeTreeBlob reads a type tree stored as a node table followed by its
+// string buffer, used since serialized file version 12, and returns the root.
+func readTypeTreeBlob(r *reader, version uint32) *TypeTreeNode {
+  nodeSize := 24
+  if version >= 19 {
+    nodeSize = 32
+  }
+  count := r.count(nodeSize)
+  stringsSize := int(r.i32())
+  type rawNode struct {
+    node       *TypeTreeNode
+    typeOffset uint32
+    nameOffset uint32
+  }
+  raw := make([]rawNode, count)
+  for i := range raw {
+    node := &TypeTreeNode{}
+    node.Version = r.u16()
+    node.Level = r.u8()
+    node.TypeFlags = r.u8()
+    raw[i].typeOffset = r.u32()
+    raw[i].nameOffset = r.u32()
+    node.ByteSize = r.i32()
+    r.i32() // index
+    node.MetaFlag = r.i32()
+    if version >= 19 {
+      r.u64() // hash of the referenced type
+    }
+    raw[i].node = node
+  }
+  local := r.bytes(stringsSize)
+  if r.err != nil || count == 0 {
+    if r.err == nil {
+      r.fail(fmt.Errorf("empty type tree"))
+    }
+    return nil
+  }
+
+  lookup := func(offset uint32) string {
+    if offset&0x80000000 != 0 {
+      if s, ok := commonStringOffsets[offset&0x7FFFFFFF]; ok {
+        return s
+      }
+      return fmt.Sprintf("unknown_%d", offset&0x7FFFFFFF)
+    }
+    if int(offset) >= len(local) {
+      return fmt.Sprintf("unknown_%d", offset)
+    }
+    s := local[offset:]
+    if end := strings.IndexByte(string(s), 0); end >= 0 {
+      s = s[:end]
+    }
+    return string(s)
+  }
+
+  // nodes are listed depth first with their level
+  stack := []*TypeTreeNode{}
+  for i := range raw {
+    node := raw[i].node
+    node.Type = lookup(raw[i].typeOffset)
+    node.Name = lookup(raw[i].nameOffset)
+    for len(stack) > 0 && stack[len(stack)-1].Level >= node.Level {
+      stack = stack[:len(stack)-1]
+    }
+    if len(stack) > 0 {
+      parent := stack[len(stack)-1]
+      parent.Children = append(parent.Children, node)
+    } else if i > 0 {
+      r.fail(fmt.Errorf("type tree has several roots"))
+      return nil
+    }
+    stack = append(stack, node)
+  }
+  return raw[0].node
+}
+
+// Child returns the direct child named name, or nil.
+func (n *TypeTreeNode) Child(name string) *TypeTreeNode {
+  for _, child := range n.Children {
+    if child.Name == name {
+      return child
+    }
+  }
+  return nil
+}
+
+func (n *TypeTreeNode) isArray() bool {
+  return len(n.Children) == 1 && n.Children[0].Type == "Array"
+}
+
+// read decodes the value of n. Structures become map[string]any, arrays
+// []any except arrays of bytes which stay []byte, and PPtr a map with
+// m_FileID and m_PathID.
+func (n *TypeTreeNode) read(r *reader) any {
+  var value any
+  switch n.Type {
+  case "SInt8":
+    value = int8(r.u8())
+  case "UInt8", "char":
+    value = r.u8()
+  case "bool":
+    value = r.bool()
+  case "SInt16", "short":
+    value = r.i16()
+  case "UInt16", "unsigned short":
+    value = r.u16()
+  case "SInt32", "int":
+    value = r.i32()
+  case "UInt32", "unsigned int", "Type*":
+    value = r.u32()
+  case "SInt64", "long long":
+    value = r.i64()
+  case "UInt64", "unsigned long long", "FileSize":
+    value = r.u64()
+  case "float":
+    value = r.f32()
+  case "double":
+    value = r.f64()
+  case "string":
+    value = string(r.bytes(r.count(1)))
+    if len(n.Children) > 0 && n.Children[0].MetaFlag&META_FLAG_ALIGN != 0 {
+      r.align(4)
+    }
+  case "TypelessData":
+    value = r.bytes(r.count(1))
+  default:
+    if n.isArray() {
+      value = n.Children[0].readArray(r)
+    } else if n.Type == "Array" {
+      value = n.readArray(r)
+    } else {
+      fields := make(map[string]any, len(n.Children))
+      for _, child := range n.Children {
+        fields[child.Name] = child.read(r)
+        if r.err != nil {
+          break
+        }
+      }
+      value = fields
+    }
+  }
+  if n.MetaFlag&META_FLAG_ALIGN != 0 {
+    r.align(4)
+  }
+  return value
+}
+
+// readArray decodes an Array node, whose children are the size and the
+// element.
+func (n *TypeTreeNode) readArray(r *reader) any {
+  if len(n.Children) != 2 {
+    r.fail(fmt.Errorf("array %q has %d children", n.Name, len(n.Children)))
+    return nil
+  }
+  elem := n.Children[1]
+  minSize := 1
+  if elem.ByteSize > 0 {
+    minSize = int(elem.ByteSize)
+  }
+  size := r.count(minSize)
+  var value any
+  if elem.Type == "UInt8" || elem.Type == "char" {
+    value = r.bytes(size)
+  } else {
+    items := make([]any, 0, size)
+    for range size {
+      items = append(items, elem.read(r))
+      if r.err != nil {
+        break
+      }
+    }
+    value = items
+  }
+  if n.MetaFlag&META_FLAG_ALIGN != 0 {
+    r.align(4)
+  }
+  return value
+}
+
+// readUntil decodes the fields of the structure n up to and including the
+// one named name, which is returned.
+func (n *TypeTreeNode) readUntil(r *reader, name string) (any, bool) {
+  for _, child := range n.Children {
+    value := child.read(r)
+    if r.err != nil {
+      return nil, false
+    }
+    if child.Name == name {
+      return value, true
+    }
+  }
+  return nil, false
+}
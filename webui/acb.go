@@ -0,0 +1,180 @@
+package webui
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"vertesan/hailstorm/cri"
+	"vertesan/hailstorm/runtimecfg"
+)
+
+const hcaKeyEnv = "HAILSTORM_HCA_KEY"
+
+// sniffAcb tells whether the file at path starts like an ACB without reading
+// all of it.
+func sniffAcb(path string) bool {
+	file, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer file.Close()
+	head := make([]byte, len(cri.UTF_SIGNATURE))
+	if _, err := io.ReadFull(file, head); err != nil {
+		return false
+	}
+	return cri.IsAcb(head)
+}
+
+// openAcb parses the ACB at path, nil when it is not one or fails.
+func openAcb(path string) *cri.Acb {
+	if !sniffAcb(path) {
+		return nil
+	}
+	acb, err := cri.OpenAcb(path)
+	if err != nil {
+		debugLog("Failed to read ACB %s: %v", path, err)
+		return nil
+	}
+	return acb
+}
+
+// inspectAcb lists the cues of the ACB at path with the waveforms they play,
+// so that the view does not need vgmstream for it.
+func inspectAcb(path string) (map[string]any, error) {
+	acb, err := cri.OpenAcb(path)
+	if err != nil {
+		return nil, err
+	}
+	waveforms := make([]map[string]any, 0, len(acb.Waveforms))
+	for _, waveform := range acb.Waveforms {
+		waveforms = append(waveforms, map[string]any{
+			"index":      waveform.Index,
+			"id":         waveform.ID,
+			"codec":      waveform.Codec,
+			"encodeType": waveform.EncodeType,
+			"channels":   waveform.Channels,
+			"sampleRate": waveform.SampleRate,
+			"samples":    waveform.Samples,
+			"durationMs": waveform.Milliseconds(),
+			"loop":       waveform.Loop,
+			"streaming":  waveform.Streaming,
+			"subsong":    waveform.Subsong,
+		})
+	}
+	cues := make([]map[string]any, 0, len(acb.Cues))
+	for _, cue := range acb.Cues {
+		cues = append(cues, map[string]any{
+			"index":     cue.Index,
+			"id":        cue.ID,
+			"name":      cue.Name,
+			"lengthMs":  cue.Length,
+			"waveforms": cue.Waveforms,
+		})
+	}
+	streamAwb := ""
+	if acb.StreamAwbPath != "" {
+		streamAwb = filepath.Base(acb.StreamAwbPath)
+	}
+	return map[string]any{
+		"name":           acb.Name,
+		"version":        acb.Version,
+		"subsongs":       acb.Subsongs(),
+		"streamed":       acb.HasStreamed(),
+		"streamAwb":      streamAwb,
+		"streamAwbNames": acb.StreamAwbNames,
+		"cues":           cues,
+		"waveforms":      waveforms,
+	}, nil
+}
+
+// acbTrackName names a preview track after the cue playing its subsong.
+func acbTrackName(acb *cri.Acb, subsong int) string {
+	if acb != nil {
+		if name := acb.SubsongName(subsong); name != "" {
+			return name
+		}
+	}
+	return fmt.Sprintf("Track %02d", subsong)
+}
+
+// configuredHcaKey is the key of keyed HCA waveforms, 0 when none is set.
+func configuredHcaKey() uint64 {
+	value := ""
+	if cfg, err := runtimecfg.Load(); err == nil {
+		value = cfg.HcaKey
+	}
+	if value == "" {
+		value = strings.TrimSpace(os.Getenv(hcaKeyEnv))
+	}
+	if value == "" {
+		return 0
+	}
+	key, err := strconv.ParseUint(value, 0, 64)
+	if err != nil {
+		debugLog("Ignoring invalid HCA key %q: %v", value, err)
+		return 0
+	}
+	return key
+}
+
+// acbTracks are the waveforms previewed as tracks counted from 1, the
+// in-memory ones by subsong or the streamed ones when nothing is embedded.
+func acbTracks(acb *cri.Acb) []*cri.Waveform {
+	if acb == nil {
+		return nil
+	}
+	tracks := []*cri.Waveform{}
+	if subsongs := acb.Subsongs(); subsongs > 0 {
+		for subsong := 1; subsong <= subsongs; subsong++ {
+			waveform, ok := acb.SubsongWaveform(subsong)
+			if !ok {
+				return nil
+			}
+			tracks = append(tracks, waveform)
+		}
+		return tracks
+	}
+	for i := range acb.Waveforms {
+		if acb.Waveforms[i].Streaming && acb.Waveforms[i].Subsong > 0 {
+			tracks = append(tracks, &acb.Waveforms[i])
+		}
+	}
+	sort.SliceStable(tracks, func(i, j int) bool {
+		return tracks[i].Subsong < tracks[j].Subsong
+	})
+	return tracks
+}
+
+// acbTrack is the waveform of a track counted from 1, nil when it has none.
+func acbTrack(tracks []*cri.Waveform, track int) *cri.Waveform {
+	if track < 1 || track > len(tracks) {
+		return nil
+	}
+	return tracks[track-1]
+}
+
+// decodeAcbWaveformToWav decodes an HCA waveform to a WAV file at outPath.
+func decodeAcbWaveformToWav(acb *cri.Acb, waveform *cri.Waveform, outPath string) error {
+	data, subkey, err := acb.ReadWaveform(waveform)
+	if err != nil {
+		return err
+	}
+	if !cri.IsHca(data) {
+		return fmt.Errorf("waveform %d is %s, not HCA", waveform.Index, waveform.Codec)
+	}
+	var buf bytes.Buffer
+	if err := cri.HcaToWav(&buf, data, configuredHcaKey(), subkey); err != nil {
+		return fmt.Errorf("waveform %d: %w", waveform.Index, err)
+	}
+	tmpPath := outPath + ".tmp"
+	if err := os.WriteFile(tmpPath, buf.Bytes(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, outPath)
+}
@@ -0,0 +1,103 @@
+package webui
+
+import (
+	"io"
+	"os"
+	"strconv"
+
+	"vertesan/hailstorm/unity"
+)
+
+// bundleObjectLimit caps the objects listed per serialized file.
+const bundleObjectLimit = 2000
+
+// sniffBundle tells whether the file at path is a UnityFS bundle without
+// reading all of it.
+func sniffBundle(path string) bool {
+	file, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer file.Close()
+	head := make([]byte, len(unity.BUNDLE_SIGNATURE)+1)
+	if _, err := io.ReadFull(file, head); err != nil {
+		return false
+	}
+	return unity.IsBundle(head)
+}
+
+// textureOnlyBundle tells whether the file at path is a bundle of textures,
+// which the native decoder exports without AssetRipper.
+func textureOnlyBundle(path string) bool {
+	if !sniffBundle(path) {
+		return false
+	}
+	bundle, err := unity.OpenBundle(path)
+	if err != nil {
+		debugLog("Failed to read bundle %s: %v", path, err)
+		return false
+	}
+	return bundle.TextureOnly()
+}
+
+// inspectBundle summarizes the files and objects of the bundle at path with
+// the native reader, so that the view does not need AssetRipper for it.
+func inspectBundle(path string) (map[string]any, error) {
+	bundle, err := unity.OpenBundle(path)
+	if err != nil {
+		return nil, err
+	}
+	files := make([]map[string]any, 0, len(bundle.Nodes))
+	for _, node := range bundle.Nodes {
+		files = append(files, map[string]any{
+			"path":       node.Path,
+			"size":       node.Size,
+			"flags":      node.Flags,
+			"serialized": node.IsSerializedFile(),
+		})
+	}
+	serializedFiles, err := bundle.SerializedFiles()
+	if err != nil {
+		return nil, err
+	}
+	serialized := make([]map[string]any, 0, len(serializedFiles))
+	for _, file := range serializedFiles {
+		objects := make([]map[string]any, 0, min(len(file.Objects), bundleObjectLimit))
+		for _, object := range file.Objects[:min(len(file.Objects), bundleObjectLimit)] {
+			objects = append(objects, map[string]any{
+				// path IDs do not fit in a JavaScript number
+				"pathId":  strconv.FormatInt(object.PathID, 10),
+				"classId": object.ClassID,
+				"type":    file.Type(object),
+				"name":    file.Name(object),
+				"size":    object.ByteSize,
+			})
+		}
+		externals := make([]map[string]any, 0, len(file.Externals))
+		for i, external := range file.Externals {
+			externals = append(externals, map[string]any{
+				"fileId": i + 1,
+				"path":   external.PathName,
+				"guid":   external.GUID,
+			})
+		}
+		serialized = append(serialized, map[string]any{
+			"path":         file.Path,
+			"version":      file.Version,
+			"unityVersion": file.UnityVersion,
+			"typeTree":     file.TypeTree,
+			"objectCount":  len(file.Objects),
+			"objects":      objects,
+			"externals":    externals,
+		})
+	}
+	return map[string]any{
+		"formatVersion":   bundle.FormatVersion,
+		"unityVersion":    bundle.UnityVersion,
+		"unityRevision":   bundle.UnityRevision,
+		"size":            bundle.Size,
+		"compression":     unity.CompressionName(bundle.Compression()),
+		"files":           files,
+		"serializedFiles": serialized,
+	}, nil
+}
@@ -7,12 +7,14 @@ import (
 
 	"vertesan/hailstorm/manifest"
 	"vertesan/hailstorm/runner"
-	"vertesan/hailstorm/utils"
 )
 
 type CatalogStore struct {
 	mu      sync.RWMutex
 	entries []manifest.Entry
+	// the catalog file entries come from, nil for a legacy JSON catalog
+	file    *manifest.CatalogFile
+	path    string
 	modTime time.Time
 	loaded  bool
 }
@@ -22,11 +24,14 @@ func NewCatalogStore() *CatalogStore {
 }
 
 func (c *CatalogStore) Reload() error {
-	info, err := os.Stat(runner.CatalogJsonFile)
+	path := runner.CurrentCatalogFile()
+	info, err := os.Stat(path)
 	if err != nil {
 		if os.IsNotExist(err) {
 			c.mu.Lock()
 			c.entries = nil
+			c.file = nil
+			c.path = ""
 			c.modTime = time.Time{}
 			c.loaded = false
 			c.mu.Unlock()
@@ -36,25 +41,53 @@ func (c *CatalogStore) Reload() error {
 	}
 
 	c.mu.RLock()
-	if c.loaded && info.ModTime().Equal(c.modTime) {
+	if c.loaded && path == c.path && info.ModTime().Equal(c.modTime) {
 		c.mu.RUnlock()
 		return nil
 	}
 	c.mu.RUnlock()
 
-	entries := []manifest.Entry{}
-	if err := utils.ReadFromJsonFile(runner.CatalogJsonFile, &entries); err != nil {
-		return err
+	var file *manifest.CatalogFile
+	var entries []manifest.Entry
+	if path == runner.CatalogFile {
+		file, err = manifest.OpenCatalogFile(path)
+		if err != nil {
+			return err
+		}
+		entries = file.Entries()
+	} else {
+		entries, err = manifest.LoadCatalogEntries(path)
+		if err != nil {
+			return err
+		}
 	}
 
 	c.mu.Lock()
 	c.entries = entries
+	c.file = file
+	c.path = path
 	c.modTime = info.ModTime()
 	c.loaded = true
 	c.mu.Unlock()
 	return nil
 }
 
+// Lookup finds the entry labelled label, through the label index of the
+// catalog file when there is one.
+func (c *CatalogStore) Lookup(label string) (manifest.Entry, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if c.file != nil {
+		return c.file.Lookup(label)
+	}
+	for _, entry := range c.entries {
+		if entry.StrLabelCrc == label {
+			return entry, true
+		}
+	}
+	return manifest.Entry{}, false
+}
+
 func (c *CatalogStore) Entries() []manifest.Entry {
 	c.mu.RLock()
 	defer c.mu.RUnlock()
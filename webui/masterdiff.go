@@ -14,15 +14,13 @@ import (
 
 	"vertesan/hailstorm/manifest"
 	"vertesan/hailstorm/runner"
-	"vertesan/hailstorm/utils"
 )
 
 const (
-	versionSnapshotCatalogFile = "catalog.json"
-	versionSnapshotMarkerFile  = "version.txt"
-	defaultMasterDiffLimit     = 5000
-	maxMasterDiffLimit         = 20000
-	maxLookupLabels            = 500
+	versionSnapshotMarkerFile = "version.txt"
+	defaultMasterDiffLimit    = 5000
+	maxMasterDiffLimit        = 20000
+	maxLookupLabels           = 500
 )
 
 var (
@@ -252,8 +250,8 @@ func collectCatalogVersionSources() ([]catalogVersionSnapshot, map[string]string
 				continue
 			}
 			baseDir := filepath.Join(runner.CatalogVersionHistoryDir, dir.Name())
-			catalogPath := filepath.Join(baseDir, versionSnapshotCatalogFile)
-			if !fileExists(catalogPath) {
+			catalogPath := runner.VersionSnapshotCatalogFile(baseDir)
+			if catalogPath == "" {
 				continue
 			}
 
@@ -294,10 +292,11 @@ func collectCatalogVersionSources() ([]catalogVersionSnapshot, map[string]string
 		}
 	}
 
-	if currentVersion != "" && fileExists(runner.CatalogJsonFile) {
-		currentInfo, err := os.Stat(runner.CatalogJsonFile)
+	currentPath := runner.CurrentCatalogFile()
+	if currentVersion != "" && fileExists(currentPath) {
+		currentInfo, err := os.Stat(currentPath)
 		if err == nil {
-			sources[currentVersion] = runner.CatalogJsonFile
+			sources[currentVersion] = currentPath
 			if idx, exists := indexByVersion[currentVersion]; exists {
 				snapshots[idx].Current = true
 				snapshots[idx].Source = "current"
@@ -326,11 +325,7 @@ func readCurrentCatalogVersion() string {
 }
 
 func loadCatalogEntries(path string) ([]manifest.Entry, error) {
-	entries := []manifest.Entry{}
-	if err := utils.ReadFromJsonFile(path, &entries); err != nil {
-		return nil, err
-	}
-	return entries, nil
+	return manifest.LoadCatalogEntries(path)
 }
 
 func loadCatalogEntryMapsForVersions(fromVersion string, toVersion string) (map[string]manifest.Entry, map[string]manifest.Entry, error) {
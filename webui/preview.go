@@ -19,6 +19,9 @@ import (
 	"strconv"
 	"strings"
 	"time"
+
+	"vertesan/hailstorm/cri"
+	"vertesan/hailstorm/unity"
 )
 
 const previewRoot = "cache/webui-preview"
@@ -147,7 +150,7 @@ func resolvePreview(entryLabel string, entryType string, resourceType uint32, pl
 	}
 
 	if isAssetBundle(entryLabel, resourceType) {
-		return inspectAssetBundlePreview(entryLabel)
+		return inspectAssetBundlePreview(entryLabel, plainPath)
 	}
 
 	return PreviewInfo{}
@@ -191,8 +194,9 @@ func sniffDirectPreview(path string) PreviewInfo {
 
 func inspectAcbPreview(label string, plainPath string) PreviewInfo {
 	outDir := filepath.Join(previewRoot, "acb")
-	toolsOK := acbToolsAvailable()
-	if !toolsOK {
+	acb := openAcb(plainPath)
+	exportable := acbToolsAvailable() || len(acbTracks(acb)) > 0
+	if !exportable {
 		return PreviewInfo{
 			OutputDir:  outputDirForClient(outDir),
 			Exportable: false,
@@ -202,61 +206,62 @@ func inspectAcbPreview(label string, plainPath string) PreviewInfo {
 	if !fileExists(plainPath) {
 		return PreviewInfo{
 			OutputDir:  outputDirForClient(outDir),
-			Exportable: toolsOK,
+			Exportable: exportable,
 		}
 	}
 	base := sanitizeLabel(label)
-	outPath := filepath.Join(outDir, base+".mp3")
-	if isFresh(outPath, plainPath) {
-		return PreviewInfo{
-			Available:   true,
-			Kind:        "audio",
-			ContentType: "audio/mpeg",
-			Path:        outPath,
-			Source:      "derived",
-			OutputDir:   outputDirForClient(outDir),
-			Exportable:  toolsOK,
+	for _, ext := range acbPreviewExts() {
+		outPath := filepath.Join(outDir, base+ext)
+		if isFresh(outPath, plainPath) {
+			return PreviewInfo{
+				Available:   true,
+				Kind:        "audio",
+				ContentType: acbPreviewContentType(outPath),
+				Path:        outPath,
+				Source:      "derived",
+				OutputDir:   outputDirForClient(outDir),
+				Exportable:  exportable,
+			}
 		}
 	}
 
-	multi, _ := filepath.Glob(filepath.Join(outDir, base+"_[0-9][0-9].mp3"))
-	if len(multi) == 0 {
-		return PreviewInfo{
-			OutputDir:  outputDirForClient(outDir),
-			Exportable: toolsOK,
+	items := []PreviewItem{}
+	for _, ext := range acbPreviewExts() {
+		multi, _ := filepath.Glob(filepath.Join(outDir, base+"_[0-9][0-9]"+ext))
+		sort.Strings(multi)
+		for _, path := range multi {
+			if !isFresh(path, plainPath) {
+				continue
+			}
+			baseName := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+			parts := strings.Split(baseName, "_")
+			id := parts[len(parts)-1]
+			subsong, _ := strconv.Atoi(id)
+			items = append(items, PreviewItem{
+				ID:          id,
+				ContentType: acbPreviewContentType(path),
+				Path:        path,
+				Name:        acbTrackName(acb, subsong),
+			})
 		}
-	}
-	sort.Strings(multi)
-
-	items := make([]PreviewItem, 0, len(multi))
-	for _, path := range multi {
-		if !isFresh(path, plainPath) {
-			continue
+		if len(items) > 0 {
+			break
 		}
-		baseName := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
-		parts := strings.Split(baseName, "_")
-		id := parts[len(parts)-1]
-		items = append(items, PreviewItem{
-			ID:          id,
-			ContentType: "audio/mpeg",
-			Path:        path,
-			Name:        fmt.Sprintf("Track %s", id),
-		})
 	}
 	if len(items) == 0 {
 		return PreviewInfo{
 			OutputDir:  outputDirForClient(outDir),
-			Exportable: toolsOK,
+			Exportable: exportable,
 		}
 	}
 	return PreviewInfo{
 		Available:   true,
 		Kind:        "audio",
-		ContentType: "audio/mpeg",
+		ContentType: items[0].ContentType,
 		Path:        items[0].Path,
 		Source:      "derived",
 		OutputDir:   outputDirForClient(outDir),
-		Exportable:  toolsOK,
+		Exportable:  exportable,
 		Items:       items,
 	}
 }
@@ -273,8 +278,10 @@ func ensureAcbPreview(label string, plainPath string) PreviewInfo {
 
 func ensureAcbPreviewWithProgress(label string, plainPath string, report PreviewProgressReporter) PreviewInfo {
 	outDir := filepath.Join(previewRoot, "acb")
-	toolsOK := acbToolsAvailable()
-	if !toolsOK {
+	acb := openAcb(plainPath)
+	tracks := acbTracks(acb)
+	exportable := acbToolsAvailable() || len(tracks) > 0
+	if !exportable {
 		return PreviewInfo{
 			OutputDir:  outputDirForClient(outDir),
 			Exportable: false,
@@ -284,20 +291,24 @@ func ensureAcbPreviewWithProgress(label string, plainPath string, report Preview
 	if !fileExists(plainPath) {
 		return PreviewInfo{
 			OutputDir:  outputDirForClient(outDir),
-			Exportable: toolsOK,
+			Exportable: exportable,
 		}
 	}
 	if err := os.MkdirAll(outDir, 0755); err != nil {
 		return PreviewInfo{
 			OutputDir:  outputDirForClient(outDir),
-			Exportable: toolsOK,
+			Exportable: exportable,
 		}
 	}
 	base := sanitizeLabel(label)
-	outPath := filepath.Join(outDir, base+".mp3")
+	ext := acbPreviewExts()[0]
+	outPath := filepath.Join(outDir, base+ext)
 
 	reportPreviewProgress(report, 8, "prepare", "")
-	streamCount := detectStreamCount(plainPath)
+	streamCount := len(tracks)
+	if streamCount == 0 {
+		streamCount = detectStreamCount(plainPath)
+	}
 	reportPreviewProgress(report, 14, "probe", fmt.Sprintf("streams=%d", streamCount))
 	if streamCount <= 1 {
 		if isFresh(outPath, plainPath) {
@@ -305,55 +316,55 @@ func ensureAcbPreviewWithProgress(label string, plainPath string, report Preview
 			return PreviewInfo{
 				Available:   true,
 				Kind:        "audio",
-				ContentType: "audio/mpeg",
+				ContentType: acbPreviewContentType(outPath),
 				Path:        outPath,
 				Source:      "derived",
 				OutputDir:   outputDirForClient(outDir),
-				Exportable:  toolsOK,
+				Exportable:  exportable,
 			}
 		}
 
 		reportPreviewProgress(report, 28, "decode", "")
-		_, ok := encodeAcbToMp3(plainPath, outPath, 0)
+		_, ok := encodeAcbTrack(plainPath, acb, acbTrack(tracks, 1), outPath, 0)
 		if !ok {
 			return PreviewInfo{
 				OutputDir:  outputDirForClient(outDir),
-				Exportable: toolsOK,
+				Exportable: exportable,
 			}
 		}
 		reportPreviewProgress(report, 94, "finalize", "")
 		return PreviewInfo{
 			Available:   true,
 			Kind:        "audio",
-			ContentType: "audio/mpeg",
+			ContentType: acbPreviewContentType(outPath),
 			Path:        outPath,
 			Source:      "derived",
 			OutputDir:   outputDirForClient(outDir),
-			Exportable:  toolsOK,
+			Exportable:  exportable,
 		}
 	}
 
 	items := []PreviewItem{}
 	for i := 1; i <= streamCount; i++ {
-		suffix := fmt.Sprintf("%s_%02d.mp3", base, i)
+		suffix := fmt.Sprintf("%s_%02d%s", base, i, ext)
 		out := filepath.Join(outDir, suffix)
 		start := 16 + (float64(i-1)/float64(streamCount))*74
 		end := 16 + (float64(i)/float64(streamCount))*74
 		reportPreviewProgress(report, start, "transcode", fmt.Sprintf("track=%d/%d", i, streamCount))
 
 		if !isFresh(out, plainPath) {
-			item, ok := encodeAcbToMp3(plainPath, out, i)
+			item, ok := encodeAcbTrack(plainPath, acb, acbTrack(tracks, i), out, i)
 			if !ok {
 				continue
 			}
-			item.Name = fmt.Sprintf("Track %02d", i)
+			item.Name = acbTrackName(acb, i)
 			items = append(items, item)
 		} else {
 			items = append(items, PreviewItem{
 				ID:          fmt.Sprintf("%02d", i),
-				ContentType: "audio/mpeg",
+				ContentType: acbPreviewContentType(out),
 				Path:        out,
-				Name:        fmt.Sprintf("Track %02d", i),
+				Name:        acbTrackName(acb, i),
 			})
 		}
 		reportPreviewProgress(report, end, "transcode", fmt.Sprintf("track=%d/%d", i, streamCount))
@@ -362,7 +373,7 @@ func ensureAcbPreviewWithProgress(label string, plainPath string, report Preview
 	if len(items) == 0 {
 		return PreviewInfo{
 			OutputDir:  outputDirForClient(outDir),
-			Exportable: toolsOK,
+			Exportable: exportable,
 		}
 	}
 	reportPreviewProgress(report, 96, "finalize", "")
@@ -370,11 +381,11 @@ func ensureAcbPreviewWithProgress(label string, plainPath string, report Preview
 	return PreviewInfo{
 		Available:   true,
 		Kind:        "audio",
-		ContentType: "audio/mpeg",
+		ContentType: items[0].ContentType,
 		Path:        items[0].Path,
 		Source:      "derived",
 		OutputDir:   outputDirForClient(outDir),
-		Exportable:  toolsOK,
+		Exportable:  exportable,
 		Items:       items,
 	}
 }
@@ -482,11 +493,11 @@ func ensureUsmPreviewWithProgress(label string, plainPath string, force bool, re
 	}
 }
 
-func inspectAssetBundlePreview(label string) PreviewInfo {
+func inspectAssetBundlePreview(label string, plainPath string) PreviewInfo {
 	outDir := filepath.Join(previewRoot, "assetbundle", sanitizeLabel(label))
 	info := findBundlePreview(outDir)
 	info.OutputDir = outputDirForClient(outDir)
-	info.Exportable = assetBundleExportConfigured()
+	info.Exportable = assetBundleExportConfigured() || textureOnlyBundle(plainPath)
 	return info
 }
 
@@ -507,6 +518,21 @@ func ensureAssetBundlePreviewWithProgress(label string, plainPath string, force
 		}
 	}
 
+	// texture-only bundles are decoded natively, which is much faster than
+	// starting AssetRipper
+	if textureOnlyBundle(plainPath) {
+		reportPreviewProgress(report, 46, "transcode", "native")
+		if _, err := unity.ExtractTextures(plainPath, outDir); err != nil {
+			debugLog("Native texture extraction failed: %v", err)
+		}
+		if info := findBundlePreview(outDir); info.Available {
+			reportPreviewProgress(report, 94, "finalize", "")
+			info.OutputDir = outputDirForClient(outDir)
+			info.Exportable = true
+			return info
+		}
+	}
+
 	if !assetBundleExportConfigured() {
 		return PreviewInfo{
 			OutputDir:  outputDirForClient(outDir),
@@ -1503,6 +1529,9 @@ func meshHasVertices(path string) bool {
 }
 
 func detectStreamCount(path string) int {
+	if acb := openAcb(path); acb != nil && acb.Subsongs() > 0 {
+		return acb.Subsongs()
+	}
 	out, err := exec.Command("vgmstream-cli", "-m", path).Output()
 	if err != nil {
 		return 1
@@ -1587,6 +1616,65 @@ func outputDirForClient(path string) string {
 	return abs
 }
 
+// acbPreviewExts are the extensions of ACB previews, the one written now
+// first. Previews are compressed to MP3 when ffmpeg is around.
+func acbPreviewExts() []string {
+	if ffmpegAvailable() {
+		return []string{".mp3", ".wav"}
+	}
+	return []string{".wav", ".mp3"}
+}
+
+func acbPreviewContentType(path string) string {
+	if strings.EqualFold(filepath.Ext(path), ".wav") {
+		return "audio/wav"
+	}
+	return "audio/mpeg"
+}
+
+// encodeAcbTrack decodes a track natively when it has an HCA waveform and
+// falls back to vgmstream otherwise.
+func encodeAcbTrack(inputPath string, acb *cri.Acb, waveform *cri.Waveform, outPath string, subsong int) (PreviewItem, bool) {
+	itemID := "01"
+	if subsong > 0 {
+		itemID = fmt.Sprintf("%02d", subsong)
+	}
+	if waveform != nil {
+		err := encodeAcbWaveform(acb, waveform, outPath)
+		if err == nil {
+			return PreviewItem{
+				ID:          itemID,
+				ContentType: acbPreviewContentType(outPath),
+				Path:        outPath,
+			}, true
+		}
+		debugLog("Native decode of %s track %d failed: %v", inputPath, max(subsong, 1), err)
+	}
+	if !acbToolsAvailable() || !strings.EqualFold(filepath.Ext(outPath), ".mp3") {
+		return PreviewItem{}, false
+	}
+	return encodeAcbToMp3(inputPath, outPath, subsong)
+}
+
+// encodeAcbWaveform decodes a waveform to outPath, as is for a WAV and
+// through ffmpeg for an MP3.
+func encodeAcbWaveform(acb *cri.Acb, waveform *cri.Waveform, outPath string) error {
+	if strings.EqualFold(filepath.Ext(outPath), ".wav") {
+		return decodeAcbWaveformToWav(acb, waveform, outPath)
+	}
+	tmpDir, err := os.MkdirTemp("", "hailstorm-acb")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	tmpWav := filepath.Join(tmpDir, "preview.wav")
+	if err := decodeAcbWaveformToWav(acb, waveform, tmpWav); err != nil {
+		return err
+	}
+	return transcodeWavToMp3(tmpWav, outPath)
+}
+
 func encodeAcbToMp3(inputPath string, outPath string, subsong int) (PreviewItem, bool) {
 	tmpDir, err := os.MkdirTemp("", "hailstorm-acb")
 	if err != nil {
@@ -1609,14 +1697,30 @@ func encodeAcbToMp3(inputPath string, outPath string, subsong int) (PreviewItem,
 		return PreviewItem{}, false
 	}
 
-	if err := exec.Command(
+	if err := transcodeWavToMp3(tmpWav, outPath); err != nil {
+		return PreviewItem{}, false
+	}
+
+	itemID := "01"
+	if subsong > 0 {
+		itemID = fmt.Sprintf("%02d", subsong)
+	}
+	return PreviewItem{
+		ID:          itemID,
+		ContentType: "audio/mpeg",
+		Path:        outPath,
+	}, true
+}
+
+func transcodeWavToMp3(wavPath string, outPath string) error {
+	return exec.Command(
 		"ffmpeg",
 		"-hide_banner",
 		"-loglevel",
 		"error",
 		"-y",
 		"-i",
-		tmpWav,
+		wavPath,
 		"-vn",
 		"-c:a",
 		"libmp3lame",
@@ -1625,22 +1729,15 @@ func encodeAcbToMp3(inputPath string, outPath string, subsong int) (PreviewItem,
 		"-f",
 		"mp3",
 		outPath,
-	).Run(); err != nil {
-		return PreviewItem{}, false
-	}
-
-	itemID := "01"
-	if subsong > 0 {
-		itemID = fmt.Sprintf("%02d", subsong)
-	}
-	return PreviewItem{
-		ID:          itemID,
-		ContentType: "audio/mpeg",
-		Path:        outPath,
-	}, true
+	).Run()
 }
 
 func detectLoop(path string, subsong int) bool {
+	if acb := openAcb(path); acb != nil {
+		if waveform, ok := acb.SubsongWaveform(max(subsong, 1)); ok {
+			return waveform.Loop
+		}
+	}
 	args := []string{"-m"}
 	if subsong > 0 {
 		args = append(args, "-s", fmt.Sprintf("%d", subsong))
@@ -2055,7 +2152,12 @@ func findUsmCompanionAcbPath(label string, usmPath string) string {
 }
 
 func ensureAcbAudioForUsm(acbPath string) (string, bool) {
-	if !acbToolsAvailable() {
+	if !ffmpegAvailable() {
+		return "", false
+	}
+	acb := openAcb(acbPath)
+	tracks := acbTracks(acb)
+	if len(tracks) == 0 && !acbToolsAvailable() {
 		return "", false
 	}
 	outDir := filepath.Join(previewRoot, "usm-audio")
@@ -2069,34 +2171,49 @@ func ensureAcbAudioForUsm(acbPath string) (string, bool) {
 	}
 
 	subsong := 0
-	if detectStreamCount(acbPath) > 1 {
+	if len(tracks) > 1 || (len(tracks) == 0 && detectStreamCount(acbPath) > 1) {
 		subsong = 1
 	}
-	if !encodeAcbToM4A(acbPath, outPath, subsong) {
+	if !encodeAcbToM4A(acbPath, acb, acbTrack(tracks, 1), outPath, subsong) {
 		return "", false
 	}
 	return outPath, true
 }
 
-func encodeAcbToM4A(inputPath string, outPath string, subsong int) bool {
+// encodeAcbToM4A decodes the waveform natively when there is one and with
+// vgmstream otherwise.
+func encodeAcbToM4A(inputPath string, acb *cri.Acb, waveform *cri.Waveform, outPath string, subsong int) bool {
 	tmpDir, err := os.MkdirTemp("", "hailstorm-acb-usm")
 	if err != nil {
 		return false
 	}
 	defer os.RemoveAll(tmpDir)
 
-	loopOnce := detectLoop(inputPath, subsong)
 	tmpWav := filepath.Join(tmpDir, "preview.wav")
-	vgmArgs := []string{}
-	if subsong > 0 {
-		vgmArgs = append(vgmArgs, "-s", fmt.Sprintf("%d", subsong))
-	}
-	if loopOnce {
-		vgmArgs = append(vgmArgs, "-L")
+	decoded := false
+	if waveform != nil {
+		if err := decodeAcbWaveformToWav(acb, waveform, tmpWav); err != nil {
+			debugLog("Native decode of %s failed: %v", inputPath, err)
+		} else {
+			decoded = true
+		}
 	}
-	vgmArgs = append(vgmArgs, inputPath, "-o", tmpWav)
-	if err := exec.Command("vgmstream-cli", vgmArgs...).Run(); err != nil {
-		return false
+	if !decoded {
+		if !acbToolsAvailable() {
+			return false
+		}
+		loopOnce := detectLoop(inputPath, subsong)
+		vgmArgs := []string{}
+		if subsong > 0 {
+			vgmArgs = append(vgmArgs, "-s", fmt.Sprintf("%d", subsong))
+		}
+		if loopOnce {
+			vgmArgs = append(vgmArgs, "-L")
+		}
+		vgmArgs = append(vgmArgs, inputPath, "-o", tmpWav)
+		if err := exec.Command("vgmstream-cli", vgmArgs...).Run(); err != nil {
+			return false
+		}
 	}
 
 	if err := exec.Command(
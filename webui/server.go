@@ -19,6 +19,7 @@ import (
 
 	"vertesan/hailstorm/manifest"
 	"vertesan/hailstorm/master"
+	"vertesan/hailstorm/rich"
 	"vertesan/hailstorm/runner"
 )
 
@@ -95,12 +96,14 @@ func (s *Server) routes() http.Handler {
 	mux.HandleFunc("/api/entry/raw", s.handleEntryRaw)
 	mux.HandleFunc("/api/entry/plain", s.handleEntryPlain)
 	mux.HandleFunc("/api/entry/yaml", s.handleEntryYaml)
+	mux.HandleFunc("/api/manifest/inspect", s.handleManifestInspect)
 	mux.HandleFunc("/api/masterdata", s.handleMasterList)
 	mux.HandleFunc("/api/masterdata/file", s.handleMasterFile)
 	mux.HandleFunc("/api/masterdata/versions", s.handleMasterVersions)
 	mux.HandleFunc("/api/masterdata/diff", s.handleMasterDiff)
 	mux.HandleFunc("/api/masterdata/diff/lookup", s.handleMasterDiffLookup)
 	mux.HandleFunc("/api/tasks", s.handleTasks)
+	mux.HandleFunc("/api/tasks/", s.handleTask)
 	mux.HandleFunc("/sse/tasks/", s.handleTaskStream)
 
 	return mux
@@ -172,6 +175,25 @@ func (s *Server) handleMasterPage(w http.ResponseWriter, r *http.Request) {
 	s.render(w, "masterdata.html", nil)
 }
 
+// handleManifestInspect decodes the resInfo query parameter, the current
+// version when missing, along with the optional clientVersion.
+func (s *Server) handleManifestInspect(w http.ResponseWriter, r *http.Request) {
+	resInfo := strings.TrimSpace(r.URL.Query().Get("resInfo"))
+	if resInfo == "" {
+		resInfo = readCurrentCatalogVersion()
+	}
+	if resInfo == "" {
+		http.Error(w, "missing resInfo", http.StatusBadRequest)
+		return
+	}
+	inspection, err := runner.InspectResInfo(resInfo, r.URL.Query().Get("clientVersion"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	writeJSON(w, inspection)
+}
+
 func (s *Server) handleStatus(w http.ResponseWriter, r *http.Request) {
 	_ = s.catalog.Reload()
 	entries, modTime, loaded := s.catalog.Stats()
@@ -315,6 +337,22 @@ func (s *Server) handleEntry(w http.ResponseWriter, r *http.Request) {
 		"parents":        parents,
 		"preview":        previewPayload(preview),
 	}
+	if plainOK && sniffBundle(plainPath) {
+		bundle, err := inspectBundle(plainPath)
+		if err != nil {
+			resp["bundleError"] = err.Error()
+		} else {
+			resp["bundle"] = bundle
+		}
+	}
+	if plainOK && isAcb(entry.StrLabelCrc) && sniffAcb(plainPath) {
+		acb, err := inspectAcb(plainPath)
+		if err != nil {
+			resp["acbError"] = err.Error()
+		} else {
+			resp["acb"] = acb
+		}
+	}
 	writeJSON(w, resp)
 }
 
@@ -398,7 +436,7 @@ func (s *Server) handleEntryPreviewExport(w http.ResponseWriter, r *http.Request
 	switch {
 	case isAssetBundle(entry.StrLabelCrc, entry.ResourceType):
 		kind = "assetbundle"
-		preview = inspectAssetBundlePreview(entry.StrLabelCrc)
+		preview = inspectAssetBundlePreview(entry.StrLabelCrc, path)
 	case isUsm(entry.StrLabelCrc):
 		kind = "usm"
 		preview = inspectUsmPreview(entry.StrLabelCrc, path)
@@ -574,6 +612,8 @@ func (s *Server) handleTasks(w http.ResponseWriter, r *http.Request) {
 			StartedAt string     `json:"startedAt"`
 			EndedAt   string     `json:"endedAt"`
 			Error     string     `json:"error"`
+
+			Progress *rich.Progress `json:"progress,omitempty"`
 		}
 		resp := make([]item, 0, len(list))
 		for _, task := range list {
@@ -588,6 +628,8 @@ func (s *Server) handleTasks(w http.ResponseWriter, r *http.Request) {
 				StartedAt: task.StartedAt.Format(time.RFC3339),
 				EndedAt:   ended,
 				Error:     task.Err,
+
+				Progress: task.Progress(),
 			})
 		}
 		writeJSON(w, resp)
@@ -602,9 +644,12 @@ func (s *Server) handleTasks(w http.ResponseWriter, r *http.Request) {
 			Force         bool   `json:"force"`
 			KeepRaw       bool   `json:"keepRaw"`
 			KeepPath      bool   `json:"keepPath"`
+			Stream        bool   `json:"stream"`
+			WithDeps      bool   `json:"withDeps"`
 			ClientVersion string `json:"clientVersion"`
 			ResInfo       string `json:"resInfo"`
 			FilterRegex   string `json:"filterRegex"`
+			DownloadOrder string `json:"downloadOrder"`
 		}
 		if err := json.Unmarshal(body, &req); err != nil {
 			http.Error(w, "invalid json", http.StatusBadRequest)
@@ -614,9 +659,12 @@ func (s *Server) handleTasks(w http.ResponseWriter, r *http.Request) {
 			Force:         req.Force,
 			KeepRaw:       req.KeepRaw,
 			KeepPath:      req.KeepPath,
+			Stream:        req.Stream,
+			WithDeps:      req.WithDeps,
 			ClientVersion: strings.TrimSpace(req.ClientVersion),
 			ResInfo:       strings.TrimSpace(req.ResInfo),
 			FilterRegex:   strings.TrimSpace(req.FilterRegex),
+			DownloadOrder: strings.TrimSpace(req.DownloadOrder),
 		}
 
 		mode := strings.ToLower(strings.TrimSpace(req.Mode))
@@ -648,6 +696,25 @@ func (s *Server) handleTasks(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// handleTask serves `DELETE /api/tasks/{id}`, which cancels a running task.
+func (s *Server) handleTask(w http.ResponseWriter, r *http.Request) {
+	id := strings.TrimPrefix(r.URL.Path, "/api/tasks/")
+	if r.Method != http.MethodDelete {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err := s.tasks.Cancel(id); err != nil {
+		switch {
+		case errors.Is(err, ErrTaskNotFound):
+			http.Error(w, err.Error(), http.StatusNotFound)
+		default:
+			http.Error(w, err.Error(), http.StatusConflict)
+		}
+		return
+	}
+	writeJSON(w, map[string]string{"id": id, "status": "cancelling"})
+}
+
 func (s *Server) handleTaskStream(w http.ResponseWriter, r *http.Request) {
 	id := strings.TrimPrefix(r.URL.Path, "/sse/tasks/")
 	task := s.tasks.Get(id)
@@ -669,6 +736,9 @@ func (s *Server) handleTaskStream(w http.ResponseWriter, r *http.Request) {
 	for _, entry := range task.Logs() {
 		writeSSE(w, "log", entry)
 	}
+	if progress := task.Progress(); progress != nil {
+		writeSSE(w, "progress", progress)
+	}
 	flusher.Flush()
 
 	ch := task.Subscribe()
@@ -678,11 +748,11 @@ func (s *Server) handleTaskStream(w http.ResponseWriter, r *http.Request) {
 		select {
 		case <-r.Context().Done():
 			return
-		case entry, ok := <-ch:
+		case event, ok := <-ch:
 			if !ok {
 				return
 			}
-			writeSSE(w, "log", entry)
+			writeSSE(w, event.Name, event.Data)
 			flusher.Flush()
 		}
 	}
@@ -693,11 +763,8 @@ func (s *Server) findEntry(label string) (manifest.Entry, error) {
 		return manifest.Entry{}, errors.New("missing label")
 	}
 	_ = s.catalog.Reload()
-	entries := s.catalog.Entries()
-	for _, entry := range entries {
-		if entry.StrLabelCrc == label {
-			return entry, nil
-		}
+	if entry, ok := s.catalog.Lookup(label); ok {
+		return entry, nil
 	}
 	return manifest.Entry{}, errors.New("entry not found")
 }
@@ -20,6 +20,15 @@ const App = (() => {
     return res.json();
   }
 
+  async function apiDelete(url) {
+    const res = await fetch(url, { method: "DELETE" });
+    if (!res.ok) {
+      const text = await res.text();
+      throw new Error(text || `Request failed: ${res.status}`);
+    }
+    return res.json();
+  }
+
   function formatBytes(bytes) {
     if (bytes === 0 || bytes === null || bytes === undefined) {
       return "0 B";
@@ -44,6 +53,7 @@ const App = (() => {
   return {
     apiGet,
     apiPost,
+    apiDelete,
     formatBytes,
     formatNumber,
   };
@@ -1,4 +1,5 @@
 let taskStream = null;
+let runningTaskId = null;
 
 function setStatusBadge(updated) {
   const badge = document.getElementById("statusUpdated");
@@ -58,10 +59,70 @@ function appendLog(line) {
   log.scrollTop = log.scrollHeight;
 }
 
-function attachTaskStream(id) {
+function formatEta(seconds) {
+  if (seconds < 0) {
+    return "--:--";
+  }
+  const total = Math.round(seconds);
+  const hours = Math.floor(total / 3600);
+  const minutes = String(Math.floor((total % 3600) / 60)).padStart(2, "0");
+  const secs = String(total % 60).padStart(2, "0");
+  return hours > 0 ? `${hours}:${minutes}:${secs}` : `${minutes}:${secs}`;
+}
+
+function renderProgress(progress) {
+  const container = document.getElementById("taskProgress");
+  if (!container) {
+    return;
+  }
+  if (!progress) {
+    container.classList.add("d-none");
+    return;
+  }
+  container.classList.remove("d-none");
+  let ratio = 0;
+  if (progress.bytesTotal > 0) {
+    ratio = progress.bytesDone / progress.bytesTotal;
+  } else if (progress.total > 0) {
+    ratio = progress.done / progress.total;
+  }
+  if (progress.finished && progress.done === progress.total) {
+    ratio = 1;
+  }
+  const percent = Math.min(100, Math.round(ratio * 100));
+  const bar = document.getElementById("taskProgressBar");
+  bar.style.width = `${percent}%`;
+  bar.textContent = `${percent}%`;
+  const phaseKey = `home.progress.${progress.phase}`;
+  const phase = I18n.t(phaseKey);
+  document.getElementById("taskProgressPhase").textContent =
+    phase === phaseKey ? progress.phase : phase;
+  const stats = [
+    `${progress.done}/${progress.total}`,
+    `${App.formatBytes(progress.bytesDone)} / ${App.formatBytes(progress.bytesTotal)}`,
+  ];
+  if (!progress.finished) {
+    stats.push(`${App.formatBytes(progress.rate)}/s`);
+    stats.push(I18n.t("home.progressEta", { eta: formatEta(progress.eta) }));
+  }
+  document.getElementById("taskProgressStats").textContent = stats.join(" · ");
+}
+
+function setCancelTarget(id) {
+  runningTaskId = id;
+  const cancelBtn = document.getElementById("taskCancel");
+  if (cancelBtn) {
+    cancelBtn.classList.toggle("d-none", !id);
+    cancelBtn.disabled = false;
+  }
+}
+
+function attachTaskStream(id, running) {
   if (taskStream) {
     taskStream.close();
   }
+  setCancelTarget(running ? id : null);
+  renderProgress(null);
   const log = document.getElementById("taskLog");
   if (log) {
     log.textContent = "";
@@ -71,9 +132,16 @@ function attachTaskStream(id) {
     const entry = JSON.parse(event.data);
     appendLog(`[${entry.time}] [${entry.level}] ${entry.message}`);
   });
+  taskStream.addEventListener("progress", (event) => {
+    renderProgress(JSON.parse(event.data));
+  });
   taskStream.onerror = () => {
     appendLog("Log stream closed.");
     taskStream.close();
+    if (runningTaskId === id) {
+      setCancelTarget(null);
+      loadTasks();
+    }
   };
 }
 
@@ -99,7 +167,9 @@ function renderTaskHistory(tasks) {
       status.innerHTML = `<span class="badge">${task.status}</span>`;
       card.appendChild(label);
       card.appendChild(status);
-      card.addEventListener("click", () => attachTaskStream(task.id));
+      card.addEventListener("click", () =>
+        attachTaskStream(task.id, task.status === "running")
+      );
       container.appendChild(card);
     });
 }
@@ -109,8 +179,8 @@ async function loadTasks() {
     const tasks = await App.apiGet("/api/tasks");
     renderTaskHistory(tasks);
     const running = tasks.find((task) => task.status === "running");
-    if (running) {
-      attachTaskStream(running.id);
+    if (running && running.id !== runningTaskId) {
+      attachTaskStream(running.id, true);
     }
   } catch (err) {
     const container = document.getElementById("taskHistory");
@@ -143,19 +213,37 @@ function setupTaskForm() {
       force: document.getElementById("taskForce").checked,
       keepRaw: document.getElementById("taskKeepRaw").checked,
       keepPath: document.getElementById("taskKeepPath").checked,
+      stream: document.getElementById("taskStream").checked,
+      withDeps: document.getElementById("taskWithDeps").checked,
       clientVersion: document.getElementById("taskClientVersion").value,
       resInfo: document.getElementById("taskResInfo").value,
       filterRegex: document.getElementById("taskFilterRegex").value,
     };
     try {
       const data = await App.apiPost("/api/tasks", payload);
-      attachTaskStream(data.id);
+      attachTaskStream(data.id, true);
       loadTasks();
     } catch (err) {
       appendLog(`Task failed: ${err.message}`);
     }
   });
 
+  const cancelBtn = document.getElementById("taskCancel");
+  if (cancelBtn) {
+    cancelBtn.addEventListener("click", async () => {
+      if (!runningTaskId) {
+        return;
+      }
+      cancelBtn.disabled = true;
+      try {
+        await App.apiDelete(`/api/tasks/${runningTaskId}`);
+      } catch (err) {
+        appendLog(I18n.t("home.cancelFailed", { message: err.message }));
+        cancelBtn.disabled = false;
+      }
+    });
+  }
+
   const clearBtn = document.getElementById("taskClear");
   if (clearBtn) {
     clearBtn.addEventListener("click", () => {
@@ -43,9 +43,18 @@ window.I18n = (() => {
       "home.keepRawDesc": "Preserve cache/assets instead of deleting after decrypt.",
       "home.keepPath": "Keep download path",
       "home.keepPathDesc": "Keep original folder structure under cache/assets.",
+      "home.stream": "Stream decrypt",
+      "home.streamDesc": "Decrypt while downloading, raw files are only kept with \"Keep raw cache\".",
+      "home.withDeps": "With dependencies",
+      "home.withDepsDesc": "Also download everything the selected assets depend on.",
       "home.startTask": "Start task",
       "home.taskLog": "Task log",
       "home.clearLog": "Clear",
+      "home.progress.download": "Downloading",
+      "home.progress.decrypt": "Decrypting",
+      "home.progressEta": "ETA {{eta}}",
+      "home.cancelTask": "Cancel task",
+      "home.cancelFailed": "Cancel failed: {{message}}",
       "home.quickFilters": "Quick filters",
       "home.filterMedia": "Media",
       "home.filterCharacter": "Character",
@@ -200,6 +209,20 @@ window.I18n = (() => {
       "view.referencedBy": "Referenced by",
       "view.loadingParents": "Loading...",
       "view.noParents": "No parent references.",
+      "view.bundleContents": "Bundle contents",
+      "view.bundleFileCount": "{{count}} files",
+      "view.bundleObjectCount": "{{count}} objects",
+      "view.bundleExternal": "External file",
+      "view.bundleFailed": "Failed to read bundle:",
+      "view.acbCues": "Cues",
+      "view.acbCueCount": "{{count}} cues",
+      "view.acbWaveformCount": "{{count}} waveforms",
+      "view.acbStreamAwb": "Streamed from",
+      "view.acbStreamAwbMissing": "Companion .awb not found",
+      "view.acbLoop": "Loop",
+      "view.acbStreamed": "Streamed",
+      "view.acbWaveform": "Waveform",
+      "view.acbFailed": "Failed to read ACB:",
       "view.preview": "Preview",
       "view.dependencies": "Dependencies",
       "view.contentTypes": "Content types",
@@ -493,9 +516,18 @@ window.I18n = (() => {
       "home.keepRawDesc": "解密后不清理 cache/assets 原始文件。",
       "home.keepPath": "保留下载路径",
       "home.keepPathDesc": "保持 cache/assets 的原始目录结构。",
+      "home.stream": "边下载边解密",
+      "home.streamDesc": "下载时直接解密到 cache/plain，仅在勾选“保留原始缓存”时保存原始文件。",
+      "home.withDeps": "包含依赖",
+      "home.withDepsDesc": "同时下载所选资源递归依赖的全部资源。",
       "home.startTask": "开始任务",
       "home.taskLog": "任务日志",
       "home.clearLog": "清空",
+      "home.progress.download": "下载中",
+      "home.progress.decrypt": "解密中",
+      "home.progressEta": "剩余 {{eta}}",
+      "home.cancelTask": "取消任务",
+      "home.cancelFailed": "取消失败：{{message}}",
       "home.quickFilters": "快捷筛选",
       "home.filterMedia": "资源类型",
       "home.filterCharacter": "角色",
@@ -645,6 +677,20 @@ window.I18n = (() => {
       "view.referencedBy": "被引用于",
       "view.loadingParents": "加载中...",
       "view.noParents": "暂无父级引用。",
+      "view.bundleContents": "包内容",
+      "view.bundleFileCount": "{{count}} 个文件",
+      "view.bundleObjectCount": "{{count}} 个对象",
+      "view.bundleExternal": "外部文件",
+      "view.bundleFailed": "读取资源包失败：",
+      "view.acbCues": "Cue 列表",
+      "view.acbCueCount": "{{count}} 个 Cue",
+      "view.acbWaveformCount": "{{count}} 个波形",
+      "view.acbStreamAwb": "流式数据来自",
+      "view.acbStreamAwbMissing": "未找到配套的 .awb",
+      "view.acbLoop": "循环",
+      "view.acbStreamed": "流式",
+      "view.acbWaveform": "波形",
+      "view.acbFailed": "读取 ACB 失败：",
       "view.preview": "预览",
       "view.dependencies": "依赖",
       "view.contentTypes": "内容类型",
@@ -931,9 +977,18 @@ window.I18n = (() => {
       "home.keepRawDesc": "復号後も cache/assets を削除しません。",
       "home.keepPath": "ダウンロード経路を保持",
       "home.keepPathDesc": "cache/assets の元ディレクトリ構造を保持します。",
+      "home.stream": "ストリーミング復号",
+      "home.streamDesc": "ダウンロードしながら cache/plain へ復号します。生ファイルは「生キャッシュを保持」が有効な場合のみ保存します。",
+      "home.withDeps": "依存関係を含める",
+      "home.withDepsDesc": "選択したアセットが再帰的に依存するものもすべてダウンロードします。",
       "home.startTask": "タスク開始",
       "home.taskLog": "タスクログ",
       "home.clearLog": "クリア",
+      "home.progress.download": "ダウンロード中",
+      "home.progress.decrypt": "復号中",
+      "home.progressEta": "残り {{eta}}",
+      "home.cancelTask": "タスクを中止",
+      "home.cancelFailed": "中止できませんでした: {{message}}",
       "home.quickFilters": "クイックフィルター",
       "home.filterMedia": "種類",
       "home.filterCharacter": "キャラクター",
@@ -1086,6 +1141,20 @@ window.I18n = (() => {
       "view.referencedBy": "参照元",
       "view.loadingParents": "読み込み中...",
       "view.noParents": "親参照はありません。",
+      "view.bundleContents": "バンドル内容",
+      "view.bundleFileCount": "{{count}} ファイル",
+      "view.bundleObjectCount": "{{count}} オブジェクト",
+      "view.bundleExternal": "外部ファイル",
+      "view.bundleFailed": "バンドルの読み込みに失敗しました：",
+      "view.acbCues": "キュー",
+      "view.acbCueCount": "{{count}} キュー",
+      "view.acbWaveformCount": "{{count}} 波形",
+      "view.acbStreamAwb": "ストリーム元",
+      "view.acbStreamAwbMissing": "対応する .awb が見つかりません",
+      "view.acbLoop": "ループ",
+      "view.acbStreamed": "ストリーム",
+      "view.acbWaveform": "波形",
+      "view.acbFailed": "ACB の読み込みに失敗しました：",
       "view.preview": "プレビュー",
       "view.dependencies": "依存関係",
       "view.contentTypes": "コンテンツタイプ",
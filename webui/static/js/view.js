@@ -1925,6 +1925,133 @@ function renderParentList(parents) {
   });
 }
 
+function renderBundleContents(bundle, error) {
+  const panel = document.getElementById("bundlePanel");
+  const summary = document.getElementById("bundleSummary");
+  const container = document.getElementById("bundleList");
+  if (!panel || !summary || !container) {
+    return;
+  }
+  panel.classList.toggle("d-none", !bundle && !error);
+  container.innerHTML = "";
+  if (!bundle) {
+    summary.textContent = error ? `${I18n.t("view.bundleFailed")} ${error}` : "-";
+    return;
+  }
+
+  const files = Array.isArray(bundle.files) ? bundle.files : [];
+  summary.textContent = [
+    `Unity ${bundle.unityVersion || "-"}`,
+    bundle.compression || "-",
+    I18n.t("view.bundleFileCount", { count: files.length }),
+  ].join(" · ");
+
+  const appendRow = (labelText, metaText) => {
+    const row = document.createElement("div");
+    row.className = "parent-item";
+    const label = document.createElement("span");
+    label.className = "parent-item-label";
+    label.textContent = labelText;
+    const meta = document.createElement("span");
+    meta.className = "parent-item-meta";
+    meta.textContent = metaText;
+    row.appendChild(label);
+    row.appendChild(meta);
+    container.appendChild(row);
+  };
+
+  files
+    .filter((file) => !file.serialized)
+    .forEach((file) => {
+      appendRow(file.path || "-", App.formatBytes(file.size || 0));
+    });
+
+  const serialized = Array.isArray(bundle.serializedFiles) ? bundle.serializedFiles : [];
+  serialized.forEach((file) => {
+    const title = document.createElement("div");
+    title.className = "bundle-file-title";
+    title.textContent = `${file.path || "-"} (${I18n.t("view.bundleObjectCount", {
+      count: file.objectCount || 0,
+    })})`;
+    container.appendChild(title);
+
+    (Array.isArray(file.objects) ? file.objects : []).forEach((object) => {
+      appendRow(
+        object.name || object.type || "-",
+        `${object.type || "-"} · ${object.pathId} · ${App.formatBytes(object.size || 0)}`
+      );
+    });
+    (Array.isArray(file.externals) ? file.externals : []).forEach((external) => {
+      appendRow(external.path || "-", `${I18n.t("view.bundleExternal")} #${external.fileId}`);
+    });
+  });
+}
+
+function formatAcbDuration(milliseconds) {
+  if (!milliseconds || milliseconds < 0) {
+    return "-";
+  }
+  const total = milliseconds / 1000;
+  const minutes = Math.floor(total / 60);
+  const seconds = (total % 60).toFixed(1).padStart(4, "0");
+  return `${minutes}:${seconds}`;
+}
+
+function renderAcbCues(acb, error) {
+  const panel = document.getElementById("acbPanel");
+  const summary = document.getElementById("acbSummary");
+  const container = document.getElementById("acbList");
+  if (!panel || !summary || !container) {
+    return;
+  }
+  panel.classList.toggle("d-none", !acb && !error);
+  container.innerHTML = "";
+  if (!acb) {
+    summary.textContent = error ? `${I18n.t("view.acbFailed")} ${error}` : "-";
+    return;
+  }
+
+  const cues = Array.isArray(acb.cues) ? acb.cues : [];
+  const waveforms = Array.isArray(acb.waveforms) ? acb.waveforms : [];
+  const parts = [
+    acb.name || "-",
+    I18n.t("view.acbCueCount", { count: cues.length }),
+    I18n.t("view.acbWaveformCount", { count: waveforms.length }),
+  ];
+  if (acb.streamed) {
+    parts.push(acb.streamAwb ? `${I18n.t("view.acbStreamAwb")} ${acb.streamAwb}` : I18n.t("view.acbStreamAwbMissing"));
+  }
+  summary.textContent = parts.join(" · ");
+
+  cues.forEach((cue) => {
+    const played = (Array.isArray(cue.waveforms) ? cue.waveforms : [])
+      .map((index) => waveforms[index])
+      .filter(Boolean);
+    const first = played[0] || {};
+    const meta = [
+      `#${cue.id}`,
+      Array.from(new Set(played.map((waveform) => waveform.codec))).join("/") || "-",
+      first.channels ? `${first.channels}ch · ${first.sampleRate} Hz` : "",
+      formatAcbDuration(cue.lengthMs || first.durationMs),
+      played.some((waveform) => waveform.loop) ? I18n.t("view.acbLoop") : "",
+      played.some((waveform) => waveform.streaming) ? I18n.t("view.acbStreamed") : "",
+      played.length ? `${I18n.t("view.acbWaveform")} ${played.map((waveform) => waveform.id).join(", ")}` : "",
+    ].filter(Boolean);
+
+    const row = document.createElement("div");
+    row.className = "parent-item";
+    const label = document.createElement("span");
+    label.className = "parent-item-label";
+    label.textContent = cue.name || `#${cue.id}`;
+    const detail = document.createElement("span");
+    detail.className = "parent-item-meta";
+    detail.textContent = meta.join(" · ");
+    row.appendChild(label);
+    row.appendChild(detail);
+    container.appendChild(row);
+  });
+}
+
 async function inferPrefabPendingDependencies(dependencies) {
   const labels = Array.from(
     new Set(
@@ -5974,6 +6101,8 @@ async function loadEntry() {
   renderPills(document.getElementById("contentList"), data.contentTypes);
   renderPills(document.getElementById("categoryList"), data.categories);
   renderParentList(data.parents);
+  renderBundleContents(data.bundle, data.bundleError);
+  renderAcbCues(data.acb, data.acbError);
   renderPreview(data.preview, label);
   renderPreviewActions(data.preview, label);
   if (viewDiffReady) {
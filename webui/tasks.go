@@ -1,6 +1,7 @@
 package webui
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"sync"
@@ -16,6 +17,8 @@ const (
 	TaskRunning TaskStatus = "running"
 	TaskSuccess TaskStatus = "success"
 	TaskError   TaskStatus = "error"
+	// TaskCancelled marks a task stopped through TaskManager.Cancel.
+	TaskCancelled TaskStatus = "cancelled"
 )
 
 type LogEntry struct {
@@ -24,6 +27,12 @@ type LogEntry struct {
 	Message string `json:"message"`
 }
 
+// TaskEvent is sent to the subscribers of a task, Name is the SSE event name.
+type TaskEvent struct {
+	Name string
+	Data any
+}
+
 type Task struct {
 	ID        string     `json:"id"`
 	Mode      string     `json:"mode"`
@@ -32,9 +41,11 @@ type Task struct {
 	EndedAt   time.Time  `json:"endedAt"`
 	Err       string     `json:"error"`
 
-	mu   sync.RWMutex
-	logs []LogEntry
-	subs map[chan LogEntry]struct{}
+	mu       sync.RWMutex
+	logs     []LogEntry
+	progress *rich.Progress
+	subs     map[chan TaskEvent]struct{}
+	cancel   context.CancelFunc
 }
 
 func NewTask(id string, mode string) *Task {
@@ -43,7 +54,7 @@ func NewTask(id string, mode string) *Task {
 		Mode:      mode,
 		Status:    TaskRunning,
 		StartedAt: time.Now(),
-		subs:      make(map[chan LogEntry]struct{}),
+		subs:      make(map[chan TaskEvent]struct{}),
 	}
 }
 
@@ -55,13 +66,37 @@ func (t *Task) AddLog(level string, message string) {
 	}
 	t.mu.Lock()
 	t.logs = append(t.logs, entry)
+	t.publishLocked(TaskEvent{"log", entry})
+	t.mu.Unlock()
+}
+
+// SetProgress keeps the latest progress of the task and forwards it.
+func (t *Task) SetProgress(p rich.Progress) {
+	t.mu.Lock()
+	t.progress = &p
+	t.publishLocked(TaskEvent{"progress", p})
+	t.mu.Unlock()
+}
+
+// Progress returns the latest progress, or nil before any is reported.
+func (t *Task) Progress() *rich.Progress {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	if t.progress == nil {
+		return nil
+	}
+	p := *t.progress
+	return &p
+}
+
+// publishLocked drops the event for subscribers which are not keeping up.
+func (t *Task) publishLocked(event TaskEvent) {
 	for ch := range t.subs {
 		select {
-		case ch <- entry:
+		case ch <- event:
 		default:
 		}
 	}
-	t.mu.Unlock()
 }
 
 func (t *Task) Logs() []LogEntry {
@@ -72,15 +107,15 @@ func (t *Task) Logs() []LogEntry {
 	return copyLogs
 }
 
-func (t *Task) Subscribe() chan LogEntry {
-	ch := make(chan LogEntry, 128)
+func (t *Task) Subscribe() chan TaskEvent {
+	ch := make(chan TaskEvent, 128)
 	t.mu.Lock()
 	t.subs[ch] = struct{}{}
 	t.mu.Unlock()
 	return ch
 }
 
-func (t *Task) Unsubscribe(ch chan LogEntry) {
+func (t *Task) Unsubscribe(ch chan TaskEvent) {
 	t.mu.Lock()
 	if _, ok := t.subs[ch]; ok {
 		delete(t.subs, ch)
@@ -98,6 +133,11 @@ func (t *Task) CloseSubscribers() {
 	t.mu.Unlock()
 }
 
+var (
+	ErrTaskNotFound   = errors.New("task not found")
+	ErrTaskNotRunning = errors.New("task is not running")
+)
+
 type TaskManager struct {
 	mu      sync.RWMutex
 	tasks   map[string]*Task
@@ -120,6 +160,8 @@ func (m *TaskManager) Start(mode string, opts runner.Options) (*Task, error) {
 	}
 	id := fmt.Sprintf("%d", time.Now().UnixNano())
 	task := NewTask(id, mode)
+	ctx, cancel := context.WithCancel(context.Background())
+	task.cancel = cancel
 	m.tasks[id] = task
 	m.active = task
 	m.mu.Unlock()
@@ -129,22 +171,32 @@ func (m *TaskManager) Start(mode string, opts runner.Options) (*Task, error) {
 		rich.SetHook(func(level string, message string) {
 			task.AddLog(level, message)
 		})
-		err := runner.Run(opts)
+		rich.SetProgressHook(task.SetProgress)
+		err := runner.Run(ctx, opts)
 		rich.SetHook(nil)
+		rich.SetProgressHook(nil)
+		cancel()
 
+		cancelled := errors.Is(err, context.Canceled)
 		task.mu.Lock()
-		if err != nil {
+		switch {
+		case cancelled:
+			task.Status = TaskCancelled
+		case err != nil:
 			task.Status = TaskError
 			task.Err = err.Error()
-		} else {
+		default:
 			task.Status = TaskSuccess
 		}
 		task.EndedAt = time.Now()
 		task.mu.Unlock()
 
-		if err != nil {
+		switch {
+		case cancelled:
+			task.AddLog("warning", "Task cancelled.")
+		case err != nil:
 			task.AddLog("error", err.Error())
-		} else {
+		default:
 			task.AddLog("info", "Task finished.")
 		}
 
@@ -164,6 +216,24 @@ func (m *TaskManager) Start(mode string, opts runner.Options) (*Task, error) {
 	return task, nil
 }
 
+// Cancel asks the running task id to stop. The task finishes on its own once
+// the runner reaches a safe point, its status then becomes TaskCancelled.
+func (m *TaskManager) Cancel(id string) error {
+	task := m.Get(id)
+	if task == nil {
+		return ErrTaskNotFound
+	}
+	task.mu.RLock()
+	running := task.Status == TaskRunning
+	task.mu.RUnlock()
+	if !running {
+		return ErrTaskNotRunning
+	}
+	task.AddLog("warning", "Cancelling task...")
+	task.cancel()
+	return nil
+}
+
 func (m *TaskManager) Active() *Task {
 	m.mu.RLock()
 	defer m.mu.RUnlock()